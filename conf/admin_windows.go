@@ -0,0 +1,27 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+const adminRegKey = `Software\WireGuard`
+
+// AdminBool reads a DWORD from HKLM\Software\WireGuard, which may only be written by administrators,
+// and reports whether it is set to a non-zero value. Missing keys and values read as false.
+func AdminBool(name string) bool {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, adminRegKey, registry.READ)
+	if err != nil {
+		return false
+	}
+	defer key.Close()
+	val, valType, err := key.GetIntegerValue(name)
+	if err != nil || valType != registry.DWORD {
+		return false
+	}
+	return val != 0
+}
@@ -0,0 +1,279 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// ipRange is an inclusive range of addresses of one family. IPv4 addresses are kept in the last four
+// bytes, so that the same arithmetic works for both.
+type ipRange struct {
+	bits        uint8
+	first, last [16]byte
+}
+
+// A CIDRSet is a set of addresses, kept as sorted ranges that neither overlap nor touch, so that two
+// sets holding the same addresses always give the same prefixes back. The zero value is empty.
+type CIDRSet struct {
+	ranges []ipRange
+}
+
+func hostMask(hostBits uint8) (mask [16]byte) {
+	for i := 0; i < int(hostBits); i++ {
+		mask[15-i/8] |= 1 << uint(i%8)
+	}
+	return
+}
+
+func familyLast(bits uint8) [16]byte {
+	return hostMask(bits)
+}
+
+func nextAddress(a [16]byte) [16]byte {
+	for i := 15; i >= 0; i-- {
+		a[i]++
+		if a[i] != 0 {
+			break
+		}
+	}
+	return a
+}
+
+func previousAddress(a [16]byte) [16]byte {
+	for i := 15; i >= 0; i-- {
+		a[i]--
+		if a[i] != 0xff {
+			break
+		}
+	}
+	return a
+}
+
+func compareAddresses(a, b [16]byte) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+func cidrRange(cidr *IPCidr) (r ipRange, ok bool) {
+	if ip4 := cidr.IP.To4(); ip4 != nil {
+		r.bits = 32
+		copy(r.first[12:], ip4)
+	} else if ip6 := cidr.IP.To16(); ip6 != nil {
+		r.bits = 128
+		copy(r.first[:], ip6)
+	} else {
+		return r, false
+	}
+	prefix := cidr.Cidr
+	if prefix > r.bits {
+		prefix = r.bits
+	}
+	mask := hostMask(r.bits - prefix)
+	for i := range r.first {
+		r.first[i] &^= mask[i]
+		r.last[i] = r.first[i] | mask[i]
+	}
+	return r, true
+}
+
+func (r *ipRange) less(other *ipRange) bool {
+	if r.bits != other.bits {
+		return r.bits < other.bits
+	}
+	return compareAddresses(r.first, other.first) < 0
+}
+
+// cidrs splits r into the fewest prefixes that cover it exactly, taking the largest aligned prefix
+// at each step.
+func (r *ipRange) cidrs() (cidrs []IPCidr) {
+	end := familyLast(r.bits)
+	start := r.first
+	for {
+		hostBits := uint8(0)
+		for hostBits < r.bits {
+			mask := hostMask(hostBits + 1)
+			aligned := true
+			var last [16]byte
+			for i := range start {
+				aligned = aligned && start[i]&mask[i] == 0
+				last[i] = start[i] | mask[i]
+			}
+			if !aligned || compareAddresses(last, r.last) > 0 {
+				break
+			}
+			hostBits++
+		}
+		var ip net.IP
+		if r.bits == 32 {
+			ip = make(net.IP, net.IPv4len)
+			copy(ip, start[12:])
+		} else {
+			ip = make(net.IP, net.IPv6len)
+			copy(ip, start[:])
+		}
+		cidrs = append(cidrs, IPCidr{IP: ip, Cidr: r.bits - hostBits})
+
+		mask := hostMask(hostBits)
+		for i := range start {
+			start[i] |= mask[i]
+		}
+		if start == r.last || start == end {
+			return
+		}
+		start = nextAddress(start)
+	}
+}
+
+func normalizeRanges(ranges []ipRange) []ipRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].less(&ranges[j])
+	})
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if len(merged) > 0 {
+			previous := &merged[len(merged)-1]
+			if previous.bits == r.bits && (previous.last == familyLast(r.bits) || compareAddresses(nextAddress(previous.last), r.first) >= 0) {
+				if compareAddresses(r.last, previous.last) > 0 {
+					previous.last = r.last
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// NewCIDRSet makes a set of the addresses in cidrs. Entries without an address are left out.
+func NewCIDRSet(cidrs ...IPCidr) *CIDRSet {
+	s := &CIDRSet{ranges: make([]ipRange, 0, len(cidrs))}
+	for i := range cidrs {
+		if r, ok := cidrRange(&cidrs[i]); ok {
+			s.ranges = append(s.ranges, r)
+		}
+	}
+	s.ranges = normalizeRanges(s.ranges)
+	return s
+}
+
+func (s *CIDRSet) IsEmpty() bool {
+	return len(s.ranges) == 0
+}
+
+func (s *CIDRSet) Contains(ip net.IP) bool {
+	r, ok := cidrRange(&IPCidr{IP: ip, Cidr: 128})
+	if !ok {
+		return false
+	}
+	for i := range s.ranges {
+		if s.ranges[i].bits == r.bits && compareAddresses(s.ranges[i].first, r.first) <= 0 && compareAddresses(r.first, s.ranges[i].last) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CIDRSet) Equal(other *CIDRSet) bool {
+	if len(s.ranges) != len(other.ranges) {
+		return false
+	}
+	for i := range s.ranges {
+		if s.ranges[i] != other.ranges[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CIDRs returns the fewest prefixes that hold exactly the addresses of the set, IPv4 before IPv6, each
+// in ascending order.
+func (s *CIDRSet) CIDRs() []IPCidr {
+	cidrs := make([]IPCidr, 0, len(s.ranges))
+	for i := range s.ranges {
+		cidrs = append(cidrs, s.ranges[i].cidrs()...)
+	}
+	return cidrs
+}
+
+func (s *CIDRSet) Union(other *CIDRSet) *CIDRSet {
+	ranges := make([]ipRange, 0, len(s.ranges)+len(other.ranges))
+	ranges = append(ranges, s.ranges...)
+	ranges = append(ranges, other.ranges...)
+	return &CIDRSet{ranges: normalizeRanges(ranges)}
+}
+
+func (s *CIDRSet) Intersect(other *CIDRSet) *CIDRSet {
+	result := &CIDRSet{}
+	i, j := 0, 0
+	for i < len(s.ranges) && j < len(other.ranges) {
+		a, b := &s.ranges[i], &other.ranges[j]
+		if a.bits != b.bits {
+			if a.bits < b.bits {
+				i++
+			} else {
+				j++
+			}
+			continue
+		}
+		r := ipRange{bits: a.bits, first: a.first, last: a.last}
+		if compareAddresses(b.first, r.first) > 0 {
+			r.first = b.first
+		}
+		if compareAddresses(b.last, r.last) < 0 {
+			r.last = b.last
+		}
+		if compareAddresses(r.first, r.last) <= 0 {
+			result.ranges = append(result.ranges, r)
+		}
+		if compareAddresses(a.last, b.last) < 0 {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+// Subtract returns the addresses of s that are not in other.
+func (s *CIDRSet) Subtract(other *CIDRSet) *CIDRSet {
+	result := &CIDRSet{}
+	j := 0
+	for _, r := range s.ranges {
+		covered := false
+		for j < len(other.ranges) && (other.ranges[j].bits < r.bits || other.ranges[j].bits == r.bits && compareAddresses(other.ranges[j].last, r.first) < 0) {
+			j++
+		}
+		for k := j; k < len(other.ranges) && other.ranges[k].bits == r.bits && compareAddresses(other.ranges[k].first, r.last) <= 0; k++ {
+			cut := &other.ranges[k]
+			if compareAddresses(cut.first, r.first) > 0 {
+				result.ranges = append(result.ranges, ipRange{bits: r.bits, first: r.first, last: previousAddress(cut.first)})
+			}
+			if compareAddresses(cut.last, r.last) >= 0 {
+				covered = true
+				break
+			}
+			r.first = nextAddress(cut.last)
+		}
+		if !covered {
+			result.ranges = append(result.ranges, r)
+		}
+	}
+	return result
+}
+
+// NormalizeCIDRs merges overlapping, contained, and adjacent prefixes, and sorts what is left.
+func NormalizeCIDRs(cidrs []IPCidr) []IPCidr {
+	return NewCIDRSet(cidrs...).CIDRs()
+}
+
+// AllowedIPsExcluding returns the allowed IPs that route everything, 0.0.0.0/0 and ::/0, except for
+// excluded, such as a local network that should stay reachable while the tunnel is up.
+func AllowedIPsExcluding(excluded ...IPCidr) []IPCidr {
+	everything := NewCIDRSet(IPCidr{IP: net.IPv4zero, Cidr: 0}, IPCidr{IP: net.IPv6zero, Cidr: 0})
+	return everything.Subtract(NewCIDRSet(excluded...)).CIDRs()
+}
@@ -0,0 +1,90 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func cidrList(t *testing.T, list string) (cidrs []IPCidr) {
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+		cidr, err := parseIPCidr(s)
+		if err != nil {
+			t.Fatalf("Unable to parse %q: %v", s, err)
+		}
+		cidrs = append(cidrs, *cidr)
+	}
+	return
+}
+
+func TestCIDRSet(t *testing.T) {
+	tests := []struct {
+		a, b                          string
+		union, subtract, intersection string
+	}{
+		{"", "", "", "", ""},
+		{"10.0.0.0/8", "", "10.0.0.0/8", "10.0.0.0/8", ""},
+		{"10.0.0.1/8", "10.0.0.0/24", "10.0.0.0/8", "10.0.1.0/24, 10.0.2.0/23, 10.0.4.0/22, 10.0.8.0/21, 10.0.16.0/20, 10.0.32.0/19, 10.0.64.0/18, 10.0.128.0/17, 10.1.0.0/16, 10.2.0.0/15, 10.4.0.0/14, 10.8.0.0/13, 10.16.0.0/12, 10.32.0.0/11, 10.64.0.0/10, 10.128.0.0/9", "10.0.0.0/24"},
+		{"0.0.0.0/1", "128.0.0.0/1", "0.0.0.0/0", "0.0.0.0/1", ""},
+		{"10.0.0.0/25, 10.0.0.128/25, 10.0.1.0/24", "10.0.0.64/26", "10.0.0.0/23", "10.0.0.0/26, 10.0.0.128/25, 10.0.1.0/24", "10.0.0.64/26"},
+		{"192.168.1.1, 192.168.1.2", "192.168.1.3/32", "192.168.1.1/32, 192.168.1.2/31", "192.168.1.1/32, 192.168.1.2/32", ""},
+		{"255.255.255.255/32", "255.255.255.254/32", "255.255.255.254/31", "255.255.255.255/32", ""},
+		{"fd00::/64, 10.0.0.0/8", "fd00::/8", "10.0.0.0/8, fd00::/8", "10.0.0.0/8", "fd00::/64"},
+		{"::/0", "::/1, 8000::/2", "::/0", "c000::/2", "::/1, 8000::/2"},
+		{"::ffff:ffff:ffff:ffff/128", "::ffff:ffff:ffff:fffe/127", "::ffff:ffff:ffff:fffe/127", "", "::ffff:ffff:ffff:ffff/128"},
+		{"1.2.3.4/0", "0.0.0.0/0", "0.0.0.0/0", "", "0.0.0.0/0"},
+	}
+	for _, test := range tests {
+		a, b := NewCIDRSet(cidrList(t, test.a)...), NewCIDRSet(cidrList(t, test.b)...)
+		equal(t, ipcidrStrings(cidrList(t, test.union)), ipcidrStrings(a.Union(b).CIDRs()))
+		equal(t, ipcidrStrings(cidrList(t, test.subtract)), ipcidrStrings(a.Subtract(b).CIDRs()))
+		equal(t, ipcidrStrings(cidrList(t, test.intersection)), ipcidrStrings(a.Intersect(b).CIDRs()))
+		equal(t, true, a.Union(b).Equal(b.Union(a)))
+		equal(t, true, a.Intersect(b).Equal(b.Intersect(a)))
+		equal(t, true, a.Subtract(b).Union(a.Intersect(b)).Equal(a))
+	}
+}
+
+func TestCIDRSetContains(t *testing.T) {
+	s := NewCIDRSet(cidrList(t, "10.0.0.0/8, fd00::/64")...)
+	equal(t, true, s.Contains(net.IPv4(10, 1, 2, 3)))
+	equal(t, false, s.Contains(net.IPv4(11, 0, 0, 0)))
+	equal(t, true, s.Contains(net.ParseIP("fd00::1")))
+	equal(t, false, s.Contains(net.ParseIP("fd00:0:0:1::1")))
+	equal(t, false, s.Contains(nil))
+	equal(t, true, NewCIDRSet().IsEmpty())
+}
+
+func TestNormalizeCIDRs(t *testing.T) {
+	equal(t, []string{"10.0.0.0/23", "10.0.3.0/24", "fd00::/63"}, ipcidrStrings(NormalizeCIDRs(cidrList(t, "fd00:0:0:1::/64, 10.0.3.7/24, 10.0.1.0/24, fd00::/64, 10.0.0.0/24, 10.0.1.128/25"))))
+}
+
+func TestAllowedIPsExcluding(t *testing.T) {
+	equal(t, []string{"0.0.0.0/0", "::/0"}, ipcidrStrings(AllowedIPsExcluding()))
+	equal(t, []string{
+		"0.0.0.0/1", "128.0.0.0/2", "192.0.0.0/9", "192.128.0.0/11", "192.160.0.0/13", "192.168.1.0/24",
+		"192.168.2.0/23", "192.168.4.0/22", "192.168.8.0/21", "192.168.16.0/20", "192.168.32.0/19",
+		"192.168.64.0/18", "192.168.128.0/17", "192.169.0.0/16", "192.170.0.0/15", "192.172.0.0/14",
+		"192.176.0.0/12", "192.192.0.0/10", "193.0.0.0/8", "194.0.0.0/7", "196.0.0.0/6", "200.0.0.0/5",
+		"208.0.0.0/4", "224.0.0.0/3", "::/0",
+	}, ipcidrStrings(AllowedIPsExcluding(cidrList(t, "192.168.0.0/24")...)))
+
+	excluded := cidrList(t, "10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16, fe80::/10")
+	allowed := NewCIDRSet(AllowedIPsExcluding(excluded...)...)
+	for _, ip := range []string{"8.8.8.8", "172.32.0.1", "2001:db8::1", "fec0::1"} {
+		equal(t, true, allowed.Contains(net.ParseIP(ip)))
+	}
+	for _, ip := range []string{"10.1.2.3", "172.16.0.1", "192.168.255.255", "fe80::1"} {
+		equal(t, false, allowed.Contains(net.ParseIP(ip)))
+	}
+	equal(t, true, allowed.Union(NewCIDRSet(excluded...)).Equal(NewCIDRSet(AllowedIPsExcluding()...)))
+}
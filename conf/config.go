@@ -12,6 +12,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,34 +31,47 @@ type Endpoint struct {
 	Port uint16
 }
 
+// Table selects where routes for allowed IPs are installed. The zero value is "auto".
+type Table struct {
+	Off bool
+	ID  uint32
+}
+
 type Key [KeyLength]byte
 type HandshakeTime time.Duration
 type Bytes uint64
 
 type Config struct {
-	Name      string
-	Interface Interface
-	Peers     []Peer
+	Name      string    `json:"name"`
+	Interface Interface `json:"interface"`
+	Peers     []Peer    `json:"peers"`
 }
 
 type Interface struct {
-	PrivateKey Key
-	Addresses  []IPCidr
-	ListenPort uint16
-	MTU        uint16
-	DNS        []net.IP
+	PrivateKey Key      `json:"privateKey"`
+	Addresses  []IPCidr `json:"addresses"`
+	ListenPort uint16   `json:"listenPort,omitempty"`
+	MTU        uint16   `json:"mtu,omitempty"`
+	FwMark     uint32   `json:"fwMark,omitempty"`
+	DNS        []net.IP `json:"dns,omitempty"`
+	DNSSearch  []string `json:"dnsSearch,omitempty"`
+	Table      Table    `json:"table"`
+	PreUp      []string `json:"preUp,omitempty"`
+	PostUp     []string `json:"postUp,omitempty"`
+	PreDown    []string `json:"preDown,omitempty"`
+	PostDown   []string `json:"postDown,omitempty"`
 }
 
 type Peer struct {
-	PublicKey           Key
-	PresharedKey        Key
-	AllowedIPs          []IPCidr
-	Endpoint            Endpoint
-	PersistentKeepalive uint16
+	PublicKey           Key      `json:"publicKey"`
+	PresharedKey        Key      `json:"presharedKey"`
+	AllowedIPs          []IPCidr `json:"allowedIPs"`
+	Endpoint            Endpoint `json:"endpoint"`
+	PersistentKeepalive uint16   `json:"persistentKeepalive,omitempty"`
 
-	RxBytes           Bytes
-	TxBytes           Bytes
-	LastHandshakeTime HandshakeTime
+	RxBytes           Bytes         `json:"rxBytes,omitempty"`
+	TxBytes           Bytes         `json:"txBytes,omitempty"`
+	LastHandshakeTime HandshakeTime `json:"lastHandshakeTime,omitempty"`
 }
 
 func (r *IPCidr) String() string {
@@ -89,6 +103,19 @@ func (e *Endpoint) IsEmpty() bool {
 	return len(e.Host) == 0
 }
 
+func (t *Table) IsAuto() bool {
+	return !t.Off && t.ID == 0
+}
+
+func (t *Table) String() string {
+	if t.Off {
+		return "off"
+	} else if t.ID == 0 {
+		return "auto"
+	}
+	return strconv.FormatUint(uint64(t.ID), 10)
+}
+
 func (k *Key) String() string {
 	return base64.StdEncoding.EncodeToString(k[:])
 }
@@ -0,0 +1,184 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A FieldChange names a key the way it is written in wg-quick files, and holds its old and new values
+// in that same form.
+type FieldChange struct {
+	Key string
+	Old []string
+	New []string
+}
+
+type PeerDiff struct {
+	PublicKey Key
+	Old       Peer
+	New       Peer
+	Changes   []FieldChange
+}
+
+// A Diff describes how to go from one configuration to another. Peers are matched by public key.
+type Diff struct {
+	Interface    []FieldChange
+	AddedPeers   []Peer
+	RemovedPeers []Peer
+	ChangedPeers []PeerDiff
+}
+
+func diffFields(keys []string, oldValues, newValues func(key string) []string) (changes []FieldChange) {
+	for _, key := range keys {
+		o, n := oldValues(key), newValues(key)
+		if !sameValues(o, n) {
+			changes = append(changes, FieldChange{key, o, n})
+		}
+	}
+	return
+}
+
+func DiffConfigs(old, new *Config) *Diff {
+	diff := &Diff{
+		Interface: diffFields(interfaceKeys, old.Interface.wgQuickValues, new.Interface.wgQuickValues),
+	}
+	oldPeers := make(map[Key]*Peer, len(old.Peers))
+	for i := range old.Peers {
+		if _, ok := oldPeers[old.Peers[i].PublicKey]; !ok {
+			oldPeers[old.Peers[i].PublicKey] = &old.Peers[i]
+		}
+	}
+	newPeers := make(map[Key]bool, len(new.Peers))
+	for i := range new.Peers {
+		peer := &new.Peers[i]
+		if newPeers[peer.PublicKey] {
+			continue
+		}
+		newPeers[peer.PublicKey] = true
+		oldPeer, ok := oldPeers[peer.PublicKey]
+		if !ok {
+			diff.AddedPeers = append(diff.AddedPeers, *peer)
+			continue
+		}
+		changes := diffFields(peerKeys, oldPeer.wgQuickValues, peer.wgQuickValues)
+		if len(changes) > 0 {
+			diff.ChangedPeers = append(diff.ChangedPeers, PeerDiff{peer.PublicKey, *oldPeer, *peer, changes})
+		}
+	}
+	for i := range old.Peers {
+		if !newPeers[old.Peers[i].PublicKey] {
+			newPeers[old.Peers[i].PublicKey] = true
+			diff.RemovedPeers = append(diff.RemovedPeers, old.Peers[i])
+		}
+	}
+	return diff
+}
+
+func (diff *Diff) IsEmpty() bool {
+	return len(diff.Interface) == 0 && len(diff.AddedPeers) == 0 && len(diff.RemovedPeers) == 0 && len(diff.ChangedPeers) == 0
+}
+
+// InterfaceChanged reports whether any of the given wg-quick keys of the interface changed.
+func (diff *Diff) InterfaceChanged(keys ...string) bool {
+	for _, change := range diff.Interface {
+		for _, key := range keys {
+			if strings.EqualFold(change.Key, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writeUAPIEndpoint(output *strings.Builder, endpoint *Endpoint) error {
+	resolvedIP, err := hostnameResolver(endpoint.Host)
+	if err != nil {
+		return err
+	}
+	resolvedEndpoint := Endpoint{resolvedIP, endpoint.Port}
+	output.WriteString(fmt.Sprintf("endpoint=%s\n", resolvedEndpoint.String()))
+	return nil
+}
+
+// ToUAPI returns a set operation that applies only the changes in diff, without replacing peers, so
+// that peers which did not change keep their sessions. Keys that have no meaning to UAPI, such as
+// Address or DNS, are ignored. Since UAPI cannot unset an endpoint, a removed endpoint is left as is.
+func (diff *Diff) ToUAPI() (uapi string, err error) {
+	var output strings.Builder
+	var iface Interface
+	for _, change := range diff.Interface {
+		if len(change.New) == 0 {
+			change.New = []string{"0"}
+		}
+		switch change.Key {
+		case "PrivateKey":
+			err = parseInterfaceKey(&iface, change.Key, change.New[0])
+			if err != nil {
+				return "", err
+			}
+			output.WriteString(fmt.Sprintf("private_key=%s\n", iface.PrivateKey.HexString()))
+		case "ListenPort":
+			output.WriteString(fmt.Sprintf("listen_port=%s\n", change.New[0]))
+		case "FwMark":
+			err = parseInterfaceKey(&iface, change.Key, change.New[0])
+			if err != nil {
+				return "", err
+			}
+			output.WriteString(fmt.Sprintf("fwmark=%d\n", iface.FwMark))
+		}
+	}
+
+	for _, peer := range diff.RemovedPeers {
+		output.WriteString(fmt.Sprintf("public_key=%s\n", peer.PublicKey.HexString()))
+		output.WriteString("remove=true\n")
+	}
+
+	for _, peer := range diff.AddedPeers {
+		output.WriteString(fmt.Sprintf("public_key=%s\n", peer.PublicKey.HexString()))
+		if !peer.PresharedKey.IsZero() {
+			output.WriteString(fmt.Sprintf("preshared_key=%s\n", peer.PresharedKey.HexString()))
+		}
+		if !peer.Endpoint.IsEmpty() {
+			err = writeUAPIEndpoint(&output, &peer.Endpoint)
+			if err != nil {
+				return "", err
+			}
+		}
+		output.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", peer.PersistentKeepalive))
+		for _, address := range peer.AllowedIPs {
+			output.WriteString(fmt.Sprintf("allowed_ip=%s\n", address.String()))
+		}
+	}
+
+	for _, peerDiff := range diff.ChangedPeers {
+		output.WriteString(fmt.Sprintf("public_key=%s\n", peerDiff.PublicKey.HexString()))
+		output.WriteString("update_only=true\n")
+		peer := &peerDiff.New
+		for _, change := range peerDiff.Changes {
+			switch change.Key {
+			case "PresharedKey":
+				output.WriteString(fmt.Sprintf("preshared_key=%s\n", peer.PresharedKey.HexString()))
+			case "Endpoint":
+				if !peer.Endpoint.IsEmpty() {
+					err = writeUAPIEndpoint(&output, &peer.Endpoint)
+					if err != nil {
+						return "", err
+					}
+				}
+			case "PersistentKeepalive":
+				output.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", peer.PersistentKeepalive))
+			case "AllowedIPs":
+				output.WriteString("replace_allowed_ips=true\n")
+				for _, address := range peer.AllowedIPs {
+					output.WriteString(fmt.Sprintf("allowed_ip=%s\n", address.String()))
+				}
+			}
+		}
+	}
+	return output.String(), nil
+}
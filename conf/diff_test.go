@@ -0,0 +1,113 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"testing"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	old, err := FromWgQuick(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+Address = 10.0.0.1/24
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.0.2/32
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+Endpoint = 192.95.5.67:1234
+AllowedIPs = 10.0.0.3/32
+
+[Peer]
+PublicKey = gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=
+AllowedIPs = 10.0.0.4/32
+`, "test")
+	if !noError(t, err) {
+		return
+	}
+	new, err := FromWgQuick(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.0.0.1/16
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.0.2/32
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+Endpoint = demo.wireguard.com:1234
+AllowedIPs = 10.0.0.3/32, 10.0.1.0/24
+PersistentKeepalive = 25
+
+[Peer]
+PublicKey = HIgo9xNzJMWLKASShiTqIybxZ0U3wGLiUeJ1PKf8ykw=
+AllowedIPs = 10.0.0.5/32
+`, "test")
+	if !noError(t, err) {
+		return
+	}
+
+	if !DiffConfigs(old, old).IsEmpty() {
+		t.Error("Diff of a configuration with itself is not empty")
+	}
+
+	diff := DiffConfigs(old, new)
+	equal(t, []FieldChange{
+		{"ListenPort", []string{"51820"}, nil},
+		{"Address", []string{"10.0.0.1/24"}, []string{"10.0.0.1/16"}},
+	}, diff.Interface)
+	equal(t, true, diff.InterfaceChanged("address"))
+	equal(t, false, diff.InterfaceChanged("DNS", "MTU"))
+	if lenTest(t, diff.AddedPeers, 1) {
+		equal(t, new.Peers[2].PublicKey, diff.AddedPeers[0].PublicKey)
+	}
+	if lenTest(t, diff.RemovedPeers, 1) {
+		equal(t, old.Peers[2].PublicKey, diff.RemovedPeers[0].PublicKey)
+	}
+	if lenTest(t, diff.ChangedPeers, 1) {
+		equal(t, new.Peers[1].PublicKey, diff.ChangedPeers[0].PublicKey)
+		equal(t, []FieldChange{
+			{"AllowedIPs", []string{"10.0.0.3/32"}, []string{"10.0.0.3/32, 10.0.1.0/24"}},
+			{"Endpoint", []string{"192.95.5.67:1234"}, []string{"demo.wireguard.com:1234"}},
+			{"PersistentKeepalive", nil, []string{"25"}},
+		}, diff.ChangedPeers[0].Changes)
+	}
+
+	defer func(resolver func(string) (string, error)) { hostnameResolver = resolver }(hostnameResolver)
+	hostnameResolver = func(name string) (string, error) {
+		if name != "demo.wireguard.com" {
+			t.Errorf("Resolved unexpected host %s", name)
+		}
+		return "192.95.5.68", nil
+	}
+	uapi, err := diff.ToUAPI()
+	if noError(t, err) {
+		equal(t, `listen_port=0
+public_key=80deb906420acb578213da4fd7075cf11394b641cb1763df02a61dc98073e840
+remove=true
+public_key=1c8828f7137324c58b2804928624ea2326f1674537c062e251e2753ca7fcca4c
+persistent_keepalive_interval=0
+allowed_ip=10.0.0.5/32
+public_key=4eb32f4a83f88d842563a448cc181bb2c42a637bf12363e2fb2ef594e5965d7d
+update_only=true
+replace_allowed_ips=true
+allowed_ip=10.0.0.3/32
+allowed_ip=10.0.1.0/24
+endpoint=192.95.5.68:1234
+persistent_keepalive_interval=25
+`, uapi)
+	}
+}
+
+func TestDiffToUAPIInvalidKey(t *testing.T) {
+	diff := &Diff{Interface: []FieldChange{{"PrivateKey", nil, []string{"nonsense"}}}}
+	if _, err := diff.ToUAPI(); err == nil {
+		t.Error("Invalid private key in diff was not reported")
+	}
+}
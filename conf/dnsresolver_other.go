@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"net"
+)
+
+// resolveHostname prefers IPv4 addresses, as the resolver of Windows does.
+func resolveHostname(name string) (resolvedIPString string, err error) {
+	ips, err := net.LookupIP(name)
+	if err != nil {
+		return
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.String(), nil
+		}
+	}
+	return ips[0].String(), nil
+}
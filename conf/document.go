@@ -0,0 +1,434 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"errors"
+	"strings"
+)
+
+// A Document is a wg-quick configuration that remembers its exact text, so that comments, blank
+// lines, key order, and formatting survive being edited and saved again.
+type Document struct {
+	Name  string
+	Lines []DocumentLine
+}
+
+type DocumentLineType int
+
+const (
+	BlankLine DocumentLineType = iota
+	CommentLine
+	SectionLine
+	KeyLine
+	ToleratedLine
+)
+
+// Keys that wg-quick on other platforms understands, but that have no meaning here. They are kept in
+// the document, but never handed to the parser.
+var toleratedKeys = map[string]bool{
+	"saveconfig": true,
+}
+
+// A DocumentLine is split such that Prefix+Value+Suffix is the original line. For key lines, Prefix is
+// everything up to and including the whitespace after the equals sign, and Suffix is any trailing
+// whitespace and comment. For every other line, the whole text is in Prefix.
+type DocumentLine struct {
+	Type   DocumentLineType
+	Key    string
+	Prefix string
+	Value  string
+	Suffix string
+
+	deleted bool
+}
+
+func (line *DocumentLine) String() string {
+	return line.Prefix + line.Value + line.Suffix
+}
+
+func parseDocumentLine(text string) DocumentLine {
+	content := text
+	pound := strings.IndexByte(content, '#')
+	if pound >= 0 {
+		content = content[:pound]
+	}
+	trimmed := strings.TrimSpace(content)
+	if len(trimmed) == 0 {
+		if pound >= 0 {
+			return DocumentLine{Type: CommentLine, Prefix: text}
+		}
+		return DocumentLine{Type: BlankLine, Prefix: text}
+	}
+	switch strings.ToLower(trimmed) {
+	case "[interface]":
+		return DocumentLine{Type: SectionLine, Key: "interface", Prefix: text}
+	case "[peer]":
+		return DocumentLine{Type: SectionLine, Key: "peer", Prefix: text}
+	}
+	equals := strings.IndexByte(content, '=')
+	if equals < 0 {
+		return DocumentLine{Type: KeyLine, Prefix: text}
+	}
+	key := strings.ToLower(strings.TrimSpace(content[:equals]))
+	lineType := KeyLine
+	if toleratedKeys[key] {
+		lineType = ToleratedLine
+	}
+	value := strings.TrimSpace(content[equals+1:])
+	if len(value) == 0 {
+		return DocumentLine{Type: lineType, Key: key, Prefix: text}
+	}
+	start := equals + 1 + strings.Index(content[equals+1:], value)
+	end := start + len(value)
+	return DocumentLine{Type: lineType, Key: key, Prefix: text[:start], Value: value, Suffix: text[end:]}
+}
+
+// ParseDocument splits s into lines and makes sure that it describes a valid configuration.
+func ParseDocument(s string, name string) (*Document, error) {
+	doc := &Document{Name: name}
+	for _, line := range strings.Split(s, "\n") {
+		doc.Lines = append(doc.Lines, parseDocumentLine(line))
+	}
+	_, err := doc.Config()
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (doc *Document) String() string {
+	lines := make([]string, len(doc.Lines))
+	for i := range doc.Lines {
+		lines[i] = doc.Lines[i].String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (doc *Document) Config() (*Config, error) {
+	var text strings.Builder
+	for i := range doc.Lines {
+		if doc.Lines[i].Type == ToleratedLine {
+			text.WriteByte('\n')
+			continue
+		}
+		text.WriteString(doc.Lines[i].String())
+		text.WriteByte('\n')
+	}
+	return FromWgQuick(text.String(), doc.Name)
+}
+
+type documentBlock struct {
+	lines []DocumentLine
+	peer  int
+}
+
+// blocks splits the document into a preamble followed by one block per section. A section starts at
+// its header, or at the comments directly above it, and runs until the start of the next section.
+func (doc *Document) blocks() []*documentBlock {
+	starts := make([]int, 0, 4)
+	for i := range doc.Lines {
+		if doc.Lines[i].Type != SectionLine {
+			continue
+		}
+		start := i
+		for start > 0 && doc.Lines[start-1].Type == CommentLine && (len(starts) == 0 || start-1 > starts[len(starts)-1]) {
+			start--
+		}
+		starts = append(starts, start)
+	}
+	blocks := make([]*documentBlock, 0, len(starts)+1)
+	blocks = append(blocks, &documentBlock{peer: NoSection})
+	if len(starts) == 0 {
+		blocks[0].lines = append(blocks[0].lines, doc.Lines...)
+		return blocks
+	}
+	blocks[0].lines = append(blocks[0].lines, doc.Lines[:starts[0]]...)
+	peers := 0
+	for i, start := range starts {
+		end := len(doc.Lines)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		block := &documentBlock{lines: append([]DocumentLine(nil), doc.Lines[start:end]...), peer: InterfaceSection}
+		if block.lines[block.header()].Key == "peer" {
+			block.peer = peers
+			peers++
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func (doc *Document) setBlocks(blocks []*documentBlock) {
+	doc.Lines = doc.Lines[:0]
+	for _, block := range blocks {
+		for _, line := range block.lines {
+			if !line.deleted {
+				doc.Lines = append(doc.Lines, line)
+			}
+		}
+	}
+}
+
+func (block *documentBlock) header() int {
+	for i := range block.lines {
+		if block.lines[i].Type == SectionLine {
+			return i
+		}
+	}
+	return -1
+}
+
+func (block *documentBlock) insertionPoint() int {
+	point := block.header() + 1
+	for i := point; i < len(block.lines); i++ {
+		if block.lines[i].Type == KeyLine || block.lines[i].Type == ToleratedLine {
+			point = i + 1
+		}
+	}
+	return point
+}
+
+func (doc *Document) lineEnding() string {
+	if len(doc.Lines) > 0 && strings.HasSuffix(doc.Lines[0].String(), "\r") {
+		return "\r"
+	}
+	return ""
+}
+
+type documentLineRef struct {
+	block *documentBlock
+	index int
+}
+
+func keyLineRefs(blocks []*documentBlock, key string) (refs []documentLineRef) {
+	lowerKey := strings.ToLower(key)
+	for _, block := range blocks {
+		for i := range block.lines {
+			if block.lines[i].Type == KeyLine && block.lines[i].Key == lowerKey && !block.lines[i].deleted {
+				refs = append(refs, documentLineRef{block, i})
+			}
+		}
+	}
+	return
+}
+
+// setValues rewrites the lines of key within blocks to hold values, reusing the existing lines in
+// order, so that their surrounding formatting and trailing comments stay intact.
+func (doc *Document) setValues(blocks []*documentBlock, key string, values []string) {
+	refs := keyLineRefs(blocks, key)
+	for i, ref := range refs {
+		if i < len(values) {
+			ref.block.lines[ref.index].Value = values[i]
+		} else {
+			ref.block.lines[ref.index].deleted = true
+		}
+	}
+	if len(values) <= len(refs) {
+		return
+	}
+	block, point := blocks[0], blocks[0].insertionPoint()
+	if len(refs) > 0 {
+		block, point = refs[len(refs)-1].block, refs[len(refs)-1].index+1
+	}
+	added := make([]DocumentLine, 0, len(values)-len(refs))
+	for _, value := range values[len(refs):] {
+		added = append(added, DocumentLine{Type: KeyLine, Key: strings.ToLower(key), Prefix: key + " = ", Value: value, Suffix: doc.lineEnding()})
+	}
+	block.lines = append(block.lines[:point], append(added, block.lines[point:]...)...)
+}
+
+func canonicalInterfaceValues(blocks []*documentBlock, key string) []string {
+	var iface Interface
+	for _, ref := range keyLineRefs(blocks, key) {
+		if parseInterfaceKey(&iface, ref.block.lines[ref.index].Key, ref.block.lines[ref.index].Value) != nil {
+			return nil
+		}
+	}
+	return iface.wgQuickValues(key)
+}
+
+func canonicalPeerValues(block *documentBlock, key string) []string {
+	var peer Peer
+	for _, ref := range keyLineRefs([]*documentBlock{block}, key) {
+		if parsePeerKey(&peer, ref.block.lines[ref.index].Key, ref.block.lines[ref.index].Value) != nil {
+			return nil
+		}
+	}
+	return peer.wgQuickValues(key)
+}
+
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (doc *Document) applyInterface(blocks []*documentBlock, iface *Interface) {
+	for _, key := range interfaceKeys {
+		values := iface.wgQuickValues(key)
+		if !sameValues(canonicalInterfaceValues(blocks, key), values) {
+			doc.setValues(blocks, key, values)
+		}
+	}
+}
+
+func (doc *Document) applyPeer(block *documentBlock, peer *Peer) {
+	for _, key := range peerKeys {
+		values := peer.wgQuickValues(key)
+		if !sameValues(canonicalPeerValues(block, key), values) {
+			doc.setValues([]*documentBlock{block}, key, values)
+		}
+	}
+}
+
+// Apply changes the document to describe config, touching only the lines of keys whose values differ.
+// Peers are matched by public key: removed peers lose their whole section, including the comments
+// directly above it, and new peers are appended at the end. If the edited document would not describe
+// config exactly, an error is returned and the document is left unchanged.
+func (doc *Document) Apply(config *Config) error {
+	originalName, originalLines := doc.Name, append([]DocumentLine(nil), doc.Lines...)
+	doc.Name = config.Name
+	blocks := doc.blocks()
+
+	var interfaceSections []*documentBlock
+	for _, block := range blocks {
+		if block.peer == InterfaceSection {
+			interfaceSections = append(interfaceSections, block)
+		}
+	}
+	if len(interfaceSections) == 0 {
+		block := &documentBlock{lines: []DocumentLine{{Type: SectionLine, Key: "interface", Prefix: "[Interface]" + doc.lineEnding()}}, peer: InterfaceSection}
+		blocks = append([]*documentBlock{blocks[0], block}, blocks[1:]...)
+		interfaceSections = append(interfaceSections, block)
+	}
+	doc.applyInterface(interfaceSections, &config.Interface)
+
+	matched := make([]bool, len(config.Peers))
+	kept := blocks[:0]
+	for _, block := range blocks {
+		if block.peer < 0 {
+			kept = append(kept, block)
+			continue
+		}
+		var publicKey *Key
+		for _, ref := range keyLineRefs([]*documentBlock{block}, "PublicKey") {
+			publicKey, _ = parseKeyBase64(ref.block.lines[ref.index].Value)
+		}
+		found := -1
+		for i := range config.Peers {
+			if !matched[i] && publicKey != nil && config.Peers[i].PublicKey == *publicKey {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			continue
+		}
+		matched[found] = true
+		doc.applyPeer(block, &config.Peers[found])
+		kept = append(kept, block)
+	}
+	blocks = kept
+
+	var trailer []DocumentLine
+	last := blocks[len(blocks)-1]
+	if n := len(last.lines); n > 0 && last.lines[n-1].Type == BlankLine && len(last.lines[n-1].Prefix) == 0 {
+		trailer = last.lines[n-1:]
+		last.lines = last.lines[:n-1]
+	}
+	for i := range config.Peers {
+		if matched[i] {
+			continue
+		}
+		block := &documentBlock{peer: len(blocks)}
+		last := blocks[len(blocks)-1]
+		if n := len(last.lines); n > 0 && last.lines[n-1].Type != BlankLine {
+			block.lines = append(block.lines, DocumentLine{Type: BlankLine, Prefix: doc.lineEnding()})
+		}
+		block.lines = append(block.lines, DocumentLine{Type: SectionLine, Key: "peer", Prefix: "[Peer]" + doc.lineEnding()})
+		doc.applyPeer(block, &config.Peers[i])
+		blocks = append(blocks, block)
+	}
+	if trailer != nil {
+		last := blocks[len(blocks)-1]
+		last.lines = append(last.lines, trailer...)
+	}
+	doc.setBlocks(blocks)
+
+	applied, err := doc.Config()
+	if err == nil && applied.ToWgQuick() != config.ToWgQuick() {
+		err = errors.New("Unable to apply configuration to document without changing its meaning")
+	}
+	if err != nil {
+		doc.Name, doc.Lines = originalName, originalLines
+		return err
+	}
+	return nil
+}
+
+func canonicalKey(keys []string, key string) (string, bool) {
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// SetInterfaceValues replaces the values of key in the [Interface] section, one line per value. An
+// empty list of values removes the key. The document is left unchanged if the result would not parse.
+func (doc *Document) SetInterfaceValues(key string, values []string) error {
+	canonical, ok := canonicalKey(interfaceKeys, key)
+	if !ok {
+		return &ParseError{why: "Invalid key for [Interface] section", offender: key, Code: ParseErrorInvalidKey, Section: InterfaceSection, Key: key}
+	}
+	var interfaceSections []*documentBlock
+	blocks := doc.blocks()
+	for _, block := range blocks {
+		if block.peer == InterfaceSection {
+			interfaceSections = append(interfaceSections, block)
+		}
+	}
+	return doc.trySetValues(blocks, interfaceSections, canonical, values)
+}
+
+// SetPeerValues is like SetInterfaceValues, but for the nth [Peer] section.
+func (doc *Document) SetPeerValues(peer int, key string, values []string) error {
+	canonical, ok := canonicalKey(peerKeys, key)
+	if !ok {
+		return &ParseError{why: "Invalid key for [Peer] section", offender: key, Code: ParseErrorInvalidKey, Section: peer, Key: key}
+	}
+	blocks := doc.blocks()
+	for _, block := range blocks {
+		if block.peer == peer {
+			return doc.trySetValues(blocks, []*documentBlock{block}, canonical, values)
+		}
+	}
+	return &ParseError{why: "Peer does not exist", offender: "[Peer]", Code: ParseErrorNotInSection, Section: peer}
+}
+
+func (doc *Document) trySetValues(blocks []*documentBlock, target []*documentBlock, key string, values []string) error {
+	if len(target) == 0 {
+		return &ParseError{why: "Missing section", offender: key, Code: ParseErrorNotInSection, Section: NoSection, Key: key}
+	}
+	original := append([]DocumentLine(nil), doc.Lines...)
+	doc.setValues(target, key, values)
+	doc.setBlocks(blocks)
+	_, err := doc.Config()
+	if err != nil {
+		doc.Lines = original
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDocument = `# Office tunnel
+[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/24   # primary
+SaveConfig = true
+
+# Gateway
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 0.0.0.0/0
+
+# Backup gateway
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+Endpoint = 192.95.5.67:1234
+`
+
+func TestDocumentRoundTrip(t *testing.T) {
+	inputs := []struct {
+		text  string
+		peers int
+	}{
+		{testDocument, 2},
+		{testInput, 3},
+		{strings.ReplaceAll(testDocument, "\n", "\r\n"), 2},
+	}
+	for _, input := range inputs {
+		doc, err := ParseDocument(input.text, "test")
+		if !noError(t, err) {
+			continue
+		}
+		equal(t, input.text, doc.String())
+		conf, err := doc.Config()
+		if noError(t, err) {
+			lenTest(t, conf.Peers, input.peers)
+		}
+	}
+
+	_, err := ParseDocument("[Interface]\nNotAKey = 1\n", "test")
+	if err == nil {
+		t.Error("Invalid key was accepted")
+	}
+}
+
+func TestDocumentApply(t *testing.T) {
+	doc, err := ParseDocument(testDocument, "test")
+	if !noError(t, err) {
+		return
+	}
+	conf, err := doc.Config()
+	if !noError(t, err) {
+		return
+	}
+
+	noError(t, doc.Apply(conf))
+	equal(t, testDocument, doc.String())
+
+	conf.Interface.Addresses[0].Cidr = 16
+	conf.Interface.MTU = 1420
+	conf.Peers = conf.Peers[1:]
+	newPeer, _ := parseKeyBase64("gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=")
+	conf.Peers = append(conf.Peers, Peer{PublicKey: *newPeer})
+	noError(t, doc.Apply(conf))
+	equal(t, `# Office tunnel
+[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/16   # primary
+SaveConfig = true
+MTU = 1420
+
+# Backup gateway
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+Endpoint = 192.95.5.67:1234
+
+[Peer]
+PublicKey = gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=
+`, doc.String())
+
+	applied, err := doc.Config()
+	if noError(t, err) {
+		equal(t, conf.ToWgQuick(), applied.ToWgQuick())
+	}
+}
+
+func TestDocumentSetValues(t *testing.T) {
+	doc, err := ParseDocument(testDocument, "test")
+	if !noError(t, err) {
+		return
+	}
+	noError(t, doc.SetInterfaceValues("dns", []string{"1.1.1.1"}))
+	noError(t, doc.SetPeerValues(1, "Endpoint", nil))
+	noError(t, doc.SetPeerValues(0, "PersistentKeepalive", []string{"25"}))
+	if doc.SetInterfaceValues("MTU", []string{"banana"}) == nil {
+		t.Error("Invalid value was accepted")
+	}
+	if doc.SetPeerValues(2, "Endpoint", []string{"1.2.3.4:5"}) == nil {
+		t.Error("Nonexistent peer was accepted")
+	}
+	equal(t, `# Office tunnel
+[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/24   # primary
+SaveConfig = true
+DNS = 1.1.1.1
+
+# Gateway
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 0.0.0.0/0
+PersistentKeepalive = 25
+
+# Backup gateway
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+`, doc.String())
+}
@@ -0,0 +1,231 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// An Encryptor protects stored configurations at rest. The name of the tunnel is bound to what it
+// encrypts, so that a file renamed behind the store's back fails to decrypt, rather than quietly
+// becoming another tunnel.
+type Encryptor interface {
+	Encrypt(data []byte, name string) ([]byte, error)
+	Decrypt(data []byte, name string) ([]byte, error)
+}
+
+var storeEncryptor Encryptor
+
+// SetStoreEncryptor replaces the encryptor of the default store, which is DPAPI on Windows. Elsewhere
+// there is none, so the default store cannot be opened until one is set. Setting nil goes back to the
+// default. Once the default store has been opened, its files are encrypted with what was set, so it
+// can no longer be changed.
+func SetStoreEncryptor(encryptor Encryptor) error {
+	defaultStoreLock.Lock()
+	defer defaultStoreLock.Unlock()
+	if defaultStore != nil {
+		return errors.New("The encryptor of the default store cannot be changed once it has been opened")
+	}
+	storeEncryptor = encryptor
+	return nil
+}
+
+// defaultStoreEncryptor must be called with defaultStoreLock held.
+func defaultStoreEncryptor() (Encryptor, error) {
+	if storeEncryptor != nil {
+		return storeEncryptor, nil
+	}
+	return defaultEncryptor()
+}
+
+var errNoEncryptor = errors.New("No encryptor has been set for stored configurations")
+
+// Files written by a PortableEncryptor start with this header, which holds what is needed to derive
+// the key again, and which is authenticated along with the tunnel name:
+//
+//	magic        [4]byte  "WGce"
+//	version      uint8    1
+//	time         uint32   Argon2id passes
+//	memory       uint32   Argon2id memory, in KiB
+//	threads      uint8    Argon2id parallelism
+//	salt         [16]byte
+//	nonce        [24]byte XChaCha20-Poly1305 nonce
+//
+// The integers are big endian, and the sealed configuration follows.
+const (
+	portableMagic      = "WGce"
+	portableVersion    = 1
+	portableSaltLen    = 16
+	portableHeaderLen  = 4 + 1 + 4 + 4 + 1 + portableSaltLen + chacha20poly1305.NonceSizeX
+	portableKeyfileLen = 32
+	portableCachedKeys = 16
+)
+
+type portableKeyParams struct {
+	salt    [portableSaltLen]byte
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// A PortableEncryptor encrypts with XChaCha20-Poly1305, under a key derived with Argon2id from a
+// passphrase or the contents of a keyfile, and a random salt. As deriving keys from passphrases is
+// slow on purpose, everything an encryptor writes shares one salt, and keys are kept once derived.
+// Files are still told apart by their random nonces.
+type PortableEncryptor struct {
+	secret  []byte
+	time    uint32
+	memory  uint32
+	threads uint8
+
+	lock    sync.Mutex
+	salt    [portableSaltLen]byte
+	hasSalt bool
+	keys    map[portableKeyParams][]byte
+}
+
+// NewPassphraseEncryptor derives keys with the second recommended set of parameters of RFC 9106,
+// which is slow enough to make guessing a passphrase expensive.
+func NewPassphraseEncryptor(passphrase []byte) *PortableEncryptor {
+	return &PortableEncryptor{
+		secret:  append([]byte(nil), passphrase...),
+		time:    3,
+		memory:  64 * 1024,
+		threads: 4,
+	}
+}
+
+// NewKeyfileEncryptor reads a key from path, first writing a random one there, readable only by its
+// owner, if the file does not exist. A random key needs no stretching, so its derivation is cheap.
+func NewKeyfileEncryptor(path string) (*PortableEncryptor, error) {
+	secret, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		secret = make([]byte, portableKeyfileLen)
+		_, err = rand.Read(secret)
+		if err != nil {
+			return nil, err
+		}
+		var f *os.File
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.Write(secret)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if len(secret) < portableKeyfileLen {
+		return nil, errors.New("Keyfile is too short")
+	}
+	return &PortableEncryptor{
+		secret:  secret,
+		time:    1,
+		memory:  64,
+		threads: 1,
+	}, nil
+}
+
+func (e *PortableEncryptor) key(params *portableKeyParams) []byte {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if key, ok := e.keys[*params]; ok {
+		return key
+	}
+	key := argon2.IDKey(e.secret, params.salt[:], params.time, params.memory, params.threads, chacha20poly1305.KeySize)
+	if e.keys == nil || len(e.keys) >= portableCachedKeys {
+		e.keys = make(map[portableKeyParams][]byte)
+	}
+	e.keys[*params] = key
+	return key
+}
+
+func (e *PortableEncryptor) writeParams() (*portableKeyParams, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if !e.hasSalt {
+		_, err := rand.Read(e.salt[:])
+		if err != nil {
+			return nil, err
+		}
+		e.hasSalt = true
+	}
+	return &portableKeyParams{e.salt, e.time, e.memory, e.threads}, nil
+}
+
+func portableAdditionalData(header []byte, name string) []byte {
+	return append(append([]byte(nil), header...), name...)
+}
+
+func (e *PortableEncryptor) Encrypt(data []byte, name string) ([]byte, error) {
+	params, err := e.writeParams()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, portableHeaderLen)
+	copy(header, portableMagic)
+	header[4] = portableVersion
+	binary.BigEndian.PutUint32(header[5:], params.time)
+	binary.BigEndian.PutUint32(header[9:], params.memory)
+	header[13] = params.threads
+	copy(header[14:], params.salt[:])
+	nonce := header[14+portableSaltLen:]
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(e.key(params))
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, data, portableAdditionalData(header, name)), nil
+}
+
+func (e *PortableEncryptor) Decrypt(data []byte, name string) ([]byte, error) {
+	if len(data) < portableHeaderLen || !bytes.Equal(data[:4], []byte(portableMagic)) {
+		return nil, errors.New("Encrypted data does not have a valid header")
+	}
+	if data[4] != portableVersion {
+		return nil, errors.New("Encrypted data has an unsupported version")
+	}
+	header := data[:portableHeaderLen]
+	params := &portableKeyParams{
+		time:    binary.BigEndian.Uint32(header[5:]),
+		memory:  binary.BigEndian.Uint32(header[9:]),
+		threads: header[13],
+	}
+	copy(params.salt[:], header[14:])
+	// Anything costlier to derive than what this encryptor writes itself is not of its making, and
+	// deriving it anyway would let a planted file stall whatever reads it.
+	if params.time == 0 || params.time > e.time || params.memory > e.memory || params.threads == 0 || params.threads > e.threads || params.memory < 8*uint32(params.threads) {
+		return nil, errors.New("Encrypted data has invalid key derivation parameters")
+	}
+	nonce := header[14+portableSaltLen:]
+	aead, err := chacha20poly1305.NewX(e.key(params))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, data[portableHeaderLen:], portableAdditionalData(header, name))
+	if err != nil {
+		return nil, errors.New("Unable to decrypt data, because the key or name is wrong, or it was tampered with")
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"errors"
+)
+
+func defaultEncryptor() (Encryptor, error) {
+	return nil, errors.New("There is no default encryptor for stored configurations on this platform, so one must be set")
+}
@@ -0,0 +1,120 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testEncryptor(t *testing.T, e Encryptor, other Encryptor) {
+	original := []byte("The quick brown fox jumped over the lazy dog")
+	encrypted, err := e.Encrypt(original, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	if bytes.Contains(encrypted, original) {
+		t.Error("Encrypted data contains the original data")
+	}
+	again, err := e.Encrypt(original, "golangTest")
+	if noError(t, err) && bytes.Equal(encrypted, again) {
+		t.Error("Encrypting twice gave the same data")
+	}
+
+	decrypted, err := e.Decrypt(encrypted, "golangTest")
+	if noError(t, err) {
+		equal(t, original, decrypted)
+	}
+	if _, err = e.Decrypt(encrypted, "otherName"); err == nil {
+		t.Error("Decryption failed to notice name mismatch")
+	}
+	if _, err = other.Decrypt(encrypted, "golangTest"); err == nil {
+		t.Error("Decryption failed to notice key mismatch")
+	}
+	for _, i := range []int{0, 4, 6, 15, portableHeaderLen - 1, len(encrypted) - 1} {
+		tampered := append([]byte(nil), encrypted...)
+		tampered[i] ^= 1
+		if _, err = e.Decrypt(tampered, "golangTest"); err == nil {
+			t.Errorf("Decryption failed to notice tampering with byte %d", i)
+		}
+	}
+	if _, err = e.Decrypt(encrypted[:portableHeaderLen-1], "golangTest"); err == nil {
+		t.Error("Decryption failed to notice truncation")
+	}
+}
+
+func TestPassphraseEncryptor(t *testing.T) {
+	testEncryptor(t, NewPassphraseEncryptor([]byte("correct horse battery staple")), NewPassphraseEncryptor([]byte("incorrect horse battery staple")))
+}
+
+func TestPassphraseEncryptorKeys(t *testing.T) {
+	e := NewPassphraseEncryptor([]byte("correct horse battery staple"))
+	first, err := e.Encrypt([]byte("first"), "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	second, err := e.Encrypt([]byte("second"), "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	for _, encrypted := range [][]byte{first, second} {
+		_, err = e.Decrypt(encrypted, "golangTest")
+		noError(t, err)
+	}
+	equal(t, 1, len(e.keys))
+
+	cheap := &PortableEncryptor{secret: e.secret, time: 1, memory: 64, threads: 1}
+	if _, err = cheap.Decrypt(first, "golangTest"); err == nil {
+		t.Error("Decryption accepted parameters costlier than its own")
+	}
+	equal(t, 0, len(cheap.keys))
+}
+
+func TestKeyfileEncryptor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wgtest-keyfile")
+	if !noError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keyfile")
+	e, err := NewKeyfileEncryptor(path)
+	if !noError(t, err) {
+		return
+	}
+	info, err := os.Stat(path)
+	if noError(t, err) {
+		equal(t, int64(portableKeyfileLen), info.Size())
+	}
+	other, err := NewKeyfileEncryptor(filepath.Join(dir, "other"))
+	if !noError(t, err) {
+		return
+	}
+	testEncryptor(t, e, other)
+
+	encrypted, err := e.Encrypt([]byte("data"), "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	reloaded, err := NewKeyfileEncryptor(path)
+	if !noError(t, err) {
+		return
+	}
+	decrypted, err := reloaded.Decrypt(encrypted, "golangTest")
+	if noError(t, err) {
+		equal(t, []byte("data"), decrypted)
+	}
+
+	err = ioutil.WriteFile(path, []byte("short"), 0600)
+	if noError(t, err) {
+		if _, err = NewKeyfileEncryptor(path); err == nil {
+			t.Error("Short keyfile was accepted")
+		}
+	}
+}
@@ -0,0 +1,26 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"golang.zx2c4.com/wireguard/windows/conf/dpapi"
+)
+
+// DPAPIEncryptor encrypts for the user that the process runs as, which for the manager service is
+// LocalSystem.
+type DPAPIEncryptor struct{}
+
+func (DPAPIEncryptor) Encrypt(data []byte, name string) ([]byte, error) {
+	return dpapi.Encrypt(data, name)
+}
+
+func (DPAPIEncryptor) Decrypt(data []byte, name string) ([]byte, error) {
+	return dpapi.Decrypt(data, name)
+}
+
+func defaultEncryptor() (Encryptor, error) {
+	return DPAPIEncryptor{}, nil
+}
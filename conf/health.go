@@ -0,0 +1,223 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type FileHealth int
+
+const (
+	FileOK FileHealth = iota
+	FileUnreadable
+	FileUndecryptable
+	FileUnparsable
+	FileBadName
+	FileStrayTemp
+	FileOrphanedMetadata
+)
+
+func (h FileHealth) String() string {
+	switch h {
+	case FileOK:
+		return "ok"
+	case FileUnreadable:
+		return "unreadable"
+	case FileUndecryptable:
+		return "undecryptable"
+	case FileUnparsable:
+		return "unparsable"
+	case FileBadName:
+		return "bad name"
+	case FileStrayTemp:
+		return "stray temporary file"
+	case FileOrphanedMetadata:
+		return "metadata without a tunnel"
+	}
+	return "unknown"
+}
+
+// A FileReport says what is wrong with File, a file in a store's directory, if anything. Name is the
+// tunnel it would be, if it has a valid name. Error is a string, so that reports can be sent over IPC.
+type FileReport struct {
+	File          string
+	Name          string
+	Health        FileHealth
+	Error         string
+	QuarantinedAs string
+}
+
+const quarantineDirectory = "Quarantine"
+
+// Temporary files younger than this are taken to still be in the middle of being written.
+const strayTempAge = time.Minute
+
+func (store *FileStore) checkFile(file os.FileInfo) (report FileReport, ok bool) {
+	report.File = file.Name()
+	fail := func(health FileHealth, err error) (FileReport, bool) {
+		report.Health = health
+		if err != nil {
+			report.Error = err.Error()
+		}
+		return report, true
+	}
+	if strings.HasSuffix(report.File, ".tmp") {
+		if time.Since(file.ModTime()) < strayTempAge {
+			return report, false
+		}
+		return fail(FileStrayTemp, nil)
+	}
+	if strings.HasSuffix(report.File, metadataFileSuffix) {
+		return store.checkMetadataFile(report)
+	}
+	encrypted := strings.HasSuffix(report.File, configFileSuffix)
+	name, err := NameFromPath(report.File)
+	if err != nil {
+		return fail(FileBadName, err)
+	}
+	report.Name = name
+	bytes, err := ioutil.ReadFile(filepath.Join(store.dir, report.File))
+	if err != nil {
+		return fail(FileUnreadable, err)
+	}
+	if encrypted {
+		bytes, err = store.encryptor.Decrypt(bytes, name)
+		if err != nil {
+			return fail(FileUndecryptable, err)
+		}
+	}
+	doc, err := ParseDocument(string(bytes), name)
+	if err == nil {
+		_, err = doc.Config()
+	}
+	if err != nil {
+		return fail(FileUnparsable, err)
+	}
+	return report, true
+}
+
+func (store *FileStore) checkMetadataFile(report FileReport) (FileReport, bool) {
+	fail := func(health FileHealth, err error) (FileReport, bool) {
+		report.Health = health
+		if err != nil {
+			report.Error = err.Error()
+		}
+		return report, true
+	}
+	name, ok := metadataNameOfFile(report.File)
+	if !ok {
+		return fail(FileBadName, errors.New("Tunnel name is not valid"))
+	}
+	report.Name = name
+	configPath, _ := store.Path(name)
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return fail(FileOrphanedMetadata, nil)
+	}
+	bytes, err := ioutil.ReadFile(filepath.Join(store.dir, report.File))
+	if err != nil {
+		return fail(FileUnreadable, err)
+	}
+	bytes, err = store.encryptor.Decrypt(bytes, metadataEncryptionName(name))
+	if err != nil {
+		return fail(FileUndecryptable, err)
+	}
+	_, err = MetadataFromJSON(string(bytes))
+	if err != nil {
+		return fail(FileUnparsable, err)
+	}
+	return report, true
+}
+
+// Scan checks every file in the directory of store, including the unencrypted ones waiting to be
+// migrated, and reports on each of them. Subdirectories, such as those of history, are skipped.
+// Without an encryptor, nothing can be told about the encrypted files, so that is an error.
+func (store *FileStore) Scan() ([]FileReport, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.scan()
+}
+
+func (store *FileStore) scan() ([]FileReport, error) {
+	if store.encryptor == nil {
+		return nil, errNoEncryptor
+	}
+	files, err := ioutil.ReadDir(store.dir)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]FileReport, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if report, ok := store.checkFile(file); ok {
+			reports = append(reports, report)
+		}
+	}
+	return reports, nil
+}
+
+// Quarantine moves the files of every report that is not ok into the quarantine subdirectory, where
+// they are kept for inspection but no longer listed, and returns those reports, saying where they went.
+func (store *FileStore) Quarantine(reports []FileReport) ([]FileReport, error) {
+	store.lock.Lock()
+	moved, err := store.quarantine(reports)
+	store.lock.Unlock()
+	if len(moved) > 0 {
+		store.rescan()
+	}
+	return moved, err
+}
+
+func (store *FileStore) quarantine(reports []FileReport) ([]FileReport, error) {
+	dir := filepath.Join(store.dir, quarantineDirectory)
+	var moved []FileReport
+	for _, report := range reports {
+		if report.Health == FileOK {
+			continue
+		}
+		if report.File != filepath.Base(report.File) {
+			return moved, fmt.Errorf("File ‘%s’ is not in the store", report.File)
+		}
+		err := os.MkdirAll(dir, os.ModeDir|0700)
+		if err != nil {
+			return moved, err
+		}
+		// Prefixing the time keeps files of the same name, quarantined at different times, apart.
+		report.QuarantinedAs = filepath.Join(quarantineDirectory, time.Now().UTC().Format(revisionIDLayout)+"-"+report.File)
+		err = os.Rename(filepath.Join(store.dir, report.File), filepath.Join(store.dir, report.QuarantinedAs))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return moved, err
+		}
+		moved = append(moved, report)
+	}
+	return moved, nil
+}
+
+// QuarantineBroken scans the store and quarantines whatever is broken, with nothing else changing the
+// store in between.
+func (store *FileStore) QuarantineBroken() ([]FileReport, error) {
+	store.lock.Lock()
+	reports, err := store.scan()
+	var moved []FileReport
+	if err == nil {
+		moved, err = store.quarantine(reports)
+	}
+	store.lock.Unlock()
+	if len(moved) > 0 {
+		store.rescan()
+	}
+	return moved, err
+}
@@ -0,0 +1,106 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFileStoreScan(t *testing.T) {
+	store, cleanup := newTestFileStore(t)
+	if store == nil {
+		return
+	}
+	defer cleanup()
+
+	doc, err := ParseDocument(testInput, "good")
+	if !noError(t, err) || !noError(t, store.Save(doc)) {
+		return
+	}
+	unparsable, err := store.encryptor.Encrypt([]byte("[Interface]\nPrivateKey = nonsense\n"), "unparsable")
+	if !noError(t, err) {
+		return
+	}
+	old := time.Now().Add(-strayTempAge * 2)
+	files := map[string][]byte{
+		"undecryptable" + configFileSuffix:  []byte("garbage"),
+		"unparsable" + configFileSuffix:     unparsable,
+		"bad name" + configFileSuffix:       []byte("garbage"),
+		"readme.txt":                        []byte("garbage"),
+		"plain.conf":                        []byte(testInput),
+		"stray" + configFileSuffix + ".tmp": []byte("garbage"),
+		"fresh" + configFileSuffix + ".tmp": []byte("garbage"),
+	}
+	for file, contents := range files {
+		if !noError(t, ioutil.WriteFile(filepath.Join(store.Directory(), file), contents, 0600)) {
+			return
+		}
+	}
+	noError(t, os.Chtimes(filepath.Join(store.Directory(), "stray"+configFileSuffix+".tmp"), old, old))
+
+	reports, err := store.Scan()
+	if !noError(t, err) {
+		return
+	}
+	health := make(map[string]FileHealth, len(reports))
+	for _, report := range reports {
+		health[report.File] = report.Health
+		if (report.Health == FileOK || report.Health == FileStrayTemp) != (len(report.Error) == 0) {
+			t.Errorf("Report of %s has health %s but error ‘%s’", report.File, report.Health, report.Error)
+		}
+	}
+	equal(t, map[string]FileHealth{
+		"good" + configFileSuffix:           FileOK,
+		"undecryptable" + configFileSuffix:  FileUndecryptable,
+		"unparsable" + configFileSuffix:     FileUnparsable,
+		"bad name" + configFileSuffix:       FileBadName,
+		"readme.txt":                        FileBadName,
+		"plain.conf":                        FileOK,
+		"stray" + configFileSuffix + ".tmp": FileStrayTemp,
+	}, health)
+
+	moved, err := store.QuarantineBroken()
+	if !noError(t, err) {
+		return
+	}
+	equal(t, 5, len(moved))
+	for _, report := range moved {
+		if _, err = os.Stat(filepath.Join(store.Directory(), report.QuarantinedAs)); err != nil {
+			t.Errorf("Quarantined file %s is not at %s: %v", report.File, report.QuarantinedAs, err)
+		}
+	}
+
+	reports, err = store.Scan()
+	if noError(t, err) {
+		var left []string
+		for _, report := range reports {
+			left = append(left, report.File)
+			equal(t, FileOK, report.Health)
+		}
+		sort.Strings(left)
+		equal(t, []string{"good" + configFileSuffix, "plain.conf"}, left)
+	}
+	names, err := store.List()
+	if noError(t, err) {
+		equal(t, []string{"good"}, names)
+	}
+
+	store.encryptor = nil
+	if _, err = store.Scan(); err == nil {
+		t.Error("Scanning without an encryptor succeeded")
+	}
+	if _, err = store.QuarantineBroken(); err == nil {
+		t.Error("Quarantining without an encryptor succeeded")
+	}
+	if _, err = os.Stat(filepath.Join(store.Directory(), "good"+configFileSuffix)); err != nil {
+		t.Errorf("Quarantining without an encryptor moved files: %v", err)
+	}
+}
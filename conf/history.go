@@ -0,0 +1,259 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxRevisions is how many revisions are kept of each tunnel, the oldest being dropped first.
+const MaxRevisions = 20
+
+// A Revision is a version of a tunnel's configuration, as it was saved at Time. The newest revision is
+// the one that is stored now.
+type Revision struct {
+	ID   string
+	Time time.Time
+}
+
+const revisionIDLayout = "20060102T150405.000000000Z"
+const historyDirectory = "History"
+
+func revisionID(t time.Time) string {
+	return t.UTC().Format(revisionIDLayout)
+}
+
+func sortRevisions(revisions []Revision) {
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].ID > revisions[j].ID
+	})
+}
+
+// DiffRevisions describes how to go from the revision oldID of a tunnel to the revision newID.
+func DiffRevisions(store ConfigStore, name string, oldID string, newID string) (*Diff, error) {
+	var configs [2]*Config
+	for i, id := range []string{oldID, newID} {
+		doc, err := store.LoadRevision(name, id)
+		if err != nil {
+			return nil, err
+		}
+		configs[i], err = doc.Config()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return DiffConfigs(configs[0], configs[1]), nil
+}
+
+// RestoreRevision saves the revision id of a tunnel as its configuration, which makes it the newest
+// revision, so that the restore can itself be undone.
+func RestoreRevision(store ConfigStore, name string, id string) (*Document, error) {
+	doc, err := store.LoadRevision(name, id)
+	if err != nil {
+		return nil, err
+	}
+	return doc, store.Save(doc)
+}
+
+func (store *FileStore) historyPath(name string) (string, error) {
+	if !TunnelNameIsValid(name) {
+		return "", errors.New("Tunnel name is not valid")
+	}
+	return filepath.Join(store.dir, historyDirectory, name), nil
+}
+
+func (store *FileStore) Revisions(name string) ([]Revision, error) {
+	dir, err := store.historyPath(name)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	revisions := make([]Revision, 0, len(files))
+	for _, file := range files {
+		if !file.Mode().IsRegular() || !strings.HasSuffix(file.Name(), configFileSuffix) {
+			continue
+		}
+		id := strings.TrimSuffix(file.Name(), configFileSuffix)
+		t, err := time.Parse(revisionIDLayout, id)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, Revision{id, t})
+	}
+	sortRevisions(revisions)
+	return revisions, nil
+}
+
+func (store *FileStore) revisionPath(name string, id string) (string, error) {
+	dir, err := store.historyPath(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err = time.Parse(revisionIDLayout, id); err != nil {
+		return "", errors.New("Revision is not valid")
+	}
+	return filepath.Join(dir, id+configFileSuffix), nil
+}
+
+func (store *FileStore) readRevision(name string, id string) (string, error) {
+	path, err := store.revisionPath(name, id)
+	if err != nil {
+		return "", err
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if store.encryptor == nil {
+		return "", errNoEncryptor
+	}
+	bytes, err = store.encryptor.Decrypt(bytes, name)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+func (store *FileStore) LoadRevision(name string, id string) (*Document, error) {
+	text, err := store.readRevision(name, id)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDocument(text, name)
+}
+
+func (store *FileStore) writeRevision(name string, t time.Time, text string) error {
+	dir, err := store.historyPath(name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, os.ModeDir|0700)
+	if err != nil {
+		return err
+	}
+	if store.encryptor == nil {
+		return errNoEncryptor
+	}
+	bytes, err := store.encryptor.Encrypt([]byte(text), name)
+	if err != nil {
+		return err
+	}
+	for {
+		path := filepath.Join(dir, revisionID(t)+configFileSuffix)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			// Clocks can be coarse, so two saves may well happen at the same time.
+			t = t.Add(time.Nanosecond)
+			continue
+		} else if err != nil {
+			return err
+		}
+		_, err = f.Write(bytes)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+		return err
+	}
+}
+
+// seedHistory gives a tunnel that was stored before there was any history its stored configuration as
+// its first revision, unless that is text, which is about to be saved, so that the first save can be
+// undone too.
+func (store *FileStore) seedHistory(name string, text string) error {
+	revisions, err := store.Revisions(name)
+	if err != nil || len(revisions) > 0 {
+		return err
+	}
+	doc, err := store.Load(name)
+	if err != nil || doc.String() == text {
+		return nil
+	}
+	path, _ := store.Path(name)
+	t := time.Now()
+	if info, err := os.Stat(path); err == nil && info.ModTime().Before(t) {
+		t = info.ModTime()
+	}
+	return store.writeRevision(name, t, doc.String())
+}
+
+// recordRevision adds text, which has just been stored, to the history of name, unless it is what was
+// saved last.
+func (store *FileStore) recordRevision(name string, text string) error {
+	revisions, err := store.Revisions(name)
+	if err != nil {
+		return err
+	}
+	if len(revisions) > 0 {
+		last, err := store.readRevision(name, revisions[0].ID)
+		if err == nil && last == text {
+			return nil
+		}
+	}
+	t := time.Now()
+	if len(revisions) > 0 && !t.After(revisions[0].Time) {
+		t = revisions[0].Time.Add(time.Nanosecond)
+	}
+	err = store.writeRevision(name, t, text)
+	if err != nil {
+		return err
+	}
+
+	revisions, err = store.Revisions(name)
+	if err != nil {
+		return err
+	}
+	for i := MaxRevisions; i < len(revisions); i++ {
+		path, _ := store.revisionPath(name, revisions[i].ID)
+		os.Remove(path)
+	}
+	return nil
+}
+
+func (store *FileStore) deleteHistory(name string) error {
+	dir, err := store.historyPath(name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// copyHistory encrypts every revision of oldName again under newName.
+func (store *FileStore) copyHistory(oldName string, newName string) error {
+	revisions, err := store.Revisions(oldName)
+	if err != nil {
+		return err
+	}
+	err = store.deleteHistory(newName)
+	if err != nil {
+		return err
+	}
+	for _, revision := range revisions {
+		text, err := store.readRevision(oldName, revision.ID)
+		if err != nil {
+			continue
+		}
+		err = store.writeRevision(newName, revision.Time, text)
+		if err != nil {
+			store.deleteHistory(newName)
+			return err
+		}
+	}
+	return nil
+}
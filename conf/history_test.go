@@ -0,0 +1,163 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func saveWithListenPort(t *testing.T, store ConfigStore, name string, port uint16) bool {
+	c, err := FromWgQuick(testInput, name)
+	if !noError(t, err) {
+		return false
+	}
+	c.Interface.ListenPort = port
+	return noError(t, SaveConfig(store, c))
+}
+
+func revisionListenPort(t *testing.T, store ConfigStore, name string, id string) uint16 {
+	doc, err := store.LoadRevision(name, id)
+	if !noError(t, err) {
+		return 0
+	}
+	c, err := doc.Config()
+	if !noError(t, err) {
+		return 0
+	}
+	return c.Interface.ListenPort
+}
+
+func testStoreHistory(t *testing.T, store ConfigStore) {
+	for port := uint16(1); port <= 3; port++ {
+		if !saveWithListenPort(t, store, "golangTest", port) {
+			return
+		}
+	}
+	if !saveWithListenPort(t, store, "golangTest", 3) {
+		return
+	}
+	revisions, err := store.Revisions("golangTest")
+	if !noError(t, err) || !equal(t, 3, len(revisions)) {
+		return
+	}
+	for i := 1; i < len(revisions); i++ {
+		if !revisions[i-1].Time.After(revisions[i].Time) {
+			t.Errorf("Revisions are not newest first: %v", revisions)
+		}
+	}
+	equal(t, uint16(3), revisionListenPort(t, store, "golangTest", revisions[0].ID))
+	equal(t, uint16(1), revisionListenPort(t, store, "golangTest", revisions[2].ID))
+	if _, err = store.LoadRevision("golangTest", "nonsense"); err == nil {
+		t.Error("Loading a missing revision succeeded")
+	}
+
+	diff, err := DiffRevisions(store, "golangTest", revisions[2].ID, revisions[0].ID)
+	if noError(t, err) {
+		equal(t, []FieldChange{{"ListenPort", []string{"1"}, []string{"3"}}}, diff.Interface)
+	}
+
+	_, err = RestoreRevision(store, "golangTest", revisions[2].ID)
+	if !noError(t, err) {
+		return
+	}
+	c, err := LoadConfig(store, "golangTest")
+	if noError(t, err) {
+		equal(t, uint16(1), c.Interface.ListenPort)
+	}
+	revisions, err = store.Revisions("golangTest")
+	if noError(t, err) && equal(t, 4, len(revisions)) {
+		equal(t, uint16(1), revisionListenPort(t, store, "golangTest", revisions[0].ID))
+	}
+
+	for port := uint16(100); port < 100+MaxRevisions; port++ {
+		if !saveWithListenPort(t, store, "golangTest", port) {
+			return
+		}
+	}
+	revisions, err = store.Revisions("golangTest")
+	if noError(t, err) && equal(t, MaxRevisions, len(revisions)) {
+		equal(t, uint16(100+MaxRevisions-1), revisionListenPort(t, store, "golangTest", revisions[0].ID))
+		equal(t, uint16(100), revisionListenPort(t, store, "golangTest", revisions[MaxRevisions-1].ID))
+	}
+
+	noError(t, store.Rename("golangTest", "renamed"))
+	renamed, err := store.Revisions("renamed")
+	if noError(t, err) && equal(t, len(revisions), len(renamed)) {
+		equal(t, revisions[0].ID, renamed[0].ID)
+		equal(t, uint16(100), revisionListenPort(t, store, "renamed", renamed[MaxRevisions-1].ID))
+	}
+	revisions, err = store.Revisions("golangTest")
+	if noError(t, err) {
+		equal(t, 0, len(revisions))
+	}
+
+	noError(t, store.Delete("renamed"))
+	revisions, err = store.Revisions("renamed")
+	if noError(t, err) {
+		equal(t, 0, len(revisions))
+	}
+}
+
+func TestFileStoreHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wgtest-history")
+	if !noError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	e, err := NewKeyfileEncryptor(filepath.Join(dir, "keyfile"))
+	if !noError(t, err) {
+		return
+	}
+	store, err := NewFileStore(filepath.Join(dir, "Configurations"), e)
+	if !noError(t, err) {
+		return
+	}
+	testStoreHistory(t, store)
+
+	// A tunnel stored before there was any history keeps what it was before its first save.
+	c, err := FromWgQuick(testInput, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	c.Interface.ListenPort = 1
+	noError(t, store.writeFile("golangTest", c.ToWgQuick()))
+	if !saveWithListenPort(t, store, "golangTest", 2) {
+		return
+	}
+	revisions, err := store.Revisions("golangTest")
+	if noError(t, err) && equal(t, 2, len(revisions)) {
+		equal(t, uint16(2), revisionListenPort(t, store, "golangTest", revisions[0].ID))
+		equal(t, uint16(1), revisionListenPort(t, store, "golangTest", revisions[1].ID))
+	}
+
+	// A save that fails leaves no revision behind.
+	path, _ := store.Path("broken")
+	if !noError(t, os.MkdirAll(filepath.Join(path, "in the way"), os.ModeDir|0700)) {
+		return
+	}
+	c.Name = "broken"
+	if err = SaveConfig(store, c); err == nil {
+		t.Error("Saving over a directory succeeded")
+	}
+	broken, err := store.Revisions("broken")
+	if noError(t, err) {
+		equal(t, 0, len(broken))
+	}
+
+	unencrypted, err := NewFileStore(filepath.Join(dir, "Configurations"), nil)
+	if noError(t, err) && len(revisions) > 0 {
+		if _, err = unencrypted.LoadRevision("golangTest", revisions[0].ID); err == nil {
+			t.Error("Loading a revision without an encryptor succeeded")
+		}
+	}
+}
+
+func TestMemoryStoreHistory(t *testing.T) {
+	testStoreHistory(t, NewMemoryStore())
+}
@@ -0,0 +1,116 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type iniKey struct {
+	Line   int
+	Text   string
+	Column int
+	Key    string
+	Value  string
+}
+
+type iniSection struct {
+	Line int
+	Name string
+	Keys []iniKey
+}
+
+// parseINI splits the unit files of systemd and the key files of GLib into sections. Both have comments
+// only on lines of their own, starting with '#', or for systemd also ';'. Only systemd joins lines that
+// end in a backslash to the next one.
+func parseINI(s string, continuations bool) ([]iniSection, error) {
+	var sections []iniSection
+	lines := strings.Split(s, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		text := strings.TrimRight(lines[i], "\r")
+		line := strings.TrimSpace(text)
+		if len(line) == 0 || line[0] == '#' || (continuations && line[0] == ';') {
+			continue
+		}
+		indent := len(text) - len(strings.TrimLeftFunc(text, unicode.IsSpace))
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, (&ParseError{why: "Invalid section header", offender: line, Code: ParseErrorInvalidKey}).at(lineNumber, text, indent, NoSection, "")
+			}
+			sections = append(sections, iniSection{Line: lineNumber, Name: strings.TrimSpace(line[1 : len(line)-1])})
+			continue
+		}
+		if len(sections) == 0 {
+			return nil, (&ParseError{why: "Line must occur in a section", offender: line, Code: ParseErrorNotInSection}).at(lineNumber, text, indent, NoSection, "")
+		}
+		equals := strings.IndexByte(text, '=')
+		if equals < 0 {
+			return nil, (&ParseError{why: "Invalid config key is missing an equals separator", offender: line, Code: ParseErrorMissingEquals}).at(lineNumber, text, indent, NoSection, "")
+		}
+		value := strings.TrimSpace(text[equals+1:])
+		for continuations && strings.HasSuffix(value, "\\") && i+1 < len(lines) {
+			i++
+			value = strings.TrimSpace(value[:len(value)-1] + " " + strings.TrimSpace(strings.TrimRight(lines[i], "\r")))
+		}
+		section := &sections[len(sections)-1]
+		section.Keys = append(section.Keys, iniKey{
+			Line:   lineNumber,
+			Text:   text,
+			Column: equals + 1,
+			Key:    strings.TrimSpace(text[:equals]),
+			Value:  value,
+		})
+	}
+	return sections, nil
+}
+
+func (k *iniKey) error(err error) *ParseError {
+	return toParseError(err, k.Value).at(k.Line, k.Text, k.Column, NoSection, k.Key)
+}
+
+// An UnsupportedSetting is a setting of an imported profile that has no equivalent in a Config, and so
+// was left out of it.
+type UnsupportedSetting struct {
+	Line    int
+	Section string
+	Key     string
+	Value   string
+}
+
+func (s *UnsupportedSetting) String() string {
+	return fmt.Sprintf("Line %d: [%s] %s = %s", s.Line, s.Section, s.Key, s.Value)
+}
+
+func unsupportedSetting(section *iniSection, key *iniKey) UnsupportedSetting {
+	return UnsupportedSetting{Line: key.Line, Section: section.Name, Key: key.Key, Value: key.Value}
+}
+
+func unsupportedSection(section *iniSection) []UnsupportedSetting {
+	settings := make([]UnsupportedSetting, 0, len(section.Keys))
+	for i := range section.Keys {
+		settings = append(settings, unsupportedSetting(section, &section.Keys[i]))
+	}
+	return settings
+}
+
+// checkImported applies the checks of FromWgQuick that the importers cannot make while parsing.
+func checkImported(config *Config) error {
+	if !TunnelNameIsValid(config.Name) {
+		return &ParseError{why: "Tunnel name is not valid", offender: config.Name, Code: ParseErrorInvalidName, Section: NoSection}
+	}
+	if config.Interface.PrivateKey.IsZero() {
+		return &ParseError{why: "An interface must have a private key", offender: "[none specified]", Code: ParseErrorMissingPrivateKey, Section: InterfaceSection}
+	}
+	for i, peer := range config.Peers {
+		if peer.PublicKey.IsZero() {
+			return &ParseError{why: "All peers must have public keys", offender: "[none specified]", Code: ParseErrorMissingPublicKey, Section: i}
+		}
+	}
+	return nil
+}
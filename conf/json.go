@@ -0,0 +1,161 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+// A Config marshals to JSON like this, with fields that hold their zero value left out where noted by
+// omitempty in the struct tags:
+//
+//	{
+//	  "name": "office",
+//	  "interface": {
+//	    "privateKey": "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=",
+//	    "addresses": ["10.192.122.1/24", "fd00::1/64"],
+//	    "listenPort": 51820,
+//	    "dns": ["1.1.1.1"],
+//	    "dnsSearch": ["example.com"],
+//	    "table": "auto"
+//	  },
+//	  "peers": [{
+//	    "publicKey": "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=",
+//	    "presharedKey": "",
+//	    "allowedIPs": ["0.0.0.0/0", "::/0"],
+//	    "endpoint": "demo.wireguard.com:51820",
+//	    "persistentKeepalive": 25,
+//	    "rxBytes": 1024,
+//	    "txBytes": 2048,
+//	    "lastHandshakeTime": "2019-06-01T12:00:00.5Z"
+//	  }]
+//	}
+//
+// Keys are base64, and the all-zero key is the empty string. Addresses, allowed IPs, and endpoints are
+// in the same form as in wg-quick files, the table is "auto", "off", or a number as a string, and
+// handshake times are RFC 3339 timestamps in UTC. The same text forms are used by encoding.TextMarshaler,
+// and so also by gob.
+
+func (k Key) MarshalText() ([]byte, error) {
+	if k.IsZero() {
+		return []byte{}, nil
+	}
+	return []byte(base64.StdEncoding.EncodeToString(k[:])), nil
+}
+
+func (k *Key) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*k = Key{}
+		return nil
+	}
+	key, err := parseKeyBase64(string(text))
+	if err != nil {
+		return err
+	}
+	*k = *key
+	return nil
+}
+
+func (r IPCidr) MarshalText() ([]byte, error) {
+	if r.IP == nil {
+		return []byte{}, nil
+	}
+	return []byte(r.String()), nil
+}
+
+func (r *IPCidr) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*r = IPCidr{}
+		return nil
+	}
+	ipcidr, err := parseIPCidr(string(text))
+	if err != nil {
+		return err
+	}
+	*r = *ipcidr
+	return nil
+}
+
+func (e Endpoint) MarshalText() ([]byte, error) {
+	if e.IsEmpty() {
+		return []byte{}, nil
+	}
+	return []byte(e.String()), nil
+}
+
+func (e *Endpoint) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*e = Endpoint{}
+		return nil
+	}
+	endpoint, err := parseEndpoint(string(text))
+	if err != nil {
+		return err
+	}
+	*e = *endpoint
+	return nil
+}
+
+func (t Table) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *Table) UnmarshalText(text []byte) error {
+	table, err := parseTable(string(text))
+	if err != nil {
+		return err
+	}
+	*t = *table
+	return nil
+}
+
+func (t HandshakeTime) MarshalText() ([]byte, error) {
+	if t.IsEmpty() {
+		return []byte{}, nil
+	}
+	return []byte(time.Unix(0, int64(t)).UTC().Format(time.RFC3339Nano)), nil
+}
+
+func (t *HandshakeTime) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*t = HandshakeTime(0)
+		return nil
+	}
+	stamp, err := time.Parse(time.RFC3339Nano, string(text))
+	if err != nil {
+		return &ParseError{why: "Invalid handshake time", offender: string(text)}
+	}
+	*t = HandshakeTime(stamp.UnixNano())
+	return nil
+}
+
+// Bytes are numbers in JSON, but since they have a text form, encoding/json would otherwise quote them.
+
+func (b Bytes) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatUint(uint64(b), 10)), nil
+}
+
+func (b *Bytes) UnmarshalText(text []byte) error {
+	n, err := parseBytesOrStamp(string(text))
+	if err != nil {
+		return err
+	}
+	*b = Bytes(n)
+	return nil
+}
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return b.MarshalText()
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	return b.UnmarshalText(data)
+}
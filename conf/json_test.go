@@ -0,0 +1,74 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigJSON(t *testing.T) {
+	config, err := FromWgQuick(testInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	config.Peers[0].RxBytes = 1024
+	config.Peers[0].TxBytes = 2048
+	config.Peers[0].LastHandshakeTime = HandshakeTime(time.Date(2019, 6, 1, 12, 0, 0, 500000000, time.UTC).UnixNano())
+
+	out, err := json.Marshal(config)
+	if !noError(t, err) {
+		return
+	}
+	s := string(out)
+	for _, field := range []string{
+		`"privateKey":"yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="`,
+		`"addresses":["10.192.122.1/24","10.10.0.1/16"]`,
+		`"table":"auto"`,
+		`"rxBytes":1024`,
+		`"lastHandshakeTime":"2019-06-01T12:00:00.5Z"`,
+		`"presharedKey":""`,
+	} {
+		if !strings.Contains(s, field) {
+			t.Errorf("Missing %s in %s", field, s)
+		}
+	}
+	if strings.Contains(s, `"mtu"`) {
+		t.Errorf("Zero MTU should be left out: %s", s)
+	}
+
+	var decoded Config
+	err = json.Unmarshal(out, &decoded)
+	if noError(t, err) {
+		equal(t, config, &decoded)
+	}
+
+	err = json.Unmarshal([]byte(`{"peers":[{"allowedIPs":["10.0.0.1/33"]}]}`), &decoded)
+	if err == nil {
+		t.Error("Expected an error for an invalid allowed IP")
+	}
+}
+
+func TestConfigGob(t *testing.T) {
+	config, err := FromWgQuick(testInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(config)
+	if !noError(t, err) {
+		return
+	}
+	var decoded Config
+	err = gob.NewDecoder(&buf).Decode(&decoded)
+	if noError(t, err) {
+		equal(t, config, &decoded)
+	}
+}
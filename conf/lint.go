@@ -0,0 +1,203 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"fmt"
+	"net"
+)
+
+type LintSeverity int
+
+const (
+	LintWarning LintSeverity = iota
+	LintError
+)
+
+func (severity LintSeverity) String() string {
+	switch severity {
+	case LintWarning:
+		return "warning"
+	case LintError:
+		return "error"
+	}
+	return fmt.Sprintf("unknown-%d", int(severity))
+}
+
+// Lint codes are stable, so that scripts may match on them. New ones are only ever appended.
+type LintCode int
+
+const (
+	LintSyntax LintCode = iota
+	LintDuplicatePublicKey
+	LintPeerIsSelf
+	LintDuplicateAllowedIP
+	LintOverlappingAllowedIPs
+	LintUnroutedAddress
+	LintIPv6Leak
+)
+
+func (code LintCode) String() string {
+	switch code {
+	case LintSyntax:
+		return "syntax"
+	case LintDuplicatePublicKey:
+		return "duplicate-public-key"
+	case LintPeerIsSelf:
+		return "peer-is-self"
+	case LintDuplicateAllowedIP:
+		return "duplicate-allowed-ip"
+	case LintOverlappingAllowedIPs:
+		return "overlapping-allowed-ips"
+	case LintUnroutedAddress:
+		return "unrouted-address"
+	case LintIPv6Leak:
+		return "ipv6-leak"
+	}
+	return fmt.Sprintf("unknown-%d", int(code))
+}
+
+// A LintFinding is about the given section, numbered as for ParseError. Line is only known for syntax
+// errors, and is zero otherwise.
+type LintFinding struct {
+	Severity LintSeverity
+	Code     LintCode
+	Section  int
+	Line     int
+	Message  string
+}
+
+func (finding *LintFinding) String() string {
+	return fmt.Sprintf("%s: %s: %s", finding.Severity, finding.Code, finding.Message)
+}
+
+func sectionName(section int) string {
+	switch section {
+	case NoSection:
+		return "Outside of any section"
+	case InterfaceSection:
+		return "[Interface]"
+	}
+	return fmt.Sprintf("[Peer] #%d", section+1)
+}
+
+func (r *IPCidr) masked() net.IP {
+	ipnet := r.IPNet()
+	return r.IP.Mask(ipnet.Mask)
+}
+
+func (r *IPCidr) contains(other *IPCidr) bool {
+	if r.Bits() != other.Bits() || r.Cidr > other.Cidr {
+		return false
+	}
+	ipnet := r.IPNet()
+	return ipnet.Contains(other.IP)
+}
+
+func (r *IPCidr) overlaps(other *IPCidr) bool {
+	return r.contains(other) || other.contains(r)
+}
+
+func (r *IPCidr) equalNetwork(other *IPCidr) bool {
+	return r.Bits() == other.Bits() && r.Cidr == other.Cidr && r.masked().Equal(other.masked())
+}
+
+func coversDefaultRoute(allowedIPs []IPCidr, bits uint8) bool {
+	var half [2]bool
+	for i := range allowedIPs {
+		if allowedIPs[i].Bits() != bits {
+			continue
+		}
+		if allowedIPs[i].Cidr == 0 {
+			return true
+		}
+		if allowedIPs[i].Cidr == 1 {
+			half[allowedIPs[i].masked()[0]>>7] = true
+		}
+	}
+	return half[0] && half[1]
+}
+
+// Lint looks for mistakes that the parser cannot see, because each line is fine on its own.
+func (config *Config) Lint() []LintFinding {
+	var findings []LintFinding
+	add := func(severity LintSeverity, code LintCode, section int, format string, args ...interface{}) {
+		findings = append(findings, LintFinding{
+			Severity: severity,
+			Code:     code,
+			Section:  section,
+			Message:  sectionName(section) + ": " + fmt.Sprintf(format, args...),
+		})
+	}
+
+	ourPublicKey := config.Interface.PrivateKey.Public()
+	for i := range config.Peers {
+		peer := &config.Peers[i]
+		if peer.PublicKey == *ourPublicKey {
+			add(LintError, LintPeerIsSelf, i, "Public key ‘%s’ belongs to this interface", peer.PublicKey.String())
+		}
+		for j := 0; j < i; j++ {
+			if config.Peers[j].PublicKey == peer.PublicKey {
+				add(LintError, LintDuplicatePublicKey, i, "Public key ‘%s’ is also used by %s", peer.PublicKey.String(), sectionName(j))
+				break
+			}
+		}
+		for j := 0; j < i; j++ {
+			for k := range peer.AllowedIPs {
+				for l := range config.Peers[j].AllowedIPs {
+					ours, theirs := &peer.AllowedIPs[k], &config.Peers[j].AllowedIPs[l]
+					if ours.equalNetwork(theirs) {
+						add(LintError, LintDuplicateAllowedIP, i, "Allowed IP ‘%s’ is also allowed for %s, and only one of them will receive it", ours.String(), sectionName(j))
+					} else if ours.overlaps(theirs) {
+						add(LintWarning, LintOverlappingAllowedIPs, i, "Allowed IP ‘%s’ overlaps with ‘%s’ of %s", ours.String(), theirs.String(), sectionName(j))
+					}
+				}
+			}
+		}
+	}
+
+	for i := range config.Interface.Addresses {
+		address := &config.Interface.Addresses[i]
+		routed := false
+		for j := range config.Peers {
+			for k := range config.Peers[j].AllowedIPs {
+				if address.overlaps(&config.Peers[j].AllowedIPs[k]) {
+					routed = true
+				}
+			}
+		}
+		if !routed {
+			add(LintWarning, LintUnroutedAddress, InterfaceSection, "Address ‘%s’ is not covered by the allowed IPs of any peer", address.String())
+		}
+	}
+
+	var allAllowedIPs []IPCidr
+	for i := range config.Peers {
+		allAllowedIPs = append(allAllowedIPs, config.Peers[i].AllowedIPs...)
+	}
+	if coversDefaultRoute(allAllowedIPs, 32) && !coversDefaultRoute(allAllowedIPs, 128) {
+		add(LintWarning, LintIPv6Leak, NoSection, "All IPv4 traffic is tunneled, but IPv6 traffic is not, and may leak outside of the tunnel; consider adding ::/0 to the allowed IPs")
+	}
+
+	return findings
+}
+
+// LintWgQuick reports every syntax error in s, followed by the findings of Lint on whatever could be
+// parsed.
+func LintWgQuick(s string, name string) []LintFinding {
+	config, errs := FromWgQuickBestEffort(s, name)
+	findings := make([]LintFinding, 0, len(errs))
+	for _, e := range errs {
+		findings = append(findings, LintFinding{
+			Severity: LintError,
+			Code:     LintSyntax,
+			Section:  e.Section,
+			Line:     e.Line,
+			Message:  fmt.Sprintf("%s (%s)", e.Error(), e.Code),
+		})
+	}
+	return append(findings, config.Lint()...)
+}
@@ -0,0 +1,62 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"testing"
+)
+
+func lintCodes(findings []LintFinding) (codes []LintCode) {
+	for _, finding := range findings {
+		codes = append(codes, finding.Code)
+	}
+	return
+}
+
+func TestLint(t *testing.T) {
+	conf, err := FromWgQuick(testInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, []LintCode(nil), lintCodes(conf.Lint()))
+
+	conf, err = FromWgQuick(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.0.0.2/24, 172.16.0.2/24
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 0.0.0.0/1, 128.0.0.0/1
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 128.0.0.0/1
+
+[Peer]
+PublicKey = HIgo9xNzJMWLKASShiTqIybxZ0U3wGLiUeJ1PKf8ykw=
+`, "test")
+	if !noError(t, err) {
+		return
+	}
+	findings := conf.Lint()
+	equal(t, []LintCode{LintDuplicatePublicKey, LintDuplicateAllowedIP, LintPeerIsSelf, LintIPv6Leak}, lintCodes(findings))
+	equal(t, []LintSeverity{LintError, LintError, LintError, LintWarning}, []LintSeverity{findings[0].Severity, findings[1].Severity, findings[2].Severity, findings[3].Severity})
+	equal(t, 1, findings[0].Section)
+	equal(t, 2, findings[2].Section)
+
+	conf.Peers = append(conf.Peers[:1], Peer{AllowedIPs: []IPCidr{{IP: []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Cidr: 0}}})
+	conf.Interface.Addresses = append(conf.Interface.Addresses, IPCidr{IP: []byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, Cidr: 64})
+	equal(t, []LintCode(nil), lintCodes(conf.Lint()))
+
+	conf.Peers = conf.Peers[:1]
+	conf.Peers[0].AllowedIPs = []IPCidr{{IP: []byte{10, 0, 0, 0}, Cidr: 24}}
+	equal(t, []LintCode{LintUnroutedAddress, LintUnroutedAddress}, lintCodes(conf.Lint()))
+
+	findings = LintWgQuick("[Interface]\nMTU = 1\n", "test")
+	equal(t, []LintCode{LintSyntax, LintSyntax}, lintCodes(findings))
+	equal(t, 2, findings[0].Line)
+	equal(t, "error: syntax: Invalid MTU: ‘1’ (invalid-value)", findings[0].String())
+}
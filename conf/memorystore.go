@@ -0,0 +1,256 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A MemoryStore keeps configurations only for as long as the process lives, which suits tests.
+type MemoryStore struct {
+	lock      sync.Mutex
+	texts     map[string]string
+	history   map[string][]memoryRevision
+	metadata  map[string]Metadata
+	callbacks *storeCallbacks
+}
+
+type memoryRevision struct {
+	Revision
+	text string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		texts:     make(map[string]string),
+		history:   make(map[string][]memoryRevision),
+		metadata:  make(map[string]Metadata),
+		callbacks: newStoreCallbacks(),
+	}
+}
+
+func memoryStoreNotFound(name string) error {
+	return &os.PathError{Op: "load", Path: name, Err: os.ErrNotExist}
+}
+
+func (store *MemoryStore) List() ([]string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	names := make([]string, 0, len(store.texts))
+	for name := range store.texts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (store *MemoryStore) Load(name string) (*Document, error) {
+	if !TunnelNameIsValid(name) {
+		return nil, errors.New("Tunnel name is not valid")
+	}
+	store.lock.Lock()
+	text, ok := store.texts[name]
+	store.lock.Unlock()
+	if !ok {
+		return nil, memoryStoreNotFound(name)
+	}
+	return ParseDocument(text, name)
+}
+
+func (store *MemoryStore) Save(doc *Document) error {
+	err := checkDocumentForSaving(doc)
+	if err != nil {
+		return err
+	}
+	store.lock.Lock()
+	store.saveAndUnlock(doc)
+	return nil
+}
+
+func (store *MemoryStore) Create(doc *Document) error {
+	err := checkDocumentForSaving(doc)
+	if err != nil {
+		return err
+	}
+	store.lock.Lock()
+	if _, ok := store.texts[doc.Name]; ok {
+		store.lock.Unlock()
+		return tunnelExistsError(doc.Name)
+	}
+	store.saveAndUnlock(doc)
+	return nil
+}
+
+func (store *MemoryStore) Update(doc *Document, revisionToken string) error {
+	err := checkDocumentForSaving(doc)
+	if err != nil {
+		return err
+	}
+	store.lock.Lock()
+	text, ok := store.texts[doc.Name]
+	if !ok {
+		store.lock.Unlock()
+		return memoryStoreNotFound(doc.Name)
+	}
+	current, err := ParseDocument(text, doc.Name)
+	if err == nil && current.RevisionToken() != revisionToken {
+		err = revisionMismatchError(doc.Name)
+	}
+	if err != nil {
+		store.lock.Unlock()
+		return err
+	}
+	store.saveAndUnlock(doc)
+	return nil
+}
+
+func (store *MemoryStore) saveAndUnlock(doc *Document) {
+	text := doc.String()
+	event := StoreEvent{Type: StoreEventModified, Name: doc.Name}
+	if _, ok := store.texts[doc.Name]; !ok {
+		event.Type = StoreEventAdded
+	}
+	store.texts[doc.Name] = text
+	history := store.history[doc.Name]
+	if len(history) == 0 || history[0].text != text {
+		t := time.Now()
+		if len(history) > 0 && !t.After(history[0].Time) {
+			t = history[0].Time.Add(time.Nanosecond)
+		}
+		history = append([]memoryRevision{{Revision{revisionID(t), t}, text}}, history...)
+		if len(history) > MaxRevisions {
+			history = history[:MaxRevisions]
+		}
+		store.history[doc.Name] = history
+	}
+	store.notifyAndUnlock(event)
+}
+
+func (store *MemoryStore) Delete(name string) error {
+	if !TunnelNameIsValid(name) {
+		return errors.New("Tunnel name is not valid")
+	}
+	store.lock.Lock()
+	if _, ok := store.texts[name]; !ok {
+		store.lock.Unlock()
+		return memoryStoreNotFound(name)
+	}
+	delete(store.texts, name)
+	delete(store.history, name)
+	delete(store.metadata, name)
+	store.notifyAndUnlock(StoreEvent{Type: StoreEventRemoved, Name: name})
+	return nil
+}
+
+func (store *MemoryStore) Rename(oldName, newName string) error {
+	if !TunnelNameIsValid(oldName) || !TunnelNameIsValid(newName) {
+		return errors.New("Tunnel name is not valid")
+	}
+	store.lock.Lock()
+	text, ok := store.texts[oldName]
+	if !ok {
+		store.lock.Unlock()
+		return memoryStoreNotFound(oldName)
+	}
+	if _, ok = store.texts[newName]; ok {
+		store.lock.Unlock()
+		return fmt.Errorf("Tunnel ‘%s’ already exists", newName)
+	}
+	store.texts[newName] = text
+	delete(store.texts, oldName)
+	store.history[newName] = store.history[oldName]
+	delete(store.history, oldName)
+	if metadata, ok := store.metadata[oldName]; ok {
+		store.metadata[newName] = metadata
+		delete(store.metadata, oldName)
+	}
+	store.notifyAndUnlock(StoreEvent{Type: StoreEventRenamed, Name: newName, OldName: oldName})
+	return nil
+}
+
+func (store *MemoryStore) LoadMetadata(name string) (*Metadata, error) {
+	if !TunnelNameIsValid(name) {
+		return nil, errors.New("Tunnel name is not valid")
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if _, ok := store.texts[name]; !ok {
+		return nil, memoryStoreNotFound(name)
+	}
+	m := store.metadata[name]
+	m.Tags = append([]string(nil), m.Tags...)
+	m.normalize()
+	return &m, nil
+}
+
+func (store *MemoryStore) SaveMetadata(name string, m *Metadata) error {
+	if !TunnelNameIsValid(name) {
+		return errors.New("Tunnel name is not valid")
+	}
+	normalized := *m
+	normalized.normalize()
+	store.lock.Lock()
+	if _, ok := store.texts[name]; !ok {
+		store.lock.Unlock()
+		return memoryStoreNotFound(name)
+	}
+	if normalized.IsEmpty() {
+		delete(store.metadata, name)
+	} else {
+		store.metadata[name] = normalized
+	}
+	store.notifyAndUnlock(StoreEvent{Type: StoreEventModified, Name: name})
+	return nil
+}
+
+func (store *MemoryStore) Revisions(name string) ([]Revision, error) {
+	if !TunnelNameIsValid(name) {
+		return nil, errors.New("Tunnel name is not valid")
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	history := store.history[name]
+	revisions := make([]Revision, len(history))
+	for i := range history {
+		revisions[i] = history[i].Revision
+	}
+	return revisions, nil
+}
+
+func (store *MemoryStore) LoadRevision(name string, id string) (*Document, error) {
+	if !TunnelNameIsValid(name) {
+		return nil, errors.New("Tunnel name is not valid")
+	}
+	store.lock.Lock()
+	history := store.history[name]
+	store.lock.Unlock()
+	for i := range history {
+		if history[i].ID == id {
+			return ParseDocument(history[i].text, name)
+		}
+	}
+	return nil, memoryStoreNotFound(name + "@" + id)
+}
+
+func (store *MemoryStore) Watch(cb func()) *StoreCallback {
+	cb()
+	return store.callbacks.register(cb, nil)
+}
+
+func (store *MemoryStore) WatchEvents(cb func(event StoreEvent)) *StoreCallback {
+	return store.callbacks.register(nil, cb)
+}
+
+// notifyAndUnlock runs the callbacks after unlocking, so that they may use the store.
+func (store *MemoryStore) notifyAndUnlock(event StoreEvent) {
+	store.lock.Unlock()
+	store.callbacks.notify([]StoreEvent{event})
+}
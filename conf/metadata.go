@@ -0,0 +1,206 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Metadata is what is known about a tunnel beyond its configuration. Tunnels are listed by Order
+// first, and then by name. If no tunnel is running when the manager starts, the first one listed with
+// Autostart is started.
+type Metadata struct {
+	Description string   `json:"description,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Autostart   bool     `json:"autostart,omitempty"`
+	Order       int      `json:"order,omitempty"`
+}
+
+const metadataFileSuffix = ".meta.dpapi"
+
+// MetadataExportSuffix is added to the name of a tunnel for the file that holds its metadata when it
+// is exported, so that importing the configuration beside it brings the metadata back too.
+const MetadataExportSuffix = ".meta.json"
+
+// TunnelIsListedBefore orders tunnels by the Order of their metadata, and then by name.
+func TunnelIsListedBefore(nameA string, orderA int, nameB string, orderB int) bool {
+	if orderA != orderB {
+		return orderA < orderB
+	}
+	return TunnelNameIsLess(nameA, nameB)
+}
+
+func (m *Metadata) IsEmpty() bool {
+	return len(m.Description) == 0 && len(m.Owner) == 0 && len(m.Tags) == 0 && !m.Autostart && m.Order == 0
+}
+
+// normalize trims the tags, dropping empty and repeated ones.
+func (m *Metadata) normalize() {
+	tags := make([]string, 0, len(m.Tags))
+	seen := make(map[string]bool, len(m.Tags))
+	for _, tag := range m.Tags {
+		tag = strings.TrimSpace(tag)
+		if len(tag) == 0 || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+	m.Tags = tags
+}
+
+func (m *Metadata) ToJSON() (string, error) {
+	bytes, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(bytes) + "\n", nil
+}
+
+func MetadataFromJSON(text string) (*Metadata, error) {
+	m := &Metadata{}
+	err := json.Unmarshal([]byte(text), m)
+	if err != nil {
+		return nil, err
+	}
+	m.normalize()
+	return m, nil
+}
+
+func metadataEncryptionName(name string) string {
+	return name + metadataFileSuffix
+}
+
+func metadataNameOfFile(file string) (string, bool) {
+	if len(file) <= len(metadataFileSuffix) || !strings.HasSuffix(file, metadataFileSuffix) {
+		return "", false
+	}
+	name := strings.TrimSuffix(file, metadataFileSuffix)
+	return name, TunnelNameIsValid(name)
+}
+
+func (store *FileStore) metadataPath(name string) (string, error) {
+	if !TunnelNameIsValid(name) {
+		return "", errors.New("Tunnel name is not valid")
+	}
+	return filepath.Join(store.dir, name+metadataFileSuffix), nil
+}
+
+func (store *FileStore) readMetadataFile(path string, name string) (*Metadata, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if store.encryptor == nil {
+		return nil, errNoEncryptor
+	}
+	bytes, err = store.encryptor.Decrypt(bytes, metadataEncryptionName(name))
+	if err != nil {
+		return nil, err
+	}
+	return MetadataFromJSON(string(bytes))
+}
+
+// LoadMetadata fails if there is no tunnel of name, but gives empty metadata for one that has none.
+func (store *FileStore) LoadMetadata(name string) (*Metadata, error) {
+	configPath, err := store.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(configPath); err != nil {
+		return nil, err
+	}
+	path, err := store.metadataPath(name)
+	if err != nil {
+		return nil, err
+	}
+	m, err := store.readMetadataFile(path, name)
+	if os.IsNotExist(err) {
+		return &Metadata{}, nil
+	}
+	return m, err
+}
+
+func (store *FileStore) SaveMetadata(name string, m *Metadata) error {
+	store.lock.Lock()
+	err := store.saveMetadata(name, m)
+	store.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	store.rescan()
+	return nil
+}
+
+func (store *FileStore) saveMetadata(name string, m *Metadata) error {
+	configPath, err := store.Path(name)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(configPath); err != nil {
+		return err
+	}
+	return store.writeMetadata(name, m)
+}
+
+// writeMetadata removes the file of name when m is empty, rather than storing nothing in it.
+func (store *FileStore) writeMetadata(name string, m *Metadata) error {
+	path, err := store.metadataPath(name)
+	if err != nil {
+		return err
+	}
+	normalized := *m
+	normalized.normalize()
+	if normalized.IsEmpty() {
+		err = os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	text, err := normalized.ToJSON()
+	if err != nil {
+		return err
+	}
+	if store.encryptor == nil {
+		return errNoEncryptor
+	}
+	bytes, err := store.encryptor.Encrypt([]byte(text), metadataEncryptionName(name))
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path+".tmp", bytes, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return nil
+}
+
+func (store *FileStore) deleteMetadata(name string) error {
+	path, err := store.metadataPath(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
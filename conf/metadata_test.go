@@ -0,0 +1,137 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadataJSON(t *testing.T) {
+	m := &Metadata{Description: "Office", Tags: []string{" work ", "", "work", "eu"}, Autostart: true, Order: 2}
+	text, err := m.ToJSON()
+	if !noError(t, err) {
+		return
+	}
+	parsed, err := MetadataFromJSON(text)
+	if noError(t, err) {
+		equal(t, &Metadata{Description: "Office", Tags: []string{"work", "eu"}, Autostart: true, Order: 2}, parsed)
+	}
+	empty, err := MetadataFromJSON("{}")
+	if noError(t, err) {
+		equal(t, true, empty.IsEmpty())
+	}
+	if _, err = MetadataFromJSON("nonsense"); err == nil {
+		t.Error("Parsing invalid metadata succeeded")
+	}
+}
+
+func testStoreMetadata(t *testing.T, store ConfigStore) {
+	if _, err := store.LoadMetadata("golangTest"); !os.IsNotExist(err) {
+		t.Errorf("Loading metadata of a missing tunnel gave %v", err)
+	}
+	if err := store.SaveMetadata("golangTest", &Metadata{Owner: "admin"}); !os.IsNotExist(err) {
+		t.Errorf("Saving metadata of a missing tunnel gave %v", err)
+	}
+
+	doc, err := ParseDocument(testInput, "golangTest")
+	if !noError(t, err) || !noError(t, store.Save(doc)) {
+		return
+	}
+	m, err := store.LoadMetadata("golangTest")
+	if noError(t, err) {
+		equal(t, &Metadata{}, m)
+	}
+
+	saved := &Metadata{Description: "Office", Owner: "admin", Tags: []string{"work", " work"}, Autostart: true, Order: -1}
+	noError(t, store.SaveMetadata("golangTest", saved))
+	want := &Metadata{Description: "Office", Owner: "admin", Tags: []string{"work"}, Autostart: true, Order: -1}
+	m, err = store.LoadMetadata("golangTest")
+	if noError(t, err) {
+		equal(t, want, m)
+	}
+	if !saveWithListenPort(t, store, "golangTest", 1234) {
+		return
+	}
+	m, err = store.LoadMetadata("golangTest")
+	if noError(t, err) {
+		equal(t, want, m)
+	}
+
+	noError(t, store.Rename("golangTest", "renamed"))
+	m, err = store.LoadMetadata("renamed")
+	if noError(t, err) {
+		equal(t, want, m)
+	}
+
+	noError(t, store.Delete("renamed"))
+	doc.Name = "renamed"
+	if !noError(t, store.Save(doc)) {
+		return
+	}
+	m, err = store.LoadMetadata("renamed")
+	if noError(t, err) {
+		equal(t, &Metadata{}, m)
+	}
+
+	noError(t, store.SaveMetadata("renamed", want))
+	noError(t, store.SaveMetadata("renamed", &Metadata{}))
+	m, err = store.LoadMetadata("renamed")
+	if noError(t, err) {
+		equal(t, &Metadata{}, m)
+	}
+	noError(t, store.Delete("renamed"))
+}
+
+func TestFileStoreMetadata(t *testing.T) {
+	store, cleanup := newTestFileStore(t)
+	if store == nil {
+		return
+	}
+	defer cleanup()
+	testStoreMetadata(t, store)
+
+	doc, err := ParseDocument(testInput, "golangTest")
+	if !noError(t, err) || !noError(t, store.Save(doc)) {
+		return
+	}
+	noError(t, store.SaveMetadata("golangTest", &Metadata{Description: "secret description"}))
+	path, _ := store.metadataPath("golangTest")
+	bytes, err := ioutil.ReadFile(path)
+	if noError(t, err) && strings.Contains(string(bytes), "secret description") {
+		t.Error("Metadata is stored unencrypted")
+	}
+	names, err := store.List()
+	if noError(t, err) {
+		equal(t, []string{"golangTest"}, names)
+	}
+	reports, err := store.Scan()
+	if noError(t, err) {
+		for _, report := range reports {
+			equal(t, FileOK, report.Health)
+		}
+	}
+
+	recorder := &eventRecorder{}
+	defer store.WatchEvents(recorder.record).Unregister()
+	time.Sleep(time.Millisecond * 10)
+	noError(t, store.SaveMetadata("golangTest", &Metadata{Description: "longer secret description"}))
+	equal(t, []StoreEvent{{StoreEventModified, "golangTest", ""}}, recorder.take(1, time.Second))
+
+	configPath, _ := store.Path("golangTest")
+	noError(t, os.Remove(configPath))
+	reports, err = store.Scan()
+	if noError(t, err) && equal(t, 1, len(reports)) {
+		equal(t, FileOrphanedMetadata, reports[0].Health)
+	}
+}
+
+func TestMemoryStoreMetadata(t *testing.T) {
+	testStoreMetadata(t, NewMemoryStore())
+}
@@ -0,0 +1,340 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// FromNetworkd converts a systemd-networkd .netdev file of kind wireguard into a Config, taking the
+// addresses, DNS servers, search domains, and MTU of the interface from the first of networks, which
+// are the contents of .network files, whose [Match] section names the interface. Unlike networkd,
+// which adds no routes unless asked to by RouteTable=, the Config has routes for allowed IPs unless
+// RouteTable= is false, as wg-quick does, and so RouteTable=main becomes the automatic table.
+// Everything else that cannot be expressed, such as [Route] sections or key files, is returned as
+// unsupported settings.
+func FromNetworkd(netdev string, networks ...string) (*Config, []UnsupportedSetting, error) {
+	sections, err := parseINI(netdev, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	var config Config
+	var unsupported []UnsupportedSetting
+	sawKind := false
+	for i := range sections {
+		section := &sections[i]
+		var peer *Peer
+		switch section.Name {
+		case "NetDev", "WireGuard":
+		case "WireGuardPeer":
+			config.Peers = append(config.Peers, Peer{})
+			peer = &config.Peers[len(config.Peers)-1]
+		default:
+			unsupported = append(unsupported, unsupportedSection(section)...)
+			continue
+		}
+		for j := range section.Keys {
+			key := &section.Keys[j]
+			supported := true
+			var err error
+			switch {
+			case section.Name == "NetDev" && key.Key == "Name":
+				config.Name = key.Value
+			case section.Name == "NetDev" && key.Key == "Kind":
+				if key.Value != "wireguard" {
+					return nil, nil, key.error(&ParseError{why: "Only netdevs of kind wireguard can be imported", offender: key.Value})
+				}
+				sawKind = true
+			case section.Name == "NetDev" && key.Key == "MTUBytes":
+				config.Interface.MTU, err = parseMTU(key.Value)
+			case section.Name == "NetDev":
+				supported = false
+			case peer == nil:
+				supported, err = parseNetworkdWireGuardKey(&config.Interface, key.Key, key.Value)
+			default:
+				supported, err = parseNetworkdPeerKey(peer, key.Key, key.Value)
+			}
+			if err != nil {
+				return nil, nil, key.error(err)
+			}
+			if !supported {
+				unsupported = append(unsupported, unsupportedSetting(section, key))
+			}
+		}
+	}
+	if !sawKind {
+		return nil, nil, &ParseError{why: "Netdev has no kind", offender: "[none specified]", Code: ParseErrorMissingValue, Section: NoSection, Key: "Kind"}
+	}
+
+	for _, network := range networks {
+		sections, err := parseINI(network, true)
+		if err != nil || !networkdMatches(sections, config.Name) {
+			continue
+		}
+		for i := range sections {
+			section := &sections[i]
+			if section.Name == "Match" {
+				continue
+			}
+			for j := range section.Keys {
+				key := &section.Keys[j]
+				supported, err := parseNetworkdNetworkKey(&config.Interface, section.Name, key.Key, key.Value)
+				if err != nil {
+					return nil, nil, key.error(err)
+				}
+				if !supported {
+					unsupported = append(unsupported, unsupportedSetting(section, key))
+				}
+			}
+		}
+		break
+	}
+
+	err = checkImported(&config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &config, unsupported, nil
+}
+
+func networkdMatches(sections []iniSection, name string) bool {
+	for _, section := range sections {
+		if section.Name != "Match" {
+			continue
+		}
+		for _, key := range section.Keys {
+			if key.Key != "Name" {
+				continue
+			}
+			for _, pattern := range strings.Fields(key.Value) {
+				if matched, _ := filepath.Match(pattern, name); matched {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// networkd separates lists with whitespace, and also with commas in the case of allowed IPs.
+func splitNetworkdList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+func parseNetworkdBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "1", "yes", "y", "true", "t", "on":
+		return true, true
+	case "0", "no", "n", "false", "f", "off":
+		return false, true
+	}
+	return false, false
+}
+
+func parseNetworkdTable(s string) (*Table, error) {
+	if value, ok := parseNetworkdBool(s); ok && !value {
+		return &Table{Off: true}, nil
+	}
+	switch s {
+	case "default":
+		return &Table{ID: 253}, nil
+	case "main":
+		return &Table{}, nil
+	case "local":
+		return &Table{ID: 255}, nil
+	}
+	return parseTable(s)
+}
+
+func parseNetworkdWireGuardKey(iface *Interface, key, val string) (bool, error) {
+	switch key {
+	case "PrivateKey":
+		k, err := parseKeyBase64(val)
+		if err != nil {
+			return true, err
+		}
+		iface.PrivateKey = *k
+	case "ListenPort":
+		if val == "auto" {
+			iface.ListenPort = 0
+			break
+		}
+		p, err := parsePort(val)
+		if err != nil {
+			return true, err
+		}
+		iface.ListenPort = p
+	case "FirewallMark", "FwMark":
+		m, err := parseFwMark(val)
+		if err != nil {
+			return true, err
+		}
+		iface.FwMark = m
+	case "RouteTable":
+		table, err := parseNetworkdTable(val)
+		if err != nil {
+			return true, err
+		}
+		iface.Table = *table
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func parseNetworkdPeerKey(peer *Peer, key, val string) (bool, error) {
+	switch key {
+	case "PublicKey":
+		k, err := parseKeyBase64(val)
+		if err != nil {
+			return true, err
+		}
+		peer.PublicKey = *k
+	case "PresharedKey":
+		k, err := parseKeyBase64(val)
+		if err != nil {
+			return true, err
+		}
+		peer.PresharedKey = *k
+	case "AllowedIPs":
+		if len(val) == 0 {
+			peer.AllowedIPs = nil
+		}
+		for _, address := range splitNetworkdList(val) {
+			a, err := parseIPCidr(address)
+			if err != nil {
+				return true, err
+			}
+			peer.AllowedIPs = append(peer.AllowedIPs, *a)
+		}
+	case "Endpoint":
+		e, err := parseEndpoint(val)
+		if err != nil {
+			return true, err
+		}
+		peer.Endpoint = *e
+	case "PersistentKeepalive":
+		if val == "off" {
+			peer.PersistentKeepalive = 0
+			break
+		}
+		p, err := parsePersistentKeepalive(val)
+		if err != nil {
+			return true, err
+		}
+		peer.PersistentKeepalive = p
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func parseNetworkdNetworkKey(iface *Interface, section, key, val string) (bool, error) {
+	switch {
+	case (section == "Network" || section == "Address") && key == "Address":
+		for _, address := range splitNetworkdList(val) {
+			a, err := parseIPCidr(address)
+			if err != nil {
+				return true, err
+			}
+			iface.Addresses = append(iface.Addresses, *a)
+		}
+	case section == "Network" && key == "DNS":
+		// Servers with a port, an interface, or a server name have no equivalent.
+		addresses := splitNetworkdList(val)
+		for _, address := range addresses {
+			if net.ParseIP(address) == nil {
+				return false, nil
+			}
+		}
+		for _, address := range addresses {
+			iface.DNS = append(iface.DNS, net.ParseIP(address))
+		}
+	case section == "Network" && key == "Domains":
+		// Routing-only domains, which start with a tilde, have no equivalent.
+		domains := strings.Fields(val)
+		for _, domain := range domains {
+			if strings.HasPrefix(domain, "~") {
+				return false, nil
+			}
+		}
+		iface.DNSSearch = append(iface.DNSSearch, domains...)
+	case section == "Link" && key == "MTUBytes":
+		m, err := parseMTU(val)
+		if err != nil {
+			return true, err
+		}
+		iface.MTU = m
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// ToNetworkd writes a .netdev file and the .network file that goes with it. Since networkd adds no
+// routes for allowed IPs by default, the automatic table becomes RouteTable=main. There is nowhere to
+// put PreUp, PostUp, PreDown, or PostDown commands, which are left out.
+func (conf *Config) ToNetworkd() (netdev, network string) {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("[NetDev]\nName=%s\nKind=wireguard\n", conf.Name))
+	if conf.Interface.MTU > 0 {
+		output.WriteString(fmt.Sprintf("MTUBytes=%d\n", conf.Interface.MTU))
+	}
+
+	output.WriteString(fmt.Sprintf("\n[WireGuard]\nPrivateKey=%s\n", conf.Interface.PrivateKey.String()))
+	if conf.Interface.ListenPort > 0 {
+		output.WriteString(fmt.Sprintf("ListenPort=%d\n", conf.Interface.ListenPort))
+	}
+	if conf.Interface.FwMark > 0 {
+		output.WriteString(fmt.Sprintf("FirewallMark=0x%x\n", conf.Interface.FwMark))
+	}
+	if conf.Interface.Table.IsAuto() {
+		output.WriteString("RouteTable=main\n")
+	} else if !conf.Interface.Table.Off {
+		output.WriteString(fmt.Sprintf("RouteTable=%d\n", conf.Interface.Table.ID))
+	}
+
+	for _, peer := range conf.Peers {
+		output.WriteString(fmt.Sprintf("\n[WireGuardPeer]\nPublicKey=%s\n", peer.PublicKey.String()))
+		if !peer.PresharedKey.IsZero() {
+			output.WriteString(fmt.Sprintf("PresharedKey=%s\n", peer.PresharedKey.String()))
+		}
+		if len(peer.AllowedIPs) > 0 {
+			output.WriteString(fmt.Sprintf("AllowedIPs=%s\n", joinIPCidrs(peer.AllowedIPs)))
+		}
+		if !peer.Endpoint.IsEmpty() {
+			output.WriteString(fmt.Sprintf("Endpoint=%s\n", peer.Endpoint.String()))
+		}
+		if peer.PersistentKeepalive > 0 {
+			output.WriteString(fmt.Sprintf("PersistentKeepalive=%d\n", peer.PersistentKeepalive))
+		}
+	}
+	netdev = output.String()
+
+	output.Reset()
+	output.WriteString(fmt.Sprintf("[Match]\nName=%s\n\n[Network]\n", conf.Name))
+	for _, address := range conf.Interface.Addresses {
+		output.WriteString(fmt.Sprintf("Address=%s\n", address.String()))
+	}
+	if len(conf.Interface.DNS) > 0 {
+		addrStrings := make([]string, len(conf.Interface.DNS))
+		for i, address := range conf.Interface.DNS {
+			addrStrings[i] = address.String()
+		}
+		output.WriteString(fmt.Sprintf("DNS=%s\n", strings.Join(addrStrings, " ")))
+	}
+	if len(conf.Interface.DNSSearch) > 0 {
+		output.WriteString(fmt.Sprintf("Domains=%s\n", strings.Join(conf.Interface.DNSSearch, " ")))
+	}
+	network = output.String()
+	return
+}
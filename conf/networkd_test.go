@@ -0,0 +1,119 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const testNetdev = `[NetDev]
+Name=wg0
+Kind=wireguard
+Description=Office tunnel
+
+[WireGuard]
+PrivateKey=yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort=51820
+RouteTable=main
+
+[WireGuardPeer]
+PublicKey=xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs=10.192.122.3/32, \
+  10.192.124.1/24
+Endpoint=192.95.5.67:1234
+PersistentKeepalive=off
+`
+
+const testNetwork = `[Match]
+Name=wg*
+
+[Network]
+Address=10.192.122.1/24
+DNS=1.1.1.1 8.8.8.8
+Domains=example.com
+
+[Route]
+Destination=10.192.124.0/24
+`
+
+func TestFromNetworkd(t *testing.T) {
+	config, unsupported, err := FromNetworkd(testNetdev, "[Match]\nName=eth0\n\n[Network]\nAddress=192.168.1.2/24\n", testNetwork)
+	if !noError(t, err) {
+		return
+	}
+	equal(t, "wg0", config.Name)
+	equal(t, uint16(51820), config.Interface.ListenPort)
+	equal(t, Table{}, config.Interface.Table)
+	equal(t, []string{"10.192.122.1/24"}, ipcidrStrings(config.Interface.Addresses))
+	equal(t, []net.IP{net.IPv4(1, 1, 1, 1), net.IPv4(8, 8, 8, 8)}, config.Interface.DNS)
+	equal(t, []string{"example.com"}, config.Interface.DNSSearch)
+	if lenTest(t, config.Peers, 1) {
+		equal(t, []string{"10.192.122.3/32", "10.192.124.1/24"}, ipcidrStrings(config.Peers[0].AllowedIPs))
+		equal(t, Endpoint{"192.95.5.67", 1234}, config.Peers[0].Endpoint)
+	}
+	equal(t, []UnsupportedSetting{
+		{4, "NetDev", "Description", "Office tunnel"},
+		{10, "Route", "Destination", "10.192.124.0/24"},
+	}, unsupported)
+
+	_, _, err = FromNetworkd("[NetDev]\nName=br0\nKind=bridge\n")
+	if err == nil {
+		t.Error("Expected an error for a netdev that is not of kind wireguard")
+	}
+	_, _, err = FromNetworkd("[NetDev]\nName=wg0\nKind=wireguard\n\n[WireGuard]\nPrivateKeyFile=/etc/wg0.key\n")
+	if e, ok := err.(*ParseError); !ok || e.Code != ParseErrorMissingPrivateKey {
+		t.Errorf("Expected a missing private key, got %v", err)
+	}
+}
+
+func ipcidrStrings(ipcidrs []IPCidr) []string {
+	var out []string
+	for i := range ipcidrs {
+		out = append(out, ipcidrs[i].String())
+	}
+	return out
+}
+
+const testExportInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+Address = 10.192.122.1/24, fd00::1/64
+DNS = 1.1.1.1, 2606:4700:4700::1111, example.com
+MTU = 1400
+FwMark = 0x1234
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+PresharedKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 0.0.0.0/0, ::/0
+Endpoint = demo.wireguard.com:51820
+PersistentKeepalive = 25
+
+[Peer]
+PublicKey = gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=
+AllowedIPs = 10.192.124.0/24
+`
+
+func TestToNetworkd(t *testing.T) {
+	config, err := FromWgQuick(testExportInput, "wg0")
+	if !noError(t, err) {
+		return
+	}
+	netdev, network := config.ToNetworkd()
+	imported, unsupported, err := FromNetworkd(netdev, network)
+	if noError(t, err) {
+		equal(t, config, imported)
+		lenTest(t, unsupported, 0)
+	}
+
+	config.Interface.Table = Table{Off: true}
+	netdev, _ = config.ToNetworkd()
+	if strings.Contains(netdev, "RouteTable") {
+		t.Errorf("Routes are off by default in networkd: %s", netdev)
+	}
+}
@@ -0,0 +1,314 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// FromNetworkManager converts a NetworkManager key file of type wireguard into a Config, named after
+// the interface-name of the connection, or failing that its id. Keys that are kept by a secret agent
+// rather than in the file, gateways, routes, and everything else that cannot be expressed, are
+// returned as unsupported settings.
+func FromNetworkManager(keyfile string) (*Config, []UnsupportedSetting, error) {
+	sections, err := parseINI(keyfile, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	var config Config
+	var unsupported []UnsupportedSetting
+	var id string
+	sawType := false
+	for i := range sections {
+		section := &sections[i]
+		var peer *Peer
+		switch {
+		case section.Name == "connection", section.Name == "wireguard", section.Name == "ipv4", section.Name == "ipv6":
+		case strings.HasPrefix(section.Name, "wireguard-peer."):
+			k, err := parseKeyBase64(strings.TrimPrefix(section.Name, "wireguard-peer."))
+			if err != nil {
+				e := toParseError(err, section.Name)
+				e.Line = section.Line
+				e.Section = NoSection
+				return nil, nil, e
+			}
+			config.Peers = append(config.Peers, Peer{PublicKey: *k})
+			peer = &config.Peers[len(config.Peers)-1]
+		default:
+			unsupported = append(unsupported, unsupportedSection(section)...)
+			continue
+		}
+		for j := range section.Keys {
+			key := &section.Keys[j]
+			supported := true
+			var err error
+			switch {
+			case section.Name == "connection" && key.Key == "id":
+				id = key.Value
+			case section.Name == "connection" && key.Key == "interface-name":
+				config.Name = key.Value
+			case section.Name == "connection" && key.Key == "type":
+				if key.Value != "wireguard" {
+					return nil, nil, key.error(&ParseError{why: "Only connections of type wireguard can be imported", offender: key.Value})
+				}
+				sawType = true
+			case section.Name == "connection" && (key.Key == "uuid" || key.Key == "timestamp"):
+				// These only identify the connection to NetworkManager.
+			case section.Name == "connection":
+				supported = false
+			case section.Name == "wireguard":
+				supported, err = parseNetworkManagerWireGuardKey(&config.Interface, key.Key, key.Value)
+			case peer != nil:
+				supported, err = parseNetworkManagerPeerKey(peer, key.Key, key.Value)
+			default:
+				supported, err = parseNetworkManagerIPKey(&config.Interface, key.Key, key.Value)
+			}
+			if err != nil {
+				return nil, nil, key.error(err)
+			}
+			if !supported {
+				unsupported = append(unsupported, unsupportedSetting(section, key))
+			}
+		}
+	}
+	if !sawType {
+		return nil, nil, &ParseError{why: "Connection has no type", offender: "[none specified]", Code: ParseErrorMissingValue, Section: NoSection, Key: "type"}
+	}
+	if len(config.Name) == 0 {
+		config.Name = id
+	}
+
+	err = checkImported(&config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &config, unsupported, nil
+}
+
+// NetworkManager separates lists with semicolons, and usually ends them with one too.
+func splitNetworkManagerList(s string) []string {
+	var out []string
+	for _, split := range strings.Split(s, ";") {
+		trim := strings.TrimSpace(split)
+		if len(trim) > 0 {
+			out = append(out, trim)
+		}
+	}
+	return out
+}
+
+func parseNetworkManagerWireGuardKey(iface *Interface, key, val string) (bool, error) {
+	switch key {
+	case "private-key":
+		k, err := parseKeyBase64(val)
+		if err != nil {
+			return true, err
+		}
+		iface.PrivateKey = *k
+	case "private-key-flags":
+		return val == "0", nil
+	case "listen-port":
+		p, err := parsePort(val)
+		if err != nil {
+			return true, err
+		}
+		iface.ListenPort = p
+	case "fwmark":
+		m, err := parseFwMark(val)
+		if err != nil {
+			return true, err
+		}
+		iface.FwMark = m
+	case "mtu":
+		m, err := parseMTU(val)
+		if err != nil {
+			return true, err
+		}
+		iface.MTU = m
+	case "peer-routes":
+		if val == "false" {
+			iface.Table = Table{Off: true}
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func parseNetworkManagerPeerKey(peer *Peer, key, val string) (bool, error) {
+	switch key {
+	case "endpoint":
+		e, err := parseEndpoint(val)
+		if err != nil {
+			return true, err
+		}
+		peer.Endpoint = *e
+	case "allowed-ips":
+		for _, address := range splitNetworkManagerList(val) {
+			a, err := parseIPCidr(address)
+			if err != nil {
+				return true, err
+			}
+			peer.AllowedIPs = append(peer.AllowedIPs, *a)
+		}
+	case "preshared-key":
+		k, err := parseKeyBase64(val)
+		if err != nil {
+			return true, err
+		}
+		peer.PresharedKey = *k
+	case "preshared-key-flags":
+		return val == "0", nil
+	case "persistent-keepalive":
+		p, err := parsePersistentKeepalive(val)
+		if err != nil {
+			return true, err
+		}
+		peer.PersistentKeepalive = p
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func parseNetworkManagerIPKey(iface *Interface, key, val string) (bool, error) {
+	switch {
+	case key == "method":
+		return val == "manual" || val == "disabled" || val == "ignore", nil
+	case key == "addresses" || (strings.HasPrefix(key, "address") && len(strings.Trim(key[len("address"):], "0123456789")) == 0):
+		// An address may be followed by a comma and a gateway, which has no equivalent.
+		supported := true
+		for _, address := range splitNetworkManagerList(val) {
+			if comma := strings.IndexByte(address, ','); comma >= 0 {
+				address = address[:comma]
+				supported = false
+			}
+			a, err := parseIPCidr(address)
+			if err != nil {
+				return true, err
+			}
+			iface.Addresses = append(iface.Addresses, *a)
+		}
+		return supported, nil
+	case key == "dns":
+		for _, address := range splitNetworkManagerList(val) {
+			a := net.ParseIP(address)
+			if a == nil {
+				return true, &ParseError{why: "Invalid IP address", offender: address}
+			}
+			iface.DNS = append(iface.DNS, a)
+		}
+	case key == "dns-search":
+		iface.DNSSearch = append(iface.DNSSearch, splitNetworkManagerList(val)...)
+	case key == "route-table":
+		if val == "0" {
+			break
+		}
+		table, err := parseTable(val)
+		if err != nil {
+			return true, err
+		}
+		iface.Table = *table
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// ToNetworkManager writes a key file for NetworkManager, with the interface name as the id of the
+// connection. Like in ToNetworkd, PreUp, PostUp, PreDown, and PostDown commands are left out.
+func (conf *Config) ToNetworkManager() string {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("[connection]\nid=%s\ntype=wireguard\ninterface-name=%s\n", conf.Name, conf.Name))
+
+	output.WriteString(fmt.Sprintf("\n[wireguard]\nprivate-key=%s\n", conf.Interface.PrivateKey.String()))
+	if conf.Interface.ListenPort > 0 {
+		output.WriteString(fmt.Sprintf("listen-port=%d\n", conf.Interface.ListenPort))
+	}
+	if conf.Interface.FwMark > 0 {
+		output.WriteString(fmt.Sprintf("fwmark=%d\n", conf.Interface.FwMark))
+	}
+	if conf.Interface.MTU > 0 {
+		output.WriteString(fmt.Sprintf("mtu=%d\n", conf.Interface.MTU))
+	}
+	if conf.Interface.Table.Off {
+		output.WriteString("peer-routes=false\n")
+	}
+
+	for _, peer := range conf.Peers {
+		output.WriteString(fmt.Sprintf("\n[wireguard-peer.%s]\n", peer.PublicKey.String()))
+		if !peer.Endpoint.IsEmpty() {
+			output.WriteString(fmt.Sprintf("endpoint=%s\n", peer.Endpoint.String()))
+		}
+		if !peer.PresharedKey.IsZero() {
+			output.WriteString(fmt.Sprintf("preshared-key=%s\npreshared-key-flags=0\n", peer.PresharedKey.String()))
+		}
+		if len(peer.AllowedIPs) > 0 {
+			output.WriteString("allowed-ips=")
+			for _, address := range peer.AllowedIPs {
+				output.WriteString(address.String() + ";")
+			}
+			output.WriteString("\n")
+		}
+		if peer.PersistentKeepalive > 0 {
+			output.WriteString(fmt.Sprintf("persistent-keepalive=%d\n", peer.PersistentKeepalive))
+		}
+	}
+
+	// Search domains are written only once, with IPv4 unless only IPv6 has addresses or DNS servers.
+	// They are written even if neither does, rather than being lost.
+	searchFamily := "ipv4"
+	var hasIPv4, hasIPv6 bool
+	for _, address := range conf.Interface.Addresses {
+		hasIPv4 = hasIPv4 || address.IP.To4() != nil
+		hasIPv6 = hasIPv6 || address.IP.To4() == nil
+	}
+	for _, address := range conf.Interface.DNS {
+		hasIPv4 = hasIPv4 || address.To4() != nil
+		hasIPv6 = hasIPv6 || address.To4() == nil
+	}
+	if !hasIPv4 && hasIPv6 {
+		searchFamily = "ipv6"
+	}
+	for _, family := range []string{"ipv4", "ipv6"} {
+		isFamily := func(ip net.IP) bool {
+			return (ip.To4() != nil) == (family == "ipv4")
+		}
+		output.WriteString(fmt.Sprintf("\n[%s]\n", family))
+		n := 0
+		for _, address := range conf.Interface.Addresses {
+			if isFamily(address.IP) {
+				n++
+				output.WriteString(fmt.Sprintf("address%d=%s\n", n, address.String()))
+			}
+		}
+		var dns []string
+		for _, address := range conf.Interface.DNS {
+			if isFamily(address) {
+				dns = append(dns, address.String()+";")
+			}
+		}
+		if len(dns) > 0 {
+			output.WriteString(fmt.Sprintf("dns=%s\n", strings.Join(dns, "")))
+		}
+		if family == searchFamily && len(conf.Interface.DNSSearch) > 0 {
+			output.WriteString(fmt.Sprintf("dns-search=%s;\n", strings.Join(conf.Interface.DNSSearch, ";")))
+		}
+		if conf.Interface.Table.ID > 0 {
+			output.WriteString(fmt.Sprintf("route-table=%d\n", conf.Interface.Table.ID))
+		}
+		if n > 0 {
+			output.WriteString("method=manual\n")
+		} else if family == "ipv4" {
+			output.WriteString("method=disabled\n")
+		} else {
+			output.WriteString("method=ignore\n")
+		}
+	}
+	return output.String()
+}
@@ -0,0 +1,94 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"net"
+	"testing"
+)
+
+const testKeyfile = `[connection]
+id=Office VPN
+uuid=6d1b2a5e-0c1a-4a8e-9a3e-3f2b1c0d9e8f
+type=wireguard
+interface-name=office
+autoconnect=false
+
+[wireguard]
+private-key=yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+listen-port=51820
+peer-routes=false
+
+[wireguard-peer.xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=]
+endpoint=192.95.5.67:1234
+preshared-key=TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+preshared-key-flags=0
+allowed-ips=10.192.122.3/32;10.192.124.1/24;
+
+[ipv4]
+address1=10.192.122.1/24,10.192.122.254
+dns=1.1.1.1;
+dns-search=example.com;
+method=manual
+
+[ipv6]
+method=ignore
+
+[proxy]
+`
+
+func TestFromNetworkManager(t *testing.T) {
+	config, unsupported, err := FromNetworkManager(testKeyfile)
+	if !noError(t, err) {
+		return
+	}
+	equal(t, "office", config.Name)
+	equal(t, uint16(51820), config.Interface.ListenPort)
+	equal(t, Table{Off: true}, config.Interface.Table)
+	equal(t, []string{"10.192.122.1/24"}, ipcidrStrings(config.Interface.Addresses))
+	equal(t, []net.IP{net.IPv4(1, 1, 1, 1)}, config.Interface.DNS)
+	equal(t, []string{"example.com"}, config.Interface.DNSSearch)
+	if lenTest(t, config.Peers, 1) {
+		equal(t, "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=", config.Peers[0].PublicKey.String())
+		equal(t, "TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=", config.Peers[0].PresharedKey.String())
+		equal(t, []string{"10.192.122.3/32", "10.192.124.1/24"}, ipcidrStrings(config.Peers[0].AllowedIPs))
+	}
+	equal(t, []UnsupportedSetting{
+		{6, "connection", "autoconnect", "false"},
+		{20, "ipv4", "address1", "10.192.122.1/24,10.192.122.254"},
+	}, unsupported)
+
+	_, _, err = FromNetworkManager("[connection]\nid=Office VPN\ntype=wireguard\n\n[wireguard]\nprivate-key-flags=1\n")
+	if e, ok := err.(*ParseError); !ok || e.Code != ParseErrorInvalidName {
+		t.Errorf("Expected an invalid name, got %v", err)
+	}
+}
+
+func TestToNetworkManager(t *testing.T) {
+	config, err := FromWgQuick(testExportInput, "wg0")
+	if !noError(t, err) {
+		return
+	}
+	for _, table := range []Table{{}, {Off: true}, {ID: 1234}} {
+		config.Interface.Table = table
+		imported, unsupported, err := FromNetworkManager(config.ToNetworkManager())
+		if noError(t, err) {
+			equal(t, config, imported)
+			lenTest(t, unsupported, 0)
+		}
+	}
+
+	// Search domains are kept even without addresses, and with DNS servers of IPv6 only.
+	config.Interface.Table = Table{}
+	config.Interface.Addresses = nil
+	for _, dns := range [][]net.IP{nil, {net.ParseIP("2606:4700:4700::1111")}} {
+		config.Interface.DNS = dns
+		imported, _, err := FromNetworkManager(config.ToNetworkManager())
+		if noError(t, err) {
+			equal(t, []string{"example.com"}, imported.Interface.DNSSearch)
+		}
+	}
+}
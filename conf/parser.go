@@ -13,9 +13,64 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
+type ParseErrorCode int
+
+const (
+	ParseErrorInvalidValue ParseErrorCode = iota
+	ParseErrorInvalidKey
+	ParseErrorInvalidName
+	ParseErrorNotInSection
+	ParseErrorMissingEquals
+	ParseErrorMissingValue
+	ParseErrorMissingPrivateKey
+	ParseErrorMissingPublicKey
+	ParseErrorRuntime
+)
+
+func (code ParseErrorCode) String() string {
+	switch code {
+	case ParseErrorInvalidValue:
+		return "invalid-value"
+	case ParseErrorInvalidKey:
+		return "invalid-key"
+	case ParseErrorInvalidName:
+		return "invalid-name"
+	case ParseErrorNotInSection:
+		return "not-in-section"
+	case ParseErrorMissingEquals:
+		return "missing-equals"
+	case ParseErrorMissingValue:
+		return "missing-value"
+	case ParseErrorMissingPrivateKey:
+		return "missing-private-key"
+	case ParseErrorMissingPublicKey:
+		return "missing-public-key"
+	case ParseErrorRuntime:
+		return "runtime"
+	}
+	return fmt.Sprintf("unknown-%d", int(code))
+}
+
+// Sections are numbered from zero in the order of their [Peer] headers, with these two exceptions.
+const (
+	NoSection        = -2
+	InterfaceSection = -1
+)
+
+// A ParseError says what is wrong and where. Line counts from one, and is zero when the error is not
+// about any particular line. Column and EndColumn delimit the offending bytes of that line, counting
+// from zero. Key is the key as written in the input, if the error is about a key or its value.
 type ParseError struct {
+	Code      ParseErrorCode
+	Line      int
+	Column    int
+	EndColumn int
+	Section   int
+	Key       string
+
 	why      string
 	offender string
 }
@@ -24,6 +79,31 @@ func (e *ParseError) Error() string {
 	return fmt.Sprintf("%s: ‘%s’", e.why, e.offender)
 }
 
+// at places e on the given line of text, spanning the offender if it can be found at or after
+// column, and otherwise the rest of the line from column.
+func (e *ParseError) at(line int, text string, column int, section int, key string) *ParseError {
+	e.Line = line
+	e.Section = section
+	e.Key = key
+	e.Column = column
+	e.EndColumn = len(strings.TrimRightFunc(text, unicode.IsSpace))
+	if e.EndColumn < column {
+		e.EndColumn = column
+	}
+	if i := strings.Index(text[column:], e.offender); len(e.offender) > 0 && i >= 0 {
+		e.Column = column + i
+		e.EndColumn = e.Column + len(e.offender)
+	}
+	return e
+}
+
+func toParseError(err error, offender string) *ParseError {
+	if e, ok := err.(*ParseError); ok {
+		return e
+	}
+	return &ParseError{why: err.Error(), offender: offender}
+}
+
 func parseIPCidr(s string) (ipcidr *IPCidr, err error) {
 	var addrStr, cidrStr string
 	var cidr int
@@ -35,7 +115,7 @@ func parseIPCidr(s string) (ipcidr *IPCidr, err error) {
 		addrStr, cidrStr = s[:i], s[i+1:]
 	}
 
-	err = &ParseError{"Invalid IP address", s}
+	err = &ParseError{why: "Invalid IP address", offender: s}
 	addr := net.ParseIP(addrStr)
 	if addr == nil {
 		return
@@ -45,9 +125,10 @@ func parseIPCidr(s string) (ipcidr *IPCidr, err error) {
 		addr = maybeV4
 	}
 	if len(cidrStr) > 0 {
-		err = &ParseError{"Invalid network prefix length", s}
-		cidr, err = strconv.Atoi(cidrStr)
-		if err != nil || cidr < 0 || cidr > 128 {
+		err = &ParseError{why: "Invalid network prefix length", offender: s}
+		var atoiErr error
+		cidr, atoiErr = strconv.Atoi(cidrStr)
+		if atoiErr != nil || cidr < 0 || cidr > 128 {
 			return
 		}
 		if cidr > 32 && maybeV4 != nil {
@@ -66,11 +147,11 @@ func parseIPCidr(s string) (ipcidr *IPCidr, err error) {
 func parseEndpoint(s string) (*Endpoint, error) {
 	i := strings.LastIndexByte(s, ':')
 	if i < 0 {
-		return nil, &ParseError{"Missing port from endpoint", s}
+		return nil, &ParseError{why: "Missing port from endpoint", offender: s}
 	}
 	host, portStr := s[:i], s[i+1:]
 	if len(host) < 1 {
-		return nil, &ParseError{"Invalid endpoint host", host}
+		return nil, &ParseError{why: "Invalid endpoint host", offender: host}
 	}
 	port, err := parsePort(portStr)
 	if err != nil {
@@ -78,7 +159,7 @@ func parseEndpoint(s string) (*Endpoint, error) {
 	}
 	hostColon := strings.IndexByte(host, ':')
 	if host[0] == '[' || host[len(host)-1] == ']' || hostColon > 0 {
-		err := &ParseError{"Brackets must contain an IPv6 address", host}
+		err := &ParseError{why: "Brackets must contain an IPv6 address", offender: host}
 		if len(host) > 3 && host[0] == '[' && host[len(host)-1] == ']' && hostColon > 0 {
 			end := len(host) - 1
 			if i := strings.LastIndexByte(host, '%'); i > 1 {
@@ -98,22 +179,16 @@ func parseEndpoint(s string) (*Endpoint, error) {
 
 func parseMTU(s string) (uint16, error) {
 	m, err := strconv.Atoi(s)
-	if err != nil {
-		return 0, err
-	}
-	if m < 576 || m > 65535 {
-		return 0, &ParseError{"Invalid MTU", s}
+	if err != nil || m < 576 || m > 65535 {
+		return 0, &ParseError{why: "Invalid MTU", offender: s}
 	}
 	return uint16(m), nil
 }
 
 func parsePort(s string) (uint16, error) {
 	m, err := strconv.Atoi(s)
-	if err != nil {
-		return 0, err
-	}
-	if m < 0 || m > 65535 {
-		return 0, &ParseError{"Invalid port", s}
+	if err != nil || m < 0 || m > 65535 {
+		return 0, &ParseError{why: "Invalid port", offender: s}
 	}
 	return uint16(m), nil
 }
@@ -123,22 +198,44 @@ func parsePersistentKeepalive(s string) (uint16, error) {
 		return 0, nil
 	}
 	m, err := strconv.Atoi(s)
+	if err != nil || m < 0 || m > 65535 {
+		return 0, &ParseError{why: "Invalid persistent keepalive", offender: s}
+	}
+	return uint16(m), nil
+}
+
+func parseFwMark(s string) (uint32, error) {
+	if s == "off" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(s, 0, 32)
 	if err != nil {
-		return 0, err
+		return 0, &ParseError{why: "Invalid fwmark", offender: s}
+	}
+	return uint32(m), nil
+}
+
+func parseTable(s string) (*Table, error) {
+	switch s {
+	case "off":
+		return &Table{Off: true}, nil
+	case "auto":
+		return &Table{}, nil
 	}
-	if m < 0 || m > 65535 {
-		return 0, &ParseError{"Invalid persistent keepalive", s}
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || id == 0 {
+		return nil, &ParseError{why: "Table must be off, auto, or a number between 1 and 2^32-1", offender: s}
 	}
-	return uint16(m), nil
+	return &Table{ID: uint32(id)}, nil
 }
 
 func parseKeyBase64(s string) (*Key, error) {
 	k, err := base64.StdEncoding.DecodeString(s)
 	if err != nil {
-		return nil, &ParseError{"Invalid key: " + err.Error(), s}
+		return nil, &ParseError{why: "Invalid key: " + err.Error(), offender: s}
 	}
 	if len(k) != KeyLength {
-		return nil, &ParseError{"Keys must decode to exactly 32 bytes", s}
+		return nil, &ParseError{why: "Keys must decode to exactly 32 bytes", offender: s}
 	}
 	var key Key
 	copy(key[:], k)
@@ -148,10 +245,10 @@ func parseKeyBase64(s string) (*Key, error) {
 func parseKeyHex(s string) (*Key, error) {
 	k, err := hex.DecodeString(s)
 	if err != nil {
-		return nil, &ParseError{"Invalid key: " + err.Error(), s}
+		return nil, &ParseError{why: "Invalid key: " + err.Error(), offender: s}
 	}
 	if len(k) != KeyLength {
-		return nil, &ParseError{"Keys must decode to exactly 32 bytes", s}
+		return nil, &ParseError{why: "Keys must decode to exactly 32 bytes", offender: s}
 	}
 	var key Key
 	copy(key[:], k)
@@ -161,7 +258,7 @@ func parseKeyHex(s string) (*Key, error) {
 func parseBytesOrStamp(s string) (uint64, error) {
 	b, err := strconv.ParseUint(s, 10, 64)
 	if err != nil {
-		return 0, &ParseError{"Number must be a number between 0 and 2^64-1: " + err.Error(), s}
+		return 0, &ParseError{why: "Number must be a number between 0 and 2^64-1: " + err.Error(), offender: s}
 	}
 	return b, nil
 }
@@ -171,7 +268,7 @@ func splitList(s string) ([]string, error) {
 	for _, split := range strings.Split(s, ",") {
 		trim := strings.TrimSpace(split)
 		if len(trim) == 0 {
-			return nil, &ParseError{"Two commas in a row", s}
+			return nil, &ParseError{why: "Two commas in a row", offender: s}
 		}
 		out = append(out, trim)
 	}
@@ -192,20 +289,152 @@ func (c *Config) maybeAddPeer(p *Peer) {
 	}
 }
 
+func parseInterfaceKey(iface *Interface, key, val string) error {
+	switch strings.ToLower(key) {
+	case "privatekey":
+		k, err := parseKeyBase64(val)
+		if err != nil {
+			return err
+		}
+		iface.PrivateKey = *k
+	case "listenport":
+		p, err := parsePort(val)
+		if err != nil {
+			return err
+		}
+		iface.ListenPort = p
+	case "mtu":
+		m, err := parseMTU(val)
+		if err != nil {
+			return err
+		}
+		iface.MTU = m
+	case "address":
+		addresses, err := splitList(val)
+		if err != nil {
+			return err
+		}
+		for _, address := range addresses {
+			a, err := parseIPCidr(address)
+			if err != nil {
+				return err
+			}
+			iface.Addresses = append(iface.Addresses, *a)
+		}
+	case "dns":
+		addresses, err := splitList(val)
+		if err != nil {
+			return err
+		}
+		for _, address := range addresses {
+			a := net.ParseIP(address)
+			if a == nil {
+				iface.DNSSearch = append(iface.DNSSearch, address)
+			} else {
+				iface.DNS = append(iface.DNS, a)
+			}
+		}
+	case "fwmark":
+		m, err := parseFwMark(val)
+		if err != nil {
+			return err
+		}
+		iface.FwMark = m
+	case "table":
+		table, err := parseTable(val)
+		if err != nil {
+			return err
+		}
+		iface.Table = *table
+	case "preup":
+		iface.PreUp = append(iface.PreUp, val)
+	case "postup":
+		iface.PostUp = append(iface.PostUp, val)
+	case "predown":
+		iface.PreDown = append(iface.PreDown, val)
+	case "postdown":
+		iface.PostDown = append(iface.PostDown, val)
+	default:
+		return &ParseError{why: "Invalid key for [Interface] section", offender: key, Code: ParseErrorInvalidKey}
+	}
+	return nil
+}
+
+func parsePeerKey(peer *Peer, key, val string) error {
+	switch strings.ToLower(key) {
+	case "publickey":
+		k, err := parseKeyBase64(val)
+		if err != nil {
+			return err
+		}
+		peer.PublicKey = *k
+	case "presharedkey":
+		k, err := parseKeyBase64(val)
+		if err != nil {
+			return err
+		}
+		peer.PresharedKey = *k
+	case "allowedips":
+		addresses, err := splitList(val)
+		if err != nil {
+			return err
+		}
+		for _, address := range addresses {
+			a, err := parseIPCidr(address)
+			if err != nil {
+				return err
+			}
+			peer.AllowedIPs = append(peer.AllowedIPs, *a)
+		}
+	case "persistentkeepalive":
+		p, err := parsePersistentKeepalive(val)
+		if err != nil {
+			return err
+		}
+		peer.PersistentKeepalive = p
+	case "endpoint":
+		e, err := parseEndpoint(val)
+		if err != nil {
+			return err
+		}
+		peer.Endpoint = *e
+	default:
+		return &ParseError{why: "Invalid key for [Peer] section", offender: key, Code: ParseErrorInvalidKey}
+	}
+	return nil
+}
+
 func FromWgQuick(s string, name string) (*Config, error) {
+	conf, errs := FromWgQuickBestEffort(s, name)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return conf, nil
+}
+
+// FromWgQuickBestEffort keeps going past errors, and returns every one of them, in the order of the
+// input, together with whatever could be parsed. Lines with errors are skipped, but peers without a
+// public key are kept, so that the indices of peers match their sections.
+func FromWgQuickBestEffort(s string, name string) (*Config, []*ParseError) {
+	var errs []*ParseError
 	if !TunnelNameIsValid(name) {
-		return nil, &ParseError{"Tunnel name is not valid", name}
+		errs = append(errs, &ParseError{why: "Tunnel name is not valid", offender: name, Code: ParseErrorInvalidName, Section: NoSection})
 	}
 	lines := strings.Split(s, "\n")
 	parserState := notInASection
 	conf := Config{Name: name}
 	sawPrivateKey := false
+	interfaceLine := 0
+	var peerLines []int
 	var peer *Peer
-	for _, line := range lines {
+	for i, text := range lines {
+		lineNumber := i + 1
+		line := text
 		pound := strings.IndexByte(line, '#')
 		if pound >= 0 {
 			line = line[:pound]
 		}
+		indent := len(line) - len(strings.TrimLeftFunc(line, unicode.IsSpace))
 		line = strings.TrimSpace(line)
 		lineLower := strings.ToLower(line)
 		if len(line) == 0 {
@@ -213,129 +442,86 @@ func FromWgQuick(s string, name string) (*Config, error) {
 		}
 		if lineLower == "[interface]" {
 			conf.maybeAddPeer(peer)
+			peer = nil
 			parserState = inInterfaceSection
+			if interfaceLine == 0 {
+				interfaceLine = lineNumber
+			}
 			continue
 		}
 		if lineLower == "[peer]" {
 			conf.maybeAddPeer(peer)
 			peer = &Peer{}
 			parserState = inPeerSection
+			peerLines = append(peerLines, lineNumber)
 			continue
 		}
+		section := InterfaceSection
+		if parserState == notInASection {
+			section = NoSection
+		} else if parserState == inPeerSection {
+			section = len(peerLines) - 1
+		}
 		if parserState == notInASection {
-			return nil, &ParseError{"Line must occur in a section", line}
+			errs = append(errs, (&ParseError{why: "Line must occur in a section", offender: line, Code: ParseErrorNotInSection}).at(lineNumber, text, indent, section, ""))
+			continue
 		}
 		equals := strings.IndexByte(line, '=')
 		if equals < 0 {
-			return nil, &ParseError{"Invalid config key is missing an equals separator", line}
+			errs = append(errs, (&ParseError{why: "Invalid config key is missing an equals separator", offender: line, Code: ParseErrorMissingEquals}).at(lineNumber, text, indent, section, ""))
+			continue
 		}
-		key, val := strings.TrimSpace(lineLower[:equals]), strings.TrimSpace(line[equals+1:])
+		key, val := strings.TrimSpace(line[:equals]), strings.TrimSpace(line[equals+1:])
 		if len(val) == 0 {
-			return nil, &ParseError{"Key must have a value", line}
+			errs = append(errs, (&ParseError{why: "Key must have a value", offender: line, Code: ParseErrorMissingValue}).at(lineNumber, text, indent, section, key))
+			continue
 		}
+		var err error
 		if parserState == inInterfaceSection {
-			switch key {
-			case "privatekey":
-				k, err := parseKeyBase64(val)
-				if err != nil {
-					return nil, err
-				}
-				conf.Interface.PrivateKey = *k
+			err = parseInterfaceKey(&conf.Interface, key, val)
+			if err == nil && strings.ToLower(key) == "privatekey" {
 				sawPrivateKey = true
-			case "listenport":
-				p, err := parsePort(val)
-				if err != nil {
-					return nil, err
-				}
-				conf.Interface.ListenPort = p
-			case "mtu":
-				m, err := parseMTU(val)
-				if err != nil {
-					return nil, err
-				}
-				conf.Interface.MTU = m
-			case "address":
-				addresses, err := splitList(val)
-				if err != nil {
-					return nil, err
-				}
-				for _, address := range addresses {
-					a, err := parseIPCidr(address)
-					if err != nil {
-						return nil, err
-					}
-					conf.Interface.Addresses = append(conf.Interface.Addresses, *a)
-				}
-			case "dns":
-				addresses, err := splitList(val)
-				if err != nil {
-					return nil, err
-				}
-				for _, address := range addresses {
-					a := net.ParseIP(address)
-					if a == nil {
-						return nil, &ParseError{"Invalid IP address", address}
-					}
-					conf.Interface.DNS = append(conf.Interface.DNS, a)
-				}
-			default:
-				return nil, &ParseError{"Invalid key for [Interface] section", key}
 			}
 		} else if parserState == inPeerSection {
-			switch key {
-			case "publickey":
-				k, err := parseKeyBase64(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.PublicKey = *k
-			case "presharedkey":
-				k, err := parseKeyBase64(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.PresharedKey = *k
-			case "allowedips":
-				addresses, err := splitList(val)
-				if err != nil {
-					return nil, err
-				}
-				for _, address := range addresses {
-					a, err := parseIPCidr(address)
-					if err != nil {
-						return nil, err
-					}
-					peer.AllowedIPs = append(peer.AllowedIPs, *a)
-				}
-			case "persistentkeepalive":
-				p, err := parsePersistentKeepalive(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.PersistentKeepalive = p
-			case "endpoint":
-				e, err := parseEndpoint(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.Endpoint = *e
-			default:
-				return nil, &ParseError{"Invalid key for [Peer] section", key}
+			err = parsePeerKey(peer, key, val)
+		}
+		if err != nil {
+			e := toParseError(err, val)
+			column := indent + equals + 1
+			if e.Code == ParseErrorInvalidKey {
+				column = indent
 			}
+			errs = append(errs, e.at(lineNumber, text, column, section, key))
 		}
 	}
 	conf.maybeAddPeer(peer)
 
 	if !sawPrivateKey {
-		return nil, &ParseError{"An interface must have a private key", "[none specified]"}
+		e := &ParseError{why: "An interface must have a private key", offender: "[none specified]", Code: ParseErrorMissingPrivateKey, Section: InterfaceSection, Key: "PrivateKey"}
+		if interfaceLine > 0 {
+			e.Line = interfaceLine
+			e.Column, e.EndColumn = sectionHeaderColumns(lines[interfaceLine-1])
+		}
+		errs = append(errs, e)
 	}
-	for _, p := range conf.Peers {
+	for i, p := range conf.Peers {
 		if p.PublicKey.IsZero() {
-			return nil, &ParseError{"All peers must have public keys", "[none specified]"}
+			e := &ParseError{why: "All peers must have public keys", offender: "[none specified]", Code: ParseErrorMissingPublicKey, Section: i, Key: "PublicKey", Line: peerLines[i]}
+			e.Column, e.EndColumn = sectionHeaderColumns(lines[peerLines[i]-1])
+			errs = append(errs, e)
 		}
 	}
 
-	return &conf, nil
+	return &conf, errs
+}
+
+func sectionHeaderColumns(text string) (int, int) {
+	start := strings.IndexByte(text, '[')
+	end := strings.IndexByte(text, ']')
+	if start < 0 || end < start {
+		return 0, len(text)
+	}
+	return start, end + 1
 }
 
 func FromUAPI(s string, existingConfig *Config) (*Config, error) {
@@ -346,120 +532,156 @@ func FromUAPI(s string, existingConfig *Config) (*Config, error) {
 		Interface: Interface{
 			Addresses: existingConfig.Interface.Addresses,
 			DNS:       existingConfig.Interface.DNS,
+			DNSSearch: existingConfig.Interface.DNSSearch,
 			MTU:       existingConfig.Interface.MTU,
+			Table:     existingConfig.Interface.Table,
+			PreUp:     existingConfig.Interface.PreUp,
+			PostUp:    existingConfig.Interface.PostUp,
+			PreDown:   existingConfig.Interface.PreDown,
+			PostDown:  existingConfig.Interface.PostDown,
 		},
 	}
 	var peer *Peer
-	for _, line := range lines {
+	peers := 0
+	for i, line := range lines {
 		if len(line) == 0 {
 			continue
 		}
+		lineNumber := i + 1
+		section := InterfaceSection
+		if parserState == inPeerSection {
+			section = peers - 1
+		}
 		equals := strings.IndexByte(line, '=')
 		if equals < 0 {
-			return nil, &ParseError{"Invalid config key is missing an equals separator", line}
+			return nil, (&ParseError{why: "Invalid config key is missing an equals separator", offender: line, Code: ParseErrorMissingEquals}).at(lineNumber, line, 0, section, "")
 		}
 		key, val := line[:equals], line[equals+1:]
 		if len(val) == 0 {
-			return nil, &ParseError{"Key must have a value", line}
+			return nil, (&ParseError{why: "Key must have a value", offender: line, Code: ParseErrorMissingValue}).at(lineNumber, line, 0, section, key)
 		}
 		switch key {
 		case "public_key":
 			conf.maybeAddPeer(peer)
 			peer = &Peer{}
 			parserState = inPeerSection
+			section = peers
+			peers++
 		case "errno":
 			if val == "0" {
 				continue
 			} else {
-				return nil, &ParseError{"Error in getting configuration", val}
+				return nil, (&ParseError{why: "Error in getting configuration", offender: val, Code: ParseErrorRuntime}).at(lineNumber, line, equals+1, section, key)
 			}
 		}
+		var err error
 		if parserState == inInterfaceSection {
-			switch key {
-			case "private_key":
-				k, err := parseKeyHex(val)
-				if err != nil {
-					return nil, err
-				}
-				conf.Interface.PrivateKey = *k
-			case "listen_port":
-				p, err := parsePort(val)
-				if err != nil {
-					return nil, err
-				}
-				conf.Interface.ListenPort = p
-			case "fwmark":
-				// Ignored for now.
-
-			default:
-				return nil, &ParseError{"Invalid key for interface section", key}
-			}
+			err = parseUAPIInterfaceKey(&conf.Interface, key, val)
 		} else if parserState == inPeerSection {
-			switch key {
-			case "public_key":
-				k, err := parseKeyHex(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.PublicKey = *k
-			case "preshared_key":
-				k, err := parseKeyHex(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.PresharedKey = *k
-			case "protocol_version":
-				if val != "1" {
-					return nil, &ParseError{"Protocol version must be 1", val}
-				}
-			case "allowed_ip":
-				a, err := parseIPCidr(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.AllowedIPs = append(peer.AllowedIPs, *a)
-			case "persistent_keepalive_interval":
-				p, err := parsePersistentKeepalive(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.PersistentKeepalive = p
-			case "endpoint":
-				e, err := parseEndpoint(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.Endpoint = *e
-			case "tx_bytes":
-				b, err := parseBytesOrStamp(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.TxBytes = Bytes(b)
-			case "rx_bytes":
-				b, err := parseBytesOrStamp(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.RxBytes = Bytes(b)
-			case "last_handshake_time_sec":
-				t, err := parseBytesOrStamp(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.LastHandshakeTime += HandshakeTime(time.Duration(t) * time.Second)
-			case "last_handshake_time_nsec":
-				t, err := parseBytesOrStamp(val)
-				if err != nil {
-					return nil, err
-				}
-				peer.LastHandshakeTime += HandshakeTime(time.Duration(t) * time.Nanosecond)
-			default:
-				return nil, &ParseError{"Invalid key for peer section", key}
+			err = parseUAPIPeerKey(peer, key, val)
+		}
+		if err != nil {
+			e := toParseError(err, val)
+			column := equals + 1
+			if e.Code == ParseErrorInvalidKey {
+				column = 0
 			}
+			return nil, e.at(lineNumber, line, column, section, key)
 		}
 	}
 	conf.maybeAddPeer(peer)
 
 	return &conf, nil
 }
+
+func parseUAPIInterfaceKey(iface *Interface, key, val string) error {
+	switch key {
+	case "private_key":
+		k, err := parseKeyHex(val)
+		if err != nil {
+			return err
+		}
+		iface.PrivateKey = *k
+	case "listen_port":
+		p, err := parsePort(val)
+		if err != nil {
+			return err
+		}
+		iface.ListenPort = p
+	case "fwmark":
+		m, err := parseFwMark(val)
+		if err != nil {
+			return err
+		}
+		iface.FwMark = m
+	default:
+		return &ParseError{why: "Invalid key for interface section", offender: key, Code: ParseErrorInvalidKey}
+	}
+	return nil
+}
+
+func parseUAPIPeerKey(peer *Peer, key, val string) error {
+	switch key {
+	case "public_key":
+		k, err := parseKeyHex(val)
+		if err != nil {
+			return err
+		}
+		peer.PublicKey = *k
+	case "preshared_key":
+		k, err := parseKeyHex(val)
+		if err != nil {
+			return err
+		}
+		peer.PresharedKey = *k
+	case "protocol_version":
+		if val != "1" {
+			return &ParseError{why: "Protocol version must be 1", offender: val}
+		}
+	case "allowed_ip":
+		a, err := parseIPCidr(val)
+		if err != nil {
+			return err
+		}
+		peer.AllowedIPs = append(peer.AllowedIPs, *a)
+	case "persistent_keepalive_interval":
+		p, err := parsePersistentKeepalive(val)
+		if err != nil {
+			return err
+		}
+		peer.PersistentKeepalive = p
+	case "endpoint":
+		e, err := parseEndpoint(val)
+		if err != nil {
+			return err
+		}
+		peer.Endpoint = *e
+	case "tx_bytes":
+		b, err := parseBytesOrStamp(val)
+		if err != nil {
+			return err
+		}
+		peer.TxBytes = Bytes(b)
+	case "rx_bytes":
+		b, err := parseBytesOrStamp(val)
+		if err != nil {
+			return err
+		}
+		peer.RxBytes = Bytes(b)
+	case "last_handshake_time_sec":
+		t, err := parseBytesOrStamp(val)
+		if err != nil {
+			return err
+		}
+		peer.LastHandshakeTime += HandshakeTime(time.Duration(t) * time.Second)
+	case "last_handshake_time_nsec":
+		t, err := parseBytesOrStamp(val)
+		if err != nil {
+			return err
+		}
+		peer.LastHandshakeTime += HandshakeTime(time.Duration(t) * time.Nanosecond)
+	default:
+		return &ParseError{why: "Invalid key for peer section", offender: key, Code: ParseErrorInvalidKey}
+	}
+	return nil
+}
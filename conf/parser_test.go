@@ -79,8 +79,8 @@ func TestFromWgQuick(t *testing.T) {
 	if noError(t, err) {
 
 		lenTest(t, conf.Interface.Addresses, 2)
-		contains(t, conf.Interface.Addresses, IPCidr{net.IPv4(10, 10, 0, 1), uint8(16)})
-		contains(t, conf.Interface.Addresses, IPCidr{net.IPv4(10, 192, 122, 1), uint8(24)})
+		contains(t, conf.Interface.Addresses, IPCidr{net.IPv4(10, 10, 0, 1).To4(), uint8(16)})
+		contains(t, conf.Interface.Addresses, IPCidr{net.IPv4(10, 192, 122, 1).To4(), uint8(24)})
 		equal(t, "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=", conf.Interface.PrivateKey.String())
 		equal(t, uint16(51820), conf.Interface.ListenPort)
 
@@ -126,3 +126,191 @@ func TestParseEndpoint(t *testing.T) {
 		t.Error("Error was expected")
 	}
 }
+
+func TestScriptHooks(t *testing.T) {
+	input := testInput + `
+[Interface]
+PreUp = echo one
+PreUp = echo two
+PostUp = route add 10.0.0.0 mask 255.0.0.0 10.192.122.1
+PreDown = echo pre-down
+PostDown = echo post-down`
+	conf, err := FromWgQuick(input, "test")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, []string{"echo one", "echo two"}, conf.Interface.PreUp)
+	equal(t, []string{"route add 10.0.0.0 mask 255.0.0.0 10.192.122.1"}, conf.Interface.PostUp)
+	equal(t, []string{"echo pre-down"}, conf.Interface.PreDown)
+	equal(t, []string{"echo post-down"}, conf.Interface.PostDown)
+
+	again, err := FromWgQuick(conf.ToWgQuick(), "test")
+	if noError(t, err) {
+		equal(t, conf.Interface, again.Interface)
+	}
+}
+
+func TestParseTable(t *testing.T) {
+	table, err := parseTable("off")
+	if noError(t, err) {
+		equal(t, Table{Off: true}, *table)
+	}
+	table, err = parseTable("auto")
+	if noError(t, err) {
+		equal(t, true, table.IsAuto())
+	}
+	table, err = parseTable("1234")
+	if noError(t, err) {
+		equal(t, Table{ID: 1234}, *table)
+		equal(t, "1234", table.String())
+	}
+	for _, invalid := range []string{"0", "-1", "main", "4294967296"} {
+		_, err = parseTable(invalid)
+		if err == nil {
+			t.Errorf("Error was expected for table %q", invalid)
+		}
+	}
+
+	conf, err := FromWgQuick(testInput+"\n[Interface]\nTable = off", "test")
+	if noError(t, err) {
+		equal(t, true, conf.Interface.Table.Off)
+		again, err := FromWgQuick(conf.ToWgQuick(), "test")
+		if noError(t, err) {
+			equal(t, conf.Interface.Table, again.Interface.Table)
+		}
+	}
+}
+
+func TestDNSSearch(t *testing.T) {
+	input := testInput + `
+[Interface]
+DNS = 10.0.0.1, corp.example.com, 2001:db8::1, example.org`
+	conf, err := FromWgQuick(input, "test")
+	if !noError(t, err) {
+		return
+	}
+	lenTest(t, conf.Interface.DNS, 2)
+	equal(t, []string{"corp.example.com", "example.org"}, conf.Interface.DNSSearch)
+
+	again, err := FromWgQuick(conf.ToWgQuick(), "test")
+	if noError(t, err) {
+		equal(t, conf.Interface.DNSSearch, again.Interface.DNSSearch)
+		equal(t, conf.Interface.DNS, again.Interface.DNS)
+	}
+}
+
+func TestFwMark(t *testing.T) {
+	for input, expected := range map[string]uint32{"off": 0, "51820": 51820, "0xca6c": 0xca6c} {
+		m, err := parseFwMark(input)
+		if noError(t, err) {
+			equal(t, expected, m)
+		}
+	}
+	_, err := parseFwMark("0x100000000")
+	if err == nil {
+		t.Error("Error was expected")
+	}
+
+	conf, err := FromWgQuick(testInput+"\n[Interface]\nFwMark = 0x1234", "test")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, uint32(0x1234), conf.Interface.FwMark)
+	again, err := FromWgQuick(conf.ToWgQuick(), "test")
+	if noError(t, err) {
+		equal(t, conf.Interface.FwMark, again.Interface.FwMark)
+	}
+
+	runtimeConf, err := FromUAPI("private_key=c84dceca8b2d0ab6ff3aa8e2fd6ef5b62ec7e7da9a51a30eeac2bb45a6da3c0e\nlisten_port=51820\nfwmark=4660\nerrno=0\n", conf)
+	if noError(t, err) {
+		equal(t, uint32(0x1234), runtimeConf.Interface.FwMark)
+	}
+}
+
+func TestParseErrorLocation(t *testing.T) {
+	tests := []struct {
+		input     string
+		code      ParseErrorCode
+		line      int
+		column    int
+		endColumn int
+		section   int
+		key       string
+	}{
+		{"Address = 10.0.0.1/24", ParseErrorNotInSection, 1, 0, 21, NoSection, ""},
+		{"[Interface]\n  Bogus = 1", ParseErrorInvalidKey, 2, 2, 7, InterfaceSection, "Bogus"},
+		{"[Interface]\nAddress = 10.0.0.1/24, 10.0.0.2/33 # comment", ParseErrorInvalidValue, 2, 23, 34, InterfaceSection, "Address"},
+		{"[Interface]\nMTU =", ParseErrorMissingValue, 2, 0, 5, InterfaceSection, "MTU"},
+		{"[Interface]\nMTU", ParseErrorMissingEquals, 2, 0, 3, InterfaceSection, ""},
+		{"[Interface]\nListenPort = 1", ParseErrorMissingPrivateKey, 1, 0, 11, InterfaceSection, "PrivateKey"},
+		{testInput + "\n [Peer]\nEndpoint = 1.2.3.4:5", ParseErrorMissingPublicKey, 24, 1, 7, 3, "PublicKey"},
+		{testInput + "\nPersistentKeepalive = 70000", ParseErrorInvalidValue, 24, 22, 27, 2, "PersistentKeepalive"},
+	}
+	for _, test := range tests {
+		_, err := FromWgQuick(test.input, "test")
+		e, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Expected a ParseError for %#q, got %v", test.input, err)
+			continue
+		}
+		equal(t, test.code, e.Code)
+		equal(t, test.line, e.Line)
+		equal(t, test.column, e.Column)
+		equal(t, test.endColumn, e.EndColumn)
+		equal(t, test.section, e.Section)
+		equal(t, test.key, e.Key)
+	}
+
+	_, err := FromWgQuick(testInput, "invalid name")
+	if e, ok := err.(*ParseError); !ok || e.Code != ParseErrorInvalidName {
+		t.Errorf("Expected an invalid name error, got %v", err)
+	}
+
+	_, err = FromUAPI("private_key=c84dceca8b2d0ab6ff3aa8e2fd6ef5b62ec7e7da9a51a30eeac2bb45a6da3c0e\npublic_key=c84dceca8b2d0ab6ff3aa8e2fd6ef5b62ec7e7da9a51a30eeac2bb45a6da3c0e\nallowed_ip=10.0.0.0/99\n", &Config{Name: "test"})
+	if e, ok := err.(*ParseError); ok {
+		equal(t, ParseErrorInvalidValue, e.Code)
+		equal(t, 3, e.Line)
+		equal(t, 11, e.Column)
+		equal(t, 22, e.EndColumn)
+		equal(t, 0, e.Section)
+		equal(t, "allowed_ip", e.Key)
+	} else {
+		t.Errorf("Expected a ParseError, got %v", err)
+	}
+}
+
+func TestFromWgQuickBestEffort(t *testing.T) {
+	input := `[Interface]
+Address = 10.0.0.1/24, 10.0.0.2/33
+MTU = 1420
+Bogus = 1
+
+[Peer]
+AllowedIPs = 10.0.1.0/24
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = nowhere
+PersistentKeepalive = 25
+`
+	conf, errs := FromWgQuickBestEffort(input, "test")
+	codes := make([]ParseErrorCode, len(errs))
+	lines := make([]int, len(errs))
+	for i, e := range errs {
+		codes[i] = e.Code
+		lines[i] = e.Line
+	}
+	equal(t, []ParseErrorCode{ParseErrorInvalidValue, ParseErrorInvalidKey, ParseErrorInvalidValue, ParseErrorMissingPrivateKey, ParseErrorMissingPublicKey}, codes)
+	equal(t, []int{2, 4, 11, 1, 6}, lines)
+	equal(t, uint16(1420), conf.Interface.MTU)
+	if lenTest(t, conf.Peers, 2) {
+		lenTest(t, conf.Peers[0].AllowedIPs, 1)
+		equal(t, uint16(25), conf.Peers[1].PersistentKeepalive)
+	}
+
+	_, err := FromWgQuick(input, "test")
+	equal(t, errs[0], err)
+
+	_, errs = FromWgQuickBestEffort(testInput, "test")
+	lenTest(t, errs, 0)
+}
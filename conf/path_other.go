@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var cachedConfigFileDir string
+var cachedRootDir string
+
+func tunnelConfigurationsDirectory() (string, error) {
+	if cachedConfigFileDir != "" {
+		return cachedConfigFileDir, nil
+	}
+	root, err := RootDirectory()
+	if err != nil {
+		return "", err
+	}
+	c := filepath.Join(root, "Configurations")
+	err = os.MkdirAll(c, os.ModeDir|0700)
+	if err != nil {
+		return "", err
+	}
+	cachedConfigFileDir = c
+	return cachedConfigFileDir, nil
+}
+
+// RootDirectory is in the XDG configuration directory of the user, where there is no equivalent of
+// the local application data folder of Windows.
+func RootDirectory() (string, error) {
+	if cachedRootDir != "" {
+		return cachedRootDir, nil
+	}
+	root := os.Getenv("XDG_CONFIG_HOME")
+	if len(root) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		root = filepath.Join(home, ".config")
+	}
+	if !filepath.IsAbs(root) {
+		return "", errors.New("Unable to determine configuration directory")
+	}
+	c := filepath.Join(root, "WireGuard")
+	err := os.MkdirAll(c, os.ModeDir|0700)
+	if err != nil {
+		return "", err
+	}
+	cachedRootDir = c
+	return cachedRootDir, nil
+}
@@ -0,0 +1,126 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+type Route struct {
+	Destination IPCidr
+	NextHop     net.IP
+	Metric      uint32
+}
+
+func (r *Route) String() string {
+	return r.Destination.String() + " via " + r.NextHop.String()
+}
+
+func compareRoutes(a, b *Route) int {
+	if a.Destination.Bits() != b.Destination.Bits() {
+		if a.Destination.Bits() < b.Destination.Bits() {
+			return -1
+		}
+		return 1
+	}
+	if c := bytes.Compare(a.Destination.IP.To16(), b.Destination.IP.To16()); c != 0 {
+		return c
+	}
+	if a.Destination.Cidr != b.Destination.Cidr {
+		if a.Destination.Cidr < b.Destination.Cidr {
+			return -1
+		}
+		return 1
+	}
+	if c := bytes.Compare(a.NextHop.To16(), b.NextHop.To16()); c != 0 {
+		return c
+	}
+	if a.Metric != b.Metric {
+		if a.Metric < b.Metric {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// mergeDestinations normalizes destinations, except that the two halves of an address family are not
+// merged into a default route unless one was given, since a pair of halves is how a tunnel takes
+// over from the default route of another interface without replacing it.
+func mergeDestinations(destinations []IPCidr) (merged []IPCidr) {
+	set := NewCIDRSet(destinations...)
+	hasDefaultRoute := make(map[uint8]bool, 2)
+	for i := range destinations {
+		if destinations[i].IP != nil && destinations[i].Cidr == 0 {
+			hasDefaultRoute[destinations[i].Bits()] = true
+		}
+	}
+	for _, halves := range [][2]IPCidr{
+		{{IP: net.IP{0, 0, 0, 0}, Cidr: 1}, {IP: net.IP{128, 0, 0, 0}, Cidr: 1}},
+		{{IP: net.ParseIP("::"), Cidr: 1}, {IP: net.ParseIP("8000::"), Cidr: 1}},
+	} {
+		if hasDefaultRoute[halves[0].Bits()] {
+			merged = append(merged, set.Intersect(NewCIDRSet(halves[:]...)).CIDRs()...)
+			continue
+		}
+		for _, half := range halves {
+			merged = append(merged, set.Intersect(NewCIDRSet(half)).CIDRs()...)
+		}
+	}
+	return
+}
+
+// PlanRoutes returns the routes that the tunnel interface needs: one to the network of each address,
+// through that network's own address, and one for each allowed IP, through the network of the first
+// address of its family. Allowed IPs of a family without addresses are left out, as is everything
+// when Table is off. Allowed IPs are merged into the fewest prefixes, while the routes to the networks
+// of addresses are kept as they are, so that those stay more specific than a route that covers them.
+// The result is sorted, so that the same configuration always gives the same routes.
+func PlanRoutes(config *Config) []Route {
+	if config.Interface.Table.Off {
+		return nil
+	}
+
+	var routes []Route
+	gateways := make(map[uint8]net.IP, 2)
+	for i := range config.Interface.Addresses {
+		address := &config.Interface.Addresses[i]
+		if address.IP == nil {
+			continue
+		}
+		gateway := address.masked()
+		if gateways[address.Bits()] == nil {
+			gateways[address.Bits()] = gateway
+		}
+		routes = append(routes, Route{Destination: IPCidr{IP: gateway, Cidr: address.Cidr}, NextHop: gateway})
+	}
+
+	var allowedIPs []IPCidr
+	for i := range config.Peers {
+		for j := range config.Peers[i].AllowedIPs {
+			allowedIP := &config.Peers[i].AllowedIPs[j]
+			if allowedIP.IP != nil && gateways[allowedIP.Bits()] != nil {
+				allowedIPs = append(allowedIPs, *allowedIP)
+			}
+		}
+	}
+	for _, destination := range mergeDestinations(allowedIPs) {
+		routes = append(routes, Route{Destination: destination, NextHop: gateways[destination.Bits()]})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		return compareRoutes(&routes[i], &routes[j]) < 0
+	})
+	deduplicated := routes[:0]
+	for i := range routes {
+		if len(deduplicated) == 0 || compareRoutes(&deduplicated[len(deduplicated)-1], &routes[i]) != 0 {
+			deduplicated = append(deduplicated, routes[i])
+		}
+	}
+	return deduplicated
+}
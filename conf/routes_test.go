@@ -0,0 +1,106 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"testing"
+)
+
+func routeStrings(routes []Route) (out []string) {
+	for i := range routes {
+		out = append(out, routes[i].String())
+	}
+	return
+}
+
+func TestPlanRoutes(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses string
+		peers     []string
+		routes    []string
+	}{
+		{
+			"no addresses",
+			"",
+			[]string{"0.0.0.0/0, ::/0"},
+			nil,
+		},
+		{
+			"single peer",
+			"10.0.0.2/24",
+			[]string{"10.0.0.0/24, 192.168.1.0/24"},
+			[]string{"10.0.0.0/24 via 10.0.0.0", "192.168.1.0/24 via 10.0.0.0"},
+		},
+		{
+			"duplicates and contained prefixes",
+			"10.0.0.2/24",
+			[]string{"192.168.1.0/24, 192.168.1.7/32", "192.168.0.0/16, 192.168.1.0/24"},
+			[]string{"10.0.0.0/24 via 10.0.0.0", "192.168.0.0/16 via 10.0.0.0"},
+		},
+		{
+			"adjacent prefixes",
+			"10.0.0.2/32",
+			[]string{"172.16.0.0/24, 172.16.1.0/24", "172.16.2.0/23, 172.16.5.0/24"},
+			[]string{"10.0.0.2/32 via 10.0.0.2", "172.16.0.0/22 via 10.0.0.2", "172.16.5.0/24 via 10.0.0.2"},
+		},
+		{
+			"halves stay halves",
+			"10.0.0.2/24, fd00::2/64",
+			[]string{"0.0.0.0/1, 128.0.0.0/1, ::/1, 8000::/1"},
+			[]string{"0.0.0.0/1 via 10.0.0.0", "10.0.0.0/24 via 10.0.0.0", "128.0.0.0/1 via 10.0.0.0", "::/1 via fd00::", "8000::/1 via fd00::", "fd00::/64 via fd00::"},
+		},
+		{
+			"default route swallows the rest",
+			"10.0.0.2/24, fd00::2/64",
+			[]string{"0.0.0.0/0, 10.1.0.0/16", "0.0.0.0/1, ::/0"},
+			[]string{"0.0.0.0/0 via 10.0.0.0", "10.0.0.0/24 via 10.0.0.0", "::/0 via fd00::", "fd00::/64 via fd00::"},
+		},
+		{
+			"second address of a family",
+			"10.0.0.2/24, 10.9.0.2/16",
+			[]string{"10.9.0.0/16, 192.168.0.0/24"},
+			[]string{"10.0.0.0/24 via 10.0.0.0", "10.9.0.0/16 via 10.0.0.0", "10.9.0.0/16 via 10.9.0.0", "192.168.0.0/24 via 10.0.0.0"},
+		},
+		{
+			"family without an address",
+			"10.0.0.2/24",
+			[]string{"fd00::/8, 10.200.0.0/16"},
+			[]string{"10.0.0.0/24 via 10.0.0.0", "10.200.0.0/16 via 10.0.0.0"},
+		},
+		{
+			"unmasked allowed IPs",
+			"fd00::2/64",
+			[]string{"2001:db8::1/32, 2001:db9::/32"},
+			[]string{"2001:db8::/31 via fd00::", "fd00::/64 via fd00::"},
+		},
+	}
+	for _, test := range tests {
+		config := &Config{Interface: Interface{Addresses: cidrList(t, test.addresses)}}
+		for _, allowedIPs := range test.peers {
+			config.Peers = append(config.Peers, Peer{AllowedIPs: cidrList(t, allowedIPs)})
+		}
+		routes := PlanRoutes(config)
+		if !equal(t, test.routes, routeStrings(routes)) {
+			t.Logf("In test %q", test.name)
+		}
+
+		// The same routes, whatever the order of peers and allowed IPs.
+		for i, j := 0, len(config.Peers)-1; i < j; i, j = i+1, j-1 {
+			config.Peers[i], config.Peers[j] = config.Peers[j], config.Peers[i]
+		}
+		for i := range config.Peers {
+			allowedIPs := config.Peers[i].AllowedIPs
+			for j, k := 0, len(allowedIPs)-1; j < k; j, k = j+1, k-1 {
+				allowedIPs[j], allowedIPs[k] = allowedIPs[k], allowedIPs[j]
+			}
+		}
+		equal(t, routeStrings(routes), routeStrings(PlanRoutes(config)))
+
+		config.Interface.Table.Off = true
+		equal(t, 0, len(PlanRoutes(config)))
+	}
+}
@@ -6,24 +6,168 @@
 package conf
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"golang.zx2c4.com/wireguard/windows/conf/dpapi"
+	"sync"
+	"time"
 )
 
 const configFileSuffix = ".conf.dpapi"
 const configFileUnencryptedSuffix = ".conf"
 
-func ListConfigNames() ([]string, error) {
+// A ConfigStore keeps the configurations of tunnels by name. It holds documents rather than bare
+// configurations, so that comments and layout survive being loaded and saved again.
+type ConfigStore interface {
+	List() ([]string, error)
+	Load(name string) (*Document, error)
+	Save(doc *Document) error
+	Delete(name string) error
+	Rename(oldName, newName string) error
+
+	// Create saves doc only if there is no tunnel of its name yet, and Update only if the stored
+	// document has revisionToken, which is what RevisionToken gave for it when it was loaded.
+	Create(doc *Document) error
+	Update(doc *Document, revisionToken string) error
+
+	// LoadMetadata gives empty metadata for a tunnel that has none, and fails for a missing tunnel,
+	// as SaveMetadata does. Metadata goes along with its tunnel when it is renamed or deleted.
+	LoadMetadata(name string) (*Metadata, error)
+	SaveMetadata(name string, m *Metadata) error
+
+	// Revisions lists the saved versions of a tunnel's configuration, newest first, which is the one
+	// stored now. Saving adds a revision, and renaming keeps them, while deleting drops them too.
+	Revisions(name string) ([]Revision, error)
+	LoadRevision(name string, id string) (*Document, error)
+
+	// Watch calls cb once right away, and then whenever the store changes, until unregistered.
+	Watch(cb func()) *StoreCallback
+
+	// WatchEvents calls cb for every tunnel that is added, removed, modified or renamed from now on,
+	// until unregistered.
+	WatchEvents(cb func(event StoreEvent)) *StoreCallback
+}
+
+func LoadConfig(store ConfigStore, name string) (*Config, error) {
+	doc, err := store.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Config()
+}
+
+// SaveConfig writes config to store, keeping the comments and layout of the stored one, if there is one.
+func SaveConfig(store ConfigStore, config *Config) error {
+	if !TunnelNameIsValid(config.Name) {
+		return errors.New("Tunnel name is not valid")
+	}
+	doc, err := store.Load(config.Name)
+	if err != nil {
+		doc, err = ParseDocument(config.ToWgQuick(), config.Name)
+		if err != nil {
+			return err
+		}
+	} else if doc.Apply(config) != nil {
+		// Keeping the layout is only a nicety, so rather than refusing to save, the stored document is
+		// replaced with the canonical form of config.
+		doc, err = ParseDocument(config.ToWgQuick(), config.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return store.Save(doc)
+}
+
+// RevisionToken identifies the contents of doc, such that a document loaded from a store can be told
+// apart from whatever has been saved in its place since.
+func (doc *Document) RevisionToken() string {
+	hash := sha256.Sum256([]byte(doc.String()))
+	return hex.EncodeToString(hash[:])
+}
+
+func tunnelExistsError(name string) error {
+	return fmt.Errorf("Tunnel ‘%s’ already exists", name)
+}
+
+func revisionMismatchError(name string) error {
+	return fmt.Errorf("Tunnel ‘%s’ has been changed since it was loaded", name)
+}
+
+func checkDocumentForSaving(doc *Document) error {
+	if !TunnelNameIsValid(doc.Name) {
+		return errors.New("Tunnel name is not valid")
+	}
+	_, err := doc.Config()
+	return err
+}
+
+// A FileStore keeps each configuration encrypted in its own file in a directory.
+type FileStore struct {
+	dir       string
+	encryptor Encryptor
+	callbacks *storeCallbacks
+	lock      sync.Mutex
+
+	watchLock    sync.Mutex
+	watching     bool
+	watchStop    chan struct{}
+	lastSnapshot storeSnapshot
+	renames      map[string]string
+	debounce     *time.Timer
+}
+
+func NewFileStore(dir string, encryptor Encryptor) (*FileStore, error) {
+	err := os.MkdirAll(dir, os.ModeDir|0700)
+	if err != nil {
+		return nil, err
+	}
+	store := &FileStore{dir: dir, encryptor: encryptor, callbacks: newStoreCallbacks()}
+	store.callbacks.onEmpty = store.stopWatching
+	return store, nil
+}
+
+var defaultStore *FileStore
+var defaultStoreLock sync.Mutex
+
+// DefaultStore returns the store in the configurations directory, which the package level functions
+// use too.
+func DefaultStore() (*FileStore, error) {
+	defaultStoreLock.Lock()
+	defer defaultStoreLock.Unlock()
+	if defaultStore != nil {
+		return defaultStore, nil
+	}
+	encryptor, err := defaultStoreEncryptor()
+	if err != nil {
+		return nil, err
+	}
 	configFileDir, err := tunnelConfigurationsDirectory()
 	if err != nil {
 		return nil, err
 	}
-	files, err := ioutil.ReadDir(configFileDir)
+	defaultStore, err = NewFileStore(configFileDir, encryptor)
+	return defaultStore, err
+}
+
+func (store *FileStore) Directory() string {
+	return store.dir
+}
+
+// Path returns where the file of name is, whether or not it exists.
+func (store *FileStore) Path(name string) (string, error) {
+	if !TunnelNameIsValid(name) {
+		return "", errors.New("Tunnel name is not valid")
+	}
+	return filepath.Join(store.dir, name+configFileSuffix), nil
+}
+
+func (store *FileStore) List() ([]string, error) {
+	files, err := ioutil.ReadDir(store.dir)
 	if err != nil {
 		return nil, err
 	}
@@ -47,12 +191,239 @@ func ListConfigNames() ([]string, error) {
 	return configs[:i], nil
 }
 
-func MigrateUnencryptedConfigs() (int, []error) {
-	configFileDir, err := tunnelConfigurationsDirectory()
+func (store *FileStore) Load(name string) (*Document, error) {
+	path, err := store.Path(name)
 	if err != nil {
-		return 0, []error{err}
+		return nil, err
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if store.encryptor == nil {
+		return nil, errNoEncryptor
+	}
+	bytes, err = store.encryptor.Decrypt(bytes, name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDocument(string(bytes), name)
+}
+
+func (store *FileStore) Save(doc *Document) error {
+	store.lock.Lock()
+	err := store.save(doc)
+	store.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	store.rescan()
+	return nil
+}
+
+func (store *FileStore) Create(doc *Document) error {
+	store.lock.Lock()
+	err := store.create(doc)
+	store.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	store.rescan()
+	return nil
+}
+
+func (store *FileStore) create(doc *Document) error {
+	path, err := store.Path(doc.Name)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(path); err == nil {
+		return tunnelExistsError(doc.Name)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return store.save(doc)
+}
+
+func (store *FileStore) Update(doc *Document, revisionToken string) error {
+	store.lock.Lock()
+	err := store.update(doc, revisionToken)
+	store.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	store.rescan()
+	return nil
+}
+
+func (store *FileStore) update(doc *Document, revisionToken string) error {
+	current, err := store.Load(doc.Name)
+	if err != nil {
+		return err
+	}
+	if current.RevisionToken() != revisionToken {
+		return revisionMismatchError(doc.Name)
+	}
+	return store.save(doc)
+}
+
+func (store *FileStore) save(doc *Document) error {
+	err := checkDocumentForSaving(doc)
+	if err != nil {
+		return err
+	}
+	text := doc.String()
+	err = store.seedHistory(doc.Name, text)
+	if err != nil {
+		return err
+	}
+	err = store.writeFile(doc.Name, text)
+	if err != nil {
+		return err
+	}
+	return store.recordRevision(doc.Name, text)
+}
+
+func (store *FileStore) writeFile(name string, text string) error {
+	filename, err := store.Path(name)
+	if err != nil {
+		return err
+	}
+	if store.encryptor == nil {
+		return errNoEncryptor
+	}
+	bytes, err := store.encryptor.Encrypt([]byte(text), name)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filename+".tmp", bytes, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(filename+".tmp", filename)
+	if err != nil {
+		os.Remove(filename + ".tmp")
+		return err
+	}
+	return nil
+}
+
+func (store *FileStore) Delete(name string) error {
+	store.lock.Lock()
+	err := store.delete(name)
+	store.lock.Unlock()
+	store.rescan()
+	return err
+}
+
+func (store *FileStore) delete(name string) error {
+	path, err := store.Path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil {
+		return err
+	}
+	err = store.deleteMetadata(name)
+	if err != nil {
+		return err
+	}
+	return store.deleteHistory(name)
+}
+
+// Rename encrypts the configuration again under its new name, since the name is bound to it, and only
+// removes the old file once the new one is in place. Watchers see a single rename.
+func (store *FileStore) Rename(oldName, newName string) error {
+	err := store.rename(oldName, newName)
+	store.rescan()
+	return err
+}
+
+func (store *FileStore) rename(oldName, newName string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.watchLock.Lock()
+	defer store.watchLock.Unlock()
+	oldPath, err := store.Path(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := store.Path(newName)
+	if err != nil {
+		return err
 	}
-	files, err := ioutil.ReadDir(configFileDir)
+	if _, err = os.Stat(newPath); err == nil {
+		return tunnelExistsError(newName)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	doc, err := store.Load(oldName)
+	if err != nil {
+		return err
+	}
+	doc.Name = newName
+	metadata, err := store.LoadMetadata(oldName)
+	if err != nil {
+		return err
+	}
+	err = store.copyHistory(oldName, newName)
+	if err != nil {
+		return err
+	}
+	err = store.writeMetadata(newName, metadata)
+	if err == nil {
+		err = store.writeFile(newName, doc.String())
+	}
+	if err == nil {
+		err = os.Remove(oldPath)
+		if err != nil {
+			os.Remove(newPath)
+		}
+	}
+	if err != nil {
+		store.deleteMetadata(newName)
+		store.deleteHistory(newName)
+		return err
+	}
+	store.deleteMetadata(oldName)
+	store.deleteHistory(oldName)
+	if store.watching {
+		if store.renames == nil {
+			store.renames = make(map[string]string)
+		}
+		store.renames[newName] = oldName
+	}
+	return nil
+}
+
+func (store *FileStore) Watch(cb func()) *StoreCallback {
+	s := store.callbacks.register(cb, nil)
+	store.startWatching()
+	cb()
+	return s
+}
+
+func (store *FileStore) WatchEvents(cb func(event StoreEvent)) *StoreCallback {
+	s := store.callbacks.register(nil, cb)
+	store.startWatching()
+	return s
+}
+
+// MigrateUnencrypted encrypts the plain .conf files that have been dropped into the directory, and
+// removes them once they are stored. Those of tunnels that are already stored are left alone.
+func (store *FileStore) MigrateUnencrypted() (int, []error) {
+	store.lock.Lock()
+	migrated, errs := store.migrateUnencrypted()
+	store.lock.Unlock()
+	if migrated > 0 {
+		store.rescan()
+	}
+	return migrated, errs
+}
+
+func (store *FileStore) migrateUnencrypted() (int, []error) {
+	files, err := ioutil.ReadDir(store.dir)
 	if err != nil {
 		return 0, []error{err}
 	}
@@ -60,7 +431,7 @@ func MigrateUnencryptedConfigs() (int, []error) {
 	i := 0
 	e := 0
 	for _, file := range files {
-		path := filepath.Join(configFileDir, file.Name())
+		path := filepath.Join(store.dir, file.Name())
 		name := filepath.Base(file.Name())
 		if len(name) <= len(configFileUnencryptedSuffix) || !strings.HasSuffix(name, configFileUnencryptedSuffix) {
 			continue
@@ -91,14 +462,19 @@ func MigrateUnencryptedConfigs() (int, []error) {
 			continue
 		}
 
-		bytes, err = dpapi.Encrypt(bytes, strings.TrimSuffix(name, configFileUnencryptedSuffix))
+		if store.encryptor == nil {
+			errs[e] = errNoEncryptor
+			e++
+			continue
+		}
+		bytes, err = store.encryptor.Encrypt(bytes, strings.TrimSuffix(name, configFileUnencryptedSuffix))
 		if err != nil {
 			errs[e] = err
 			e++
 			continue
 		}
 		dstFile := strings.TrimSuffix(path, configFileUnencryptedSuffix) + configFileSuffix
-		if _, err = os.Stat(dstFile); err != nil && !os.IsNotExist(err) {
+		if _, err = os.Stat(dstFile); err == nil {
 			errs[e] = errors.New("Unable to migrate to " + dstFile + " as it already exists")
 			e++
 			continue
@@ -120,30 +496,76 @@ func MigrateUnencryptedConfigs() (int, []error) {
 	return i, errs[:e]
 }
 
+func ListConfigNames() ([]string, error) {
+	store, err := DefaultStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.List()
+}
+
+func MigrateUnencryptedConfigs() (int, []error) {
+	store, err := DefaultStore()
+	if err != nil {
+		return 0, []error{err}
+	}
+	return store.MigrateUnencrypted()
+}
+
 func LoadFromName(name string) (*Config, error) {
-	configFileDir, err := tunnelConfigurationsDirectory()
+	store, err := DefaultStore()
 	if err != nil {
 		return nil, err
 	}
-	return LoadFromPath(filepath.Join(configFileDir, name+configFileSuffix))
+	return LoadConfig(store, name)
 }
 
 func LoadFromPath(path string) (*Config, error) {
-	name, err := NameFromPath(path)
+	name, bytes, err := readConfigFile(path)
 	if err != nil {
 		return nil, err
 	}
-	bytes, err := ioutil.ReadFile(path)
+	return FromWgQuick(string(bytes), name)
+}
+
+func LoadDocumentFromName(name string) (*Document, error) {
+	store, err := DefaultStore()
 	if err != nil {
 		return nil, err
 	}
+	return store.Load(name)
+}
+
+func LoadDocumentFromPath(path string) (*Document, error) {
+	name, bytes, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDocument(string(bytes), name)
+}
+
+func readConfigFile(path string) (string, []byte, error) {
+	name, err := NameFromPath(path)
+	if err != nil {
+		return "", nil, err
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
 	if strings.HasSuffix(path, configFileSuffix) {
-		bytes, err = dpapi.Decrypt(bytes, name)
+		defaultStoreLock.Lock()
+		encryptor, err := defaultStoreEncryptor()
+		defaultStoreLock.Unlock()
+		if err != nil {
+			return "", nil, err
+		}
+		bytes, err = encryptor.Decrypt(bytes, name)
 		if err != nil {
-			return nil, err
+			return "", nil, err
 		}
 	}
-	return FromWgQuick(string(bytes), name)
+	return name, bytes, nil
 }
 
 func NameFromPath(path string) (string, error) {
@@ -163,52 +585,37 @@ func NameFromPath(path string) (string, error) {
 	return name, nil
 }
 
+// Save writes the configuration, keeping the comments and layout of the stored one, if there is one.
 func (config *Config) Save() error {
-	if !TunnelNameIsValid(config.Name) {
-		return errors.New("Tunnel name is not valid")
-	}
-	configFileDir, err := tunnelConfigurationsDirectory()
-	if err != nil {
-		return err
-	}
-	filename := filepath.Join(configFileDir, config.Name+configFileSuffix)
-	bytes := []byte(config.ToWgQuick())
-	bytes, err = dpapi.Encrypt(bytes, config.Name)
-	if err != nil {
-		return err
-	}
-	err = ioutil.WriteFile(filename+".tmp", bytes, 0600)
+	store, err := DefaultStore()
 	if err != nil {
 		return err
 	}
-	err = os.Rename(filename+".tmp", filename)
+	return SaveConfig(store, config)
+}
+
+func (doc *Document) Save() error {
+	store, err := DefaultStore()
 	if err != nil {
-		os.Remove(filename + ".tmp")
 		return err
 	}
-	return nil
+	return store.Save(doc)
 }
 
 func (config *Config) Path() (string, error) {
-	if !TunnelNameIsValid(config.Name) {
-		return "", errors.New("Tunnel name is not valid")
-	}
-	configFileDir, err := tunnelConfigurationsDirectory()
+	store, err := DefaultStore()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(configFileDir, config.Name+configFileSuffix), nil
+	return store.Path(config.Name)
 }
 
 func DeleteName(name string) error {
-	if !TunnelNameIsValid(name) {
-		return errors.New("Tunnel name is not valid")
-	}
-	configFileDir, err := tunnelConfigurationsDirectory()
+	store, err := DefaultStore()
 	if err != nil {
 		return err
 	}
-	return os.Remove(filepath.Join(configFileDir, name+configFileSuffix))
+	return store.Delete(name)
 }
 
 func (config *Config) Delete() error {
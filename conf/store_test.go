@@ -6,11 +6,39 @@
 package conf
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestStorage(t *testing.T) {
+	if _, err := defaultEncryptor(); err != nil {
+		dir, err := ioutil.TempDir("", "wgtest-keyfile")
+		if err != nil {
+			t.Errorf("Unable to create keyfile directory: %s", err.Error())
+			return
+		}
+		defer os.RemoveAll(dir)
+		e, err := NewKeyfileEncryptor(filepath.Join(dir, "keyfile"))
+		if err != nil {
+			t.Errorf("Unable to create keyfile encryptor: %s", err.Error())
+			return
+		}
+		if !noError(t, SetStoreEncryptor(e)) {
+			return
+		}
+		// The default store keeps the encryptor it was opened with, so it is forgotten along with it.
+		defer func() {
+			defaultStoreLock.Lock()
+			defaultStore = nil
+			storeEncryptor = nil
+			defaultStoreLock.Unlock()
+		}()
+	}
+
 	c, err := FromWgQuick(testInput, "golangTest")
 	if err != nil {
 		t.Errorf("Unable to parse test config: %s", err.Error())
@@ -89,3 +117,216 @@ func TestStorage(t *testing.T) {
 		t.Error("Config wasn't actually deleted")
 	}
 }
+
+func testConfigStore(t *testing.T, store ConfigStore) {
+	changes := 0
+	cb := store.Watch(func() { changes++ })
+	equal(t, 1, changes)
+
+	names, err := store.List()
+	if noError(t, err) {
+		equal(t, 0, len(names))
+	}
+	_, err = store.Load("missing")
+	if !os.IsNotExist(err) {
+		t.Errorf("Loading a missing tunnel gave %v", err)
+	}
+
+	doc, err := ParseDocument(testInput+"# comment\n", "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	noError(t, store.Save(doc))
+	loaded, err := store.Load("golangTest")
+	if noError(t, err) {
+		equal(t, doc.String(), loaded.String())
+		equal(t, "golangTest", loaded.Name)
+	}
+
+	c, err := LoadConfig(store, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	k, err := NewPrivateKey()
+	if !noError(t, err) {
+		return
+	}
+	c.Interface.PrivateKey = *k
+	noError(t, SaveConfig(store, c))
+	loaded, err = store.Load("golangTest")
+	if noError(t, err) {
+		if !strings.Contains(loaded.String(), "# comment") || !strings.Contains(loaded.String(), k.String()) {
+			t.Error("Saving a configuration lost the comments of the document, or the new key")
+		}
+	}
+
+	invalid := &Document{Name: "golangTest"}
+	invalid.Lines = append(invalid.Lines, doc.Lines...)
+	invalid.Lines = append(invalid.Lines, parseDocumentLine("MTU = nonsense"))
+	if err = store.Save(invalid); err == nil {
+		t.Error("Saving an invalid document succeeded")
+	}
+	if err = store.Save(&Document{Name: "bad/name"}); err == nil {
+		t.Error("Saving with an invalid name succeeded")
+	}
+
+	noError(t, store.Save(&Document{Name: "other", Lines: doc.Lines}))
+	if err = store.Rename("golangTest", "other"); err == nil {
+		t.Error("Renaming onto an existing tunnel succeeded")
+	}
+	noError(t, store.Delete("other"))
+	noError(t, store.Rename("golangTest", "renamed"))
+	names, err = store.List()
+	if noError(t, err) {
+		equal(t, []string{"renamed"}, names)
+	}
+	loaded, err = store.Load("renamed")
+	if noError(t, err) {
+		equal(t, "renamed", loaded.Name)
+		equal(t, true, strings.Contains(loaded.String(), "# comment"))
+	}
+
+	noError(t, store.Delete("renamed"))
+	if err = store.Delete("renamed"); err == nil {
+		t.Error("Deleting a missing tunnel succeeded")
+	}
+	names, err = store.List()
+	if noError(t, err) {
+		equal(t, 0, len(names))
+	}
+
+	cb.Unregister()
+	before := changes
+	noError(t, store.Save(doc))
+	equal(t, before, changes)
+}
+
+func testStoreCreateUpdate(t *testing.T, store ConfigStore) {
+	doc, err := ParseDocument(testInput, "created")
+	if !noError(t, err) || !noError(t, store.Create(doc)) {
+		return
+	}
+	defer store.Delete("created")
+	if err = store.Create(doc); err == nil {
+		t.Error("Creating an existing tunnel succeeded")
+	}
+
+	first, err := store.Load("created")
+	if !noError(t, err) {
+		return
+	}
+	second, err := store.Load("created")
+	if !noError(t, err) {
+		return
+	}
+	token := first.RevisionToken()
+	equal(t, token, second.RevisionToken())
+
+	c, err := first.Config()
+	if !noError(t, err) {
+		return
+	}
+	c.Interface.ListenPort = 1234
+	noError(t, first.Apply(c))
+	noError(t, store.Update(first, token))
+	c.Interface.ListenPort = 4321
+	noError(t, second.Apply(c))
+	if err = store.Update(second, token); err == nil {
+		t.Error("Updating with a stale revision token succeeded")
+	}
+	loaded, err := LoadConfig(store, "created")
+	if noError(t, err) {
+		equal(t, uint16(1234), loaded.Interface.ListenPort)
+	}
+
+	missing := &Document{Name: "missing", Lines: doc.Lines}
+	if err = store.Update(missing, token); !os.IsNotExist(err) {
+		t.Errorf("Updating a missing tunnel gave %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wgtest-store")
+	if !noError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	e, err := NewKeyfileEncryptor(filepath.Join(dir, "keyfile"))
+	if !noError(t, err) {
+		return
+	}
+	store, err := NewFileStore(filepath.Join(dir, "Configurations"), e)
+	if !noError(t, err) {
+		return
+	}
+	testConfigStore(t, store)
+	testStoreCreateUpdate(t, store)
+
+	doc, err := ParseDocument(testInput, "golangTest")
+	if !noError(t, err) || !noError(t, store.Save(doc)) {
+		return
+	}
+	unencrypted, err := NewFileStore(filepath.Join(dir, "Configurations"), nil)
+	if noError(t, err) {
+		if _, err = unencrypted.Load("golangTest"); err == nil {
+			t.Error("Loading without an encryptor succeeded")
+		}
+	}
+}
+
+func TestFileStoreMigrateUnencrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wgtest-migrate")
+	if !noError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	e, err := NewKeyfileEncryptor(filepath.Join(dir, "keyfile"))
+	if !noError(t, err) {
+		return
+	}
+	store, err := NewFileStore(filepath.Join(dir, "Configurations"), e)
+	if !noError(t, err) {
+		return
+	}
+
+	doc, err := ParseDocument(testInput, "stored")
+	if !noError(t, err) || !noError(t, store.Save(doc)) {
+		return
+	}
+	dropped := strings.Replace(testInput, "ListenPort = 51820", "ListenPort = 51821", 1)
+	for _, name := range []string{"stored", "dropped"} {
+		if !noError(t, ioutil.WriteFile(filepath.Join(store.Directory(), name+configFileUnencryptedSuffix), []byte(dropped), 0600)) {
+			return
+		}
+	}
+	migrated, errs := store.MigrateUnencrypted()
+	equal(t, 1, migrated)
+	equal(t, 1, len(errs))
+	names, err := store.List()
+	if noError(t, err) {
+		equal(t, []string{"dropped", "stored"}, names)
+	}
+	if _, err = os.Stat(filepath.Join(store.Directory(), "stored"+configFileUnencryptedSuffix)); err != nil {
+		t.Errorf("Unencrypted file of a stored tunnel was removed: %v", err)
+	}
+	loaded, err := store.Load("stored")
+	if noError(t, err) {
+		equal(t, doc.String(), loaded.String())
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testConfigStore(t, store)
+	testStoreCreateUpdate(t, store)
+
+	changes := 0
+	store.Watch(func() { changes++ })
+	doc, err := ParseDocument(testInput, "golangTest")
+	if noError(t, err) {
+		noError(t, store.Save(doc))
+		noError(t, store.Rename("golangTest", "renamed"))
+		noError(t, store.Delete("renamed"))
+		equal(t, 4, changes)
+	}
+}
@@ -5,20 +5,332 @@
 
 package conf
 
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type StoreEventType int
+
+const (
+	StoreEventAdded StoreEventType = iota
+	StoreEventRemoved
+	StoreEventModified
+	StoreEventRenamed
+)
+
+func (t StoreEventType) String() string {
+	switch t {
+	case StoreEventAdded:
+		return "added"
+	case StoreEventRemoved:
+		return "removed"
+	case StoreEventModified:
+		return "modified"
+	case StoreEventRenamed:
+		return "renamed"
+	}
+	return "unknown"
+}
+
+// A StoreEvent says what happened to the tunnel Name. OldName is only set for renames.
+type StoreEvent struct {
+	Type    StoreEventType
+	Name    string
+	OldName string
+}
+
+// A StoreCallback either runs cb once for every batch of changes, or eventCb for every event.
 type StoreCallback struct {
-	cb func()
+	cb        func()
+	eventCb   func(event StoreEvent)
+	callbacks *storeCallbacks
 }
 
-var storeCallbacks = make(map[*StoreCallback]bool)
+type storeCallbacks struct {
+	lock      sync.Mutex
+	callbacks map[*StoreCallback]bool
+	onEmpty   func()
+}
 
-func RegisterStoreChangeCallback(cb func()) *StoreCallback {
-	startWatchingConfigDir()
-	cb()
-	s := &StoreCallback{cb}
-	storeCallbacks[s] = true
+func newStoreCallbacks() *storeCallbacks {
+	return &storeCallbacks{callbacks: make(map[*StoreCallback]bool)}
+}
+
+func (callbacks *storeCallbacks) isEmpty() bool {
+	callbacks.lock.Lock()
+	defer callbacks.lock.Unlock()
+	return len(callbacks.callbacks) == 0
+}
+
+func (callbacks *storeCallbacks) register(cb func(), eventCb func(event StoreEvent)) *StoreCallback {
+	s := &StoreCallback{cb, eventCb, callbacks}
+	callbacks.lock.Lock()
+	callbacks.callbacks[s] = true
+	callbacks.lock.Unlock()
 	return s
 }
 
+// notify runs the callbacks without holding the lock, so that they may register and unregister too.
+// Callbacks of bare functions run even if events is empty, as some changes, such as unencrypted files
+// being dropped into the directory, are not changes of tunnels.
+func (callbacks *storeCallbacks) notify(events []StoreEvent) {
+	callbacks.lock.Lock()
+	list := make([]*StoreCallback, 0, len(callbacks.callbacks))
+	for cb := range callbacks.callbacks {
+		list = append(list, cb)
+	}
+	callbacks.lock.Unlock()
+	for _, cb := range list {
+		if cb.cb != nil {
+			cb.cb()
+			continue
+		}
+		for _, event := range events {
+			cb.eventCb(event)
+		}
+	}
+}
+
+// RegisterStoreChangeCallback watches the default store.
+func RegisterStoreChangeCallback(cb func()) *StoreCallback {
+	store, err := DefaultStore()
+	if err != nil {
+		cb()
+		return newStoreCallbacks().register(cb, nil)
+	}
+	return store.Watch(cb)
+}
+
+// RegisterStoreEventCallback watches the default store for changes of tunnels.
+func RegisterStoreEventCallback(cb func(event StoreEvent)) *StoreCallback {
+	store, err := DefaultStore()
+	if err != nil {
+		return newStoreCallbacks().register(nil, cb)
+	}
+	return store.WatchEvents(cb)
+}
+
+// Unregister stops the watching of the store once its last callback is unregistered.
 func (cb *StoreCallback) Unregister() {
-	delete(storeCallbacks, cb)
+	cb.callbacks.lock.Lock()
+	delete(cb.callbacks.callbacks, cb)
+	empty := len(cb.callbacks.callbacks) == 0
+	onEmpty := cb.callbacks.onEmpty
+	cb.callbacks.lock.Unlock()
+	if empty && onEmpty != nil {
+		onEmpty()
+	}
+}
+
+type storeFileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// A storeSnapshot holds the state of every file directly in a store's directory, by file name.
+type storeSnapshot map[string]storeFileState
+
+func (store *FileStore) snapshot() storeSnapshot {
+	files, err := ioutil.ReadDir(store.dir)
+	if err != nil {
+		return nil
+	}
+	snapshot := make(storeSnapshot, len(files))
+	for _, file := range files {
+		if !file.Mode().IsRegular() || strings.HasSuffix(file.Name(), ".tmp") {
+			continue
+		}
+		snapshot[file.Name()] = storeFileState{file.ModTime(), file.Size()}
+	}
+	return snapshot
+}
+
+func (snapshot storeSnapshot) equal(other storeSnapshot) bool {
+	if len(snapshot) != len(other) {
+		return false
+	}
+	for file, state := range snapshot {
+		if otherState, ok := other[file]; !ok || !otherState.modTime.Equal(state.modTime) || otherState.size != state.size {
+			return false
+		}
+	}
+	return true
+}
+
+func tunnelNameOfFile(file string) (string, bool) {
+	if len(file) <= len(configFileSuffix) || !strings.HasSuffix(file, configFileSuffix) {
+		return "", false
+	}
+	name := strings.TrimSuffix(file, configFileSuffix)
+	return name, TunnelNameIsValid(name)
+}
+
+// diffSnapshots turns the changes of tunnel files between two snapshots into events, pairing the
+// removal and addition of renames, which map new names to old ones, into a single event.
+func diffSnapshots(old, new storeSnapshot, renames map[string]string) []StoreEvent {
+	var added, removed []string
+	var events []StoreEvent
+	for file, state := range new {
+		name, ok := tunnelNameOfFile(file)
+		if !ok {
+			continue
+		}
+		oldState, ok := old[file]
+		if !ok {
+			added = append(added, name)
+		} else if !oldState.modTime.Equal(state.modTime) || oldState.size != state.size {
+			events = append(events, StoreEvent{Type: StoreEventModified, Name: name})
+		}
+	}
+	for file := range old {
+		name, ok := tunnelNameOfFile(file)
+		if !ok {
+			continue
+		}
+		if _, ok = new[file]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	wasRemoved := make(map[string]bool, len(removed))
+	for _, name := range removed {
+		wasRemoved[name] = true
+	}
+	for _, name := range added {
+		if oldName, ok := renames[name]; ok && wasRemoved[oldName] {
+			wasRemoved[oldName] = false
+			events = append(events, StoreEvent{Type: StoreEventRenamed, Name: name, OldName: oldName})
+		} else {
+			events = append(events, StoreEvent{Type: StoreEventAdded, Name: name})
+		}
+	}
+	for _, name := range removed {
+		if wasRemoved[name] {
+			events = append(events, StoreEvent{Type: StoreEventRemoved, Name: name})
+		}
+	}
+	// A change of metadata alone is a change of its tunnel.
+	hasEvent := make(map[string]bool, len(events))
+	for _, event := range events {
+		hasEvent[event.Name] = true
+	}
+	for _, snapshots := range [][2]storeSnapshot{{old, new}, {new, old}} {
+		for file, state := range snapshots[0] {
+			name, ok := metadataNameOfFile(file)
+			if !ok || hasEvent[name] {
+				continue
+			}
+			if _, ok = new[name+configFileSuffix]; !ok {
+				continue
+			}
+			if otherState, ok := snapshots[1][file]; ok && otherState.modTime.Equal(state.modTime) && otherState.size == state.size {
+				continue
+			}
+			hasEvent[name] = true
+			events = append(events, StoreEvent{Type: StoreEventModified, Name: name})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Name < events[j].Name
+	})
+	return events
+}
+
+// storeWatchDebounce is how long the directory must be quiet after a change before it is scanned,
+// so that a file being written, or a rename done in steps, is reported once.
+const storeWatchDebounce = time.Millisecond * 200
+
+// storePollInterval is how often the directory is scanned where it cannot be watched.
+const storePollInterval = time.Second * 2
+
+func (store *FileStore) startWatching() {
+	store.watchLock.Lock()
+	defer store.watchLock.Unlock()
+	if store.watching {
+		return
+	}
+	store.watching = true
+	store.watchStop = make(chan struct{})
+	store.lastSnapshot = store.snapshot()
+	store.watchDirectory(store.watchStop)
+}
+
+// stopWatching stops whatever watches the directory, unless a callback has been registered since
+// the last one was unregistered.
+func (store *FileStore) stopWatching() {
+	store.watchLock.Lock()
+	defer store.watchLock.Unlock()
+	if !store.watching || !store.callbacks.isEmpty() {
+		return
+	}
+	store.watching = false
+	close(store.watchStop)
+	store.watchStop = nil
+	if store.debounce != nil {
+		store.debounce.Stop()
+		store.debounce = nil
+	}
+	store.lastSnapshot = nil
+	store.renames = nil
+}
+
+// changed schedules a scan of the directory, once it has been quiet for a while.
+func (store *FileStore) changed() {
+	store.watchLock.Lock()
+	if store.debounce == nil {
+		store.debounce = time.AfterFunc(storeWatchDebounce, store.rescan)
+	} else {
+		store.debounce.Reset(storeWatchDebounce)
+	}
+	store.watchLock.Unlock()
+}
+
+// rescan compares the directory with what was seen last, and tells the callbacks what changed.
+func (store *FileStore) rescan() {
+	store.watchLock.Lock()
+	if !store.watching {
+		store.watchLock.Unlock()
+		return
+	}
+	snapshot := store.snapshot()
+	if snapshot == nil || snapshot.equal(store.lastSnapshot) {
+		store.watchLock.Unlock()
+		return
+	}
+	events := diffSnapshots(store.lastSnapshot, snapshot, store.renames)
+	store.lastSnapshot = snapshot
+	store.renames = nil
+	store.watchLock.Unlock()
+	store.callbacks.notify(events)
+}
+
+// poll scans the directory every interval, but only once it has stopped changing between two scans,
+// so that files are not reported while they are still being written.
+func (store *FileStore) poll(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	previous := store.snapshot()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		current := store.snapshot()
+		if current.equal(previous) {
+			store.rescan()
+		}
+		previous = current
+	}
+}
+
+// startPolling either starts watching the directory, or replaces a watcher that failed, so it stops
+// along with whatever it replaces.
+func (store *FileStore) startPolling(stop <-chan struct{}) {
+	go store.poll(storePollInterval, stop)
 }
@@ -0,0 +1,79 @@
+//go:build linux
+// +build linux
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"log"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_ATTRIB | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF
+
+// watchDirectory falls back to polling if inotify is unavailable, or the directory goes away.
+func (store *FileStore) watchDirectory(stop <-chan struct{}) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		log.Printf("Unable to monitor config directory, so polling it instead: %v", err)
+		store.startPolling(stop)
+		return
+	}
+	_, err = unix.InotifyAddWatch(fd, store.dir, inotifyMask)
+	if err != nil {
+		unix.Close(fd)
+		log.Printf("Unable to monitor config directory, so polling it instead: %v", err)
+		store.startPolling(stop)
+		return
+	}
+	go func() {
+		defer unix.Close(fd)
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		var buf [unix.SizeofInotifyEvent * 64]byte
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// Waiting for events only so long lets the watcher notice when it is stopped.
+			n, err := unix.Poll(fds, int(storePollInterval/time.Millisecond))
+			if err == unix.EINTR || err == nil && n == 0 {
+				continue
+			} else if err != nil {
+				log.Printf("Unable to wait for config directory events, so polling it instead: %v", err)
+				store.startPolling(stop)
+				return
+			}
+			n, err = unix.Read(fd, buf[:])
+			if err == unix.EINTR {
+				continue
+			} else if err != nil || n <= 0 {
+				log.Printf("Unable to read config directory events, so polling it instead: %v", err)
+				store.startPolling(stop)
+				return
+			}
+			gone := false
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				if event.Mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF|unix.IN_IGNORED) != 0 {
+					gone = true
+				}
+				offset += unix.SizeofInotifyEvent + int(event.Len)
+			}
+			store.changed()
+			if gone {
+				log.Printf("Config directory is no longer watchable, so polling it instead")
+				store.startPolling(stop)
+				return
+			}
+		}
+	}()
+}
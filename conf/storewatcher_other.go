@@ -0,0 +1,13 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+func (store *FileStore) watchDirectory(stop <-chan struct{}) {
+	store.startPolling(stop)
+}
@@ -0,0 +1,221 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	then := time.Unix(1000, 0)
+	now := time.Unix(2000, 0)
+	old := storeSnapshot{
+		"kept" + configFileSuffix:     {then, 10},
+		"modified" + configFileSuffix: {then, 10},
+		"removed" + configFileSuffix:  {then, 10},
+		"renamed" + configFileSuffix:  {then, 10},
+		"plain.conf":                  {then, 10},
+	}
+	new := storeSnapshot{
+		"kept" + configFileSuffix:     {then, 10},
+		"modified" + configFileSuffix: {now, 10},
+		"added" + configFileSuffix:    {now, 10},
+		"newName" + configFileSuffix:  {now, 10},
+		"bad name" + configFileSuffix: {now, 10},
+	}
+	equal(t, []StoreEvent{
+		{StoreEventAdded, "added", ""},
+		{StoreEventModified, "modified", ""},
+		{StoreEventRenamed, "newName", "renamed"},
+		{StoreEventRemoved, "removed", ""},
+	}, diffSnapshots(old, new, map[string]string{"newName": "renamed"}))
+	equal(t, []StoreEvent{
+		{StoreEventAdded, "added", ""},
+		{StoreEventModified, "modified", ""},
+		{StoreEventAdded, "newName", ""},
+		{StoreEventRemoved, "removed", ""},
+		{StoreEventRemoved, "renamed", ""},
+	}, diffSnapshots(old, new, nil))
+	equal(t, true, old.equal(old))
+	equal(t, false, old.equal(new))
+}
+
+type eventRecorder struct {
+	lock   sync.Mutex
+	events []StoreEvent
+}
+
+func (recorder *eventRecorder) record(event StoreEvent) {
+	recorder.lock.Lock()
+	recorder.events = append(recorder.events, event)
+	recorder.lock.Unlock()
+}
+
+// take waits for up to timeout for count events, and returns those that came.
+func (recorder *eventRecorder) take(count int, timeout time.Duration) []StoreEvent {
+	deadline := time.Now().Add(timeout)
+	for {
+		recorder.lock.Lock()
+		if len(recorder.events) >= count || time.Now().After(deadline) {
+			events := recorder.events
+			recorder.events = nil
+			recorder.lock.Unlock()
+			return events
+		}
+		recorder.lock.Unlock()
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func testStoreEvents(t *testing.T, store ConfigStore) {
+	recorder := &eventRecorder{}
+	cb := store.WatchEvents(recorder.record)
+	equal(t, 0, len(recorder.take(0, 0)))
+
+	doc, err := ParseDocument(testInput, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	noError(t, store.Save(doc))
+	equal(t, []StoreEvent{{StoreEventAdded, "golangTest", ""}}, recorder.take(1, time.Second))
+	time.Sleep(time.Millisecond * 10)
+	if !saveWithListenPort(t, store, "golangTest", 1234) {
+		return
+	}
+	equal(t, []StoreEvent{{StoreEventModified, "golangTest", ""}}, recorder.take(1, time.Second))
+	noError(t, store.Rename("golangTest", "renamed"))
+	equal(t, []StoreEvent{{StoreEventRenamed, "renamed", "golangTest"}}, recorder.take(1, time.Second))
+	noError(t, store.Delete("renamed"))
+	equal(t, []StoreEvent{{StoreEventRemoved, "renamed", ""}}, recorder.take(1, time.Second))
+
+	cb.Unregister()
+	noError(t, store.Save(doc))
+	equal(t, 0, len(recorder.take(1, storeWatchDebounce*2)))
+}
+
+func newTestFileStore(t *testing.T) (*FileStore, func()) {
+	dir, err := ioutil.TempDir("", "wgtest-events")
+	if !noError(t, err) {
+		return nil, nil
+	}
+	e, err := NewKeyfileEncryptor(filepath.Join(dir, "keyfile"))
+	if !noError(t, err) {
+		os.RemoveAll(dir)
+		return nil, nil
+	}
+	store, err := NewFileStore(filepath.Join(dir, "Configurations"), e)
+	if !noError(t, err) {
+		os.RemoveAll(dir)
+		return nil, nil
+	}
+	return store, func() { os.RemoveAll(dir) }
+}
+
+func TestFileStoreEvents(t *testing.T) {
+	store, cleanup := newTestFileStore(t)
+	if store == nil {
+		return
+	}
+	defer cleanup()
+	testStoreEvents(t, store)
+
+	// Changes made behind the store's back are found by watching the directory.
+	recorder := &eventRecorder{}
+	defer store.WatchEvents(recorder.record).Unregister()
+	other, err := NewFileStore(store.Directory(), store.encryptor)
+	if !noError(t, err) {
+		return
+	}
+	doc, err := ParseDocument(testInput, "external")
+	if noError(t, err) && noError(t, other.Save(doc)) {
+		equal(t, []StoreEvent{{StoreEventAdded, "external", ""}}, recorder.take(1, storePollInterval*3))
+	}
+}
+
+func TestFileStorePolling(t *testing.T) {
+	store, cleanup := newTestFileStore(t)
+	if store == nil {
+		return
+	}
+	defer cleanup()
+	store.watching = true
+	store.lastSnapshot = store.snapshot()
+	recorder := &eventRecorder{}
+	store.callbacks.register(nil, recorder.record)
+	stop := make(chan struct{})
+	defer close(stop)
+	go store.poll(time.Millisecond*50, stop)
+
+	doc, err := ParseDocument(testInput, "polled")
+	if noError(t, err) && noError(t, store.writeFile("polled", doc.String())) {
+		equal(t, []StoreEvent{{StoreEventAdded, "polled", ""}}, recorder.take(1, time.Second))
+	}
+	path, _ := store.Path("polled")
+	noError(t, os.Remove(path))
+	equal(t, []StoreEvent{{StoreEventRemoved, "polled", ""}}, recorder.take(1, time.Second))
+}
+
+func TestFileStoreStopsWatching(t *testing.T) {
+	store, cleanup := newTestFileStore(t)
+	if store == nil {
+		return
+	}
+	defer cleanup()
+	watching := func() (bool, chan struct{}) {
+		store.watchLock.Lock()
+		defer store.watchLock.Unlock()
+		return store.watching, store.watchStop
+	}
+
+	first := store.WatchEvents(func(StoreEvent) {})
+	second := store.Watch(func() {})
+	first.Unregister()
+	isWatching, stop := watching()
+	equal(t, true, isWatching)
+	second.Unregister()
+	isWatching, _ = watching()
+	equal(t, false, isWatching)
+	select {
+	case <-stop:
+	default:
+		t.Error("Watcher was not told to stop")
+	}
+
+	recorder := &eventRecorder{}
+	defer store.WatchEvents(recorder.record).Unregister()
+	time.Sleep(time.Millisecond * 10)
+	doc, err := ParseDocument(testInput, "rewatched")
+	if noError(t, err) && noError(t, store.Save(doc)) {
+		equal(t, []StoreEvent{{StoreEventAdded, "rewatched", ""}}, recorder.take(1, time.Second))
+	}
+}
+
+func TestMemoryStoreEvents(t *testing.T) {
+	testStoreEvents(t, NewMemoryStore())
+}
+
+func TestStoreCallbacksConcurrently(t *testing.T) {
+	callbacks := newStoreCallbacks()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cb := callbacks.register(nil, func(StoreEvent) {})
+				callbacks.notify([]StoreEvent{{StoreEventAdded, "a", ""}})
+				cb.Unregister()
+			}
+		}()
+	}
+	wg.Wait()
+	equal(t, 0, len(callbacks.callbacks))
+}
@@ -7,6 +7,7 @@ package conf
 
 import (
 	"log"
+	"time"
 
 	"golang.org/x/sys/windows"
 )
@@ -24,33 +25,37 @@ const (
 
 //sys	findFirstChangeNotification(path *uint16, watchSubtree bool, filter uint32) (handle windows.Handle, err error) = kernel32.FindFirstChangeNotificationW
 //sys	findNextChangeNotification(handle windows.Handle) (err error) = kernel32.FindNextChangeNotification
+//sys	findCloseChangeNotification(handle windows.Handle) (err error) = kernel32.FindCloseChangeNotification
 
-var haveStartedWatchingConfigDir bool
-
-func startWatchingConfigDir() {
-	if haveStartedWatchingConfigDir {
+// watchDirectory falls back to polling if the directory cannot be watched. Tunnels are only ever at the
+// top of the directory, so the writes to history and quarantine below it, and mere reads, are not
+// watched.
+func (store *FileStore) watchDirectory(stop <-chan struct{}) {
+	h, err := findFirstChangeNotification(windows.StringToUTF16Ptr(store.dir), false, fncFILE_NAME|fncDIR_NAME|fncATTRIBUTES|fncSIZE|fncLAST_WRITE|fncCREATION|fncSECURITY)
+	if err != nil {
+		log.Printf("Unable to monitor config directory, so polling it instead: %v", err)
+		store.startPolling(stop)
 		return
 	}
-	haveStartedWatchingConfigDir = true
 	go func() {
-		configFileDir, err := tunnelConfigurationsDirectory()
-		if err != nil {
-			return
-		}
-		h, err := findFirstChangeNotification(windows.StringToUTF16Ptr(configFileDir), true, fncFILE_NAME|fncDIR_NAME|fncATTRIBUTES|fncSIZE|fncLAST_WRITE|fncLAST_ACCESS|fncCREATION|fncSECURITY)
-		if err != nil {
-			log.Fatalf("Unable to monitor config directory: %v", err)
-		}
+		defer findCloseChangeNotification(h)
 		for {
-			s, err := windows.WaitForSingleObject(h, windows.INFINITE)
+			// Waiting for changes only so long lets the watcher notice when it is stopped.
+			s, err := windows.WaitForSingleObject(h, uint32(storePollInterval/time.Millisecond))
 			if err != nil || s == windows.WAIT_FAILED {
 				log.Fatalf("Unable to wait on config directory watcher: %v", err)
 			}
-
-			for cb := range storeCallbacks {
-				cb.cb()
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if s == uint32(windows.WAIT_TIMEOUT) {
+				continue
 			}
 
+			store.changed()
+
 			err = findNextChangeNotification(h)
 			if err != nil {
 				log.Fatalf("Unable to monitor config directory again: %v", err)
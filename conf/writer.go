@@ -7,67 +7,124 @@ package conf
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
-func (conf *Config) ToWgQuick() string {
-	var output strings.Builder
-	output.WriteString("[Interface]\n")
+var interfaceKeys = []string{"PrivateKey", "ListenPort", "Address", "DNS", "MTU", "FwMark", "Table", "PreUp", "PostUp", "PreDown", "PostDown"}
+var peerKeys = []string{"PublicKey", "PresharedKey", "AllowedIPs", "Endpoint", "PersistentKeepalive"}
 
-	output.WriteString(fmt.Sprintf("PrivateKey = %s\n", conf.Interface.PrivateKey.String()))
-
-	if conf.Interface.ListenPort > 0 {
-		output.WriteString(fmt.Sprintf("ListenPort = %d\n", conf.Interface.ListenPort))
+func joinIPCidrs(addresses []IPCidr) string {
+	addrStrings := make([]string, len(addresses))
+	for i, address := range addresses {
+		addrStrings[i] = address.String()
 	}
+	return strings.Join(addrStrings[:], ", ")
+}
 
-	if len(conf.Interface.Addresses) > 0 {
-		addrStrings := make([]string, len(conf.Interface.Addresses))
-		for i, address := range conf.Interface.Addresses {
-			addrStrings[i] = address.String()
+func (iface *Interface) wgQuickValues(key string) []string {
+	switch key {
+	case "PrivateKey":
+		return []string{iface.PrivateKey.String()}
+	case "ListenPort":
+		if iface.ListenPort > 0 {
+			return []string{strconv.Itoa(int(iface.ListenPort))}
 		}
-		output.WriteString(fmt.Sprintf("Address = %s\n", strings.Join(addrStrings[:], ", ")))
-	}
-
-	if len(conf.Interface.DNS) > 0 {
-		addrStrings := make([]string, len(conf.Interface.DNS))
-		for i, address := range conf.Interface.DNS {
-			addrStrings[i] = address.String()
+	case "Address":
+		if len(iface.Addresses) > 0 {
+			return []string{joinIPCidrs(iface.Addresses)}
 		}
-		output.WriteString(fmt.Sprintf("DNS = %s\n", strings.Join(addrStrings[:], ", ")))
-	}
-
-	if conf.Interface.MTU > 0 {
-		output.WriteString(fmt.Sprintf("MTU = %d\n", conf.Interface.MTU))
+	case "DNS":
+		if len(iface.DNS)+len(iface.DNSSearch) > 0 {
+			addrStrings := make([]string, 0, len(iface.DNS)+len(iface.DNSSearch))
+			for _, address := range iface.DNS {
+				addrStrings = append(addrStrings, address.String())
+			}
+			addrStrings = append(addrStrings, iface.DNSSearch...)
+			return []string{strings.Join(addrStrings[:], ", ")}
+		}
+	case "MTU":
+		if iface.MTU > 0 {
+			return []string{strconv.Itoa(int(iface.MTU))}
+		}
+	case "FwMark":
+		if iface.FwMark > 0 {
+			return []string{fmt.Sprintf("0x%x", iface.FwMark)}
+		}
+	case "Table":
+		if !iface.Table.IsAuto() {
+			return []string{iface.Table.String()}
+		}
+	case "PreUp":
+		return iface.PreUp
+	case "PostUp":
+		return iface.PostUp
+	case "PreDown":
+		return iface.PreDown
+	case "PostDown":
+		return iface.PostDown
 	}
+	return nil
+}
 
-	for _, peer := range conf.Peers {
-		output.WriteString("\n[Peer]\n")
-
-		output.WriteString(fmt.Sprintf("PublicKey = %s\n", peer.PublicKey.String()))
-
+func (peer *Peer) wgQuickValues(key string) []string {
+	switch key {
+	case "PublicKey":
+		return []string{peer.PublicKey.String()}
+	case "PresharedKey":
 		if !peer.PresharedKey.IsZero() {
-			output.WriteString(fmt.Sprintf("PresharedKey = %s\n", peer.PresharedKey.String()))
+			return []string{peer.PresharedKey.String()}
 		}
-
+	case "AllowedIPs":
 		if len(peer.AllowedIPs) > 0 {
-			addrStrings := make([]string, len(peer.AllowedIPs))
-			for i, address := range peer.AllowedIPs {
-				addrStrings[i] = address.String()
-			}
-			output.WriteString(fmt.Sprintf("AllowedIPs = %s\n", strings.Join(addrStrings[:], ", ")))
+			return []string{joinIPCidrs(peer.AllowedIPs)}
 		}
-
+	case "Endpoint":
 		if !peer.Endpoint.IsEmpty() {
-			output.WriteString(fmt.Sprintf("Endpoint = %s\n", peer.Endpoint.String()))
+			return []string{peer.Endpoint.String()}
 		}
-
+	case "PersistentKeepalive":
 		if peer.PersistentKeepalive > 0 {
-			output.WriteString(fmt.Sprintf("PersistentKeepalive = %d\n", peer.PersistentKeepalive))
+			return []string{strconv.Itoa(int(peer.PersistentKeepalive))}
+		}
+	}
+	return nil
+}
+
+func (conf *Config) writeWgQuick(interfaceKeys, peerKeys []string) string {
+	var output strings.Builder
+	output.WriteString("[Interface]\n")
+	for _, key := range interfaceKeys {
+		for _, value := range conf.Interface.wgQuickValues(key) {
+			output.WriteString(fmt.Sprintf("%s = %s\n", key, value))
+		}
+	}
+
+	for _, peer := range conf.Peers {
+		output.WriteString("\n[Peer]\n")
+		for _, key := range peerKeys {
+			for _, value := range peer.wgQuickValues(key) {
+				output.WriteString(fmt.Sprintf("%s = %s\n", key, value))
+			}
 		}
 	}
 	return output.String()
 }
 
+func (conf *Config) ToWgQuick() string {
+	return conf.writeWgQuick(interfaceKeys, peerKeys)
+}
+
+// ToSetconf writes a file for wg setconf, which is a wg-quick file without the keys that only wg-quick
+// understands.
+func (conf *Config) ToSetconf() string {
+	return conf.writeWgQuick([]string{"PrivateKey", "ListenPort", "FwMark"}, peerKeys)
+}
+
+// hostnameResolver turns the host of an endpoint into an IP address for UAPI. Tests replace it, so
+// that they do not depend on DNS.
+var hostnameResolver = resolveHostname
+
 func (conf *Config) ToUAPI() (uapi string, dnsErr error) {
 	var output strings.Builder
 	output.WriteString(fmt.Sprintf("private_key=%s\n", conf.Interface.PrivateKey.HexString()))
@@ -76,6 +133,10 @@ func (conf *Config) ToUAPI() (uapi string, dnsErr error) {
 		output.WriteString(fmt.Sprintf("listen_port=%d\n", conf.Interface.ListenPort))
 	}
 
+	if conf.Interface.FwMark > 0 {
+		output.WriteString(fmt.Sprintf("fwmark=%d\n", conf.Interface.FwMark))
+	}
+
 	if len(conf.Peers) > 0 {
 		output.WriteString("replace_peers=true\n")
 	}
@@ -89,7 +150,7 @@ func (conf *Config) ToUAPI() (uapi string, dnsErr error) {
 
 		if !peer.Endpoint.IsEmpty() {
 			var resolvedIP string
-			resolvedIP, dnsErr = resolveHostname(peer.Endpoint.Host)
+			resolvedIP, dnsErr = hostnameResolver(peer.Endpoint.Host)
 			if dnsErr != nil {
 				return
 			}
@@ -48,6 +48,7 @@ var (
 	procSHGetKnownFolderPath         = modshell32.NewProc("SHGetKnownFolderPath")
 	procFindFirstChangeNotificationW = modkernel32.NewProc("FindFirstChangeNotificationW")
 	procFindNextChangeNotification   = modkernel32.NewProc("FindNextChangeNotification")
+	procFindCloseChangeNotification  = modkernel32.NewProc("FindCloseChangeNotification")
 )
 
 func internetGetConnectedState(flags *uint32, reserved uint32) (connected bool) {
@@ -109,3 +110,15 @@ func findNextChangeNotification(handle windows.Handle) (err error) {
 	}
 	return
 }
+
+func findCloseChangeNotification(handle windows.Handle) (err error) {
+	r1, _, e1 := syscall.Syscall(procFindCloseChangeNotification.Addr(), 1, uintptr(handle), 0, 0)
+	if r1 == 0 {
+		if e1 != 0 {
+			err = errnoErr(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
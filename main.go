@@ -7,6 +7,7 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
@@ -14,6 +15,8 @@ import (
 
 	"golang.org/x/sys/windows"
 
+	"golang.zx2c4.com/wireguard/windows/conf"
+	"golang.zx2c4.com/wireguard/windows/qrcode"
 	"golang.zx2c4.com/wireguard/windows/ringlogger"
 	"golang.zx2c4.com/wireguard/windows/service"
 	"golang.zx2c4.com/wireguard/windows/ui"
@@ -29,10 +32,13 @@ var flags = [...]string{
 	"/tunnelservice CONFIG_PATH",
 	"/ui CMD_READ_HANDLE CMD_WRITE_HANDLE CMD_EVENT_HANDLE LOG_MAPPING_HANDLE",
 	"/dumplog OUTPUT_PATH",
+	"/lint CONFIG_PATH",
+	"/qrcode CONFIG_PATH [OUTPUT_PNG_PATH]",
 }
 
 //sys	messageBoxEx(hwnd windows.Handle, text *uint16, title *uint16, typ uint, languageId uint16) = user32.MessageBoxExW
 //sys	isWow64Process(handle windows.Handle, isWow64 *bool) (err error) = kernel32.IsWow64Process
+//sys	attachConsole(processId uint32) (err error) = kernel32.AttachConsole
 
 func fatal(v ...interface{}) {
 	messageBoxEx(0, windows.StringToUTF16Ptr(fmt.Sprint(v...)), windows.StringToUTF16Ptr("Error"), 0x00000010, 0)
@@ -87,6 +93,76 @@ func execElevatedManagerServiceInstaller() error {
 	return windows.ERROR_ACCESS_DENIED // Not reached
 }
 
+// Since we're linked as a GUI program, we have no console of our own, so when our output isn't
+// redirected, we borrow the one of whoever ran us, if any.
+func attachParentConsole() {
+	if windows.Stdout != 0 && windows.Stdout != windows.InvalidHandle {
+		return
+	}
+	const attachParentProcess = ^uint32(0)
+	if attachConsole(attachParentProcess) != nil {
+		return
+	}
+	console, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	os.Stdout = console
+	os.Stderr = console
+}
+
+func lintConfigFile(path string) int {
+	name, err := conf.NameFromPath(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 2
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 2
+	}
+	status := 0
+	for _, finding := range conf.LintWgQuick(string(bytes), name) {
+		if finding.Line > 0 {
+			fmt.Printf("%s:%d: %s\n", path, finding.Line, finding.String())
+		} else {
+			fmt.Printf("%s: %s\n", path, finding.String())
+		}
+		if finding.Severity == conf.LintError {
+			status = 1
+		}
+	}
+	return status
+}
+
+// The private key is in the code, so the PNG gets the same permissions as the configuration would.
+func qrcodeConfigFile(path string, pngPath string) int {
+	config, err := conf.LoadFromPath(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+	code, err := qrcode.Encode([]byte(config.ToWgQuick()), qrcode.Low)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+	if len(pngPath) == 0 {
+		fmt.Print(code.ToTerminal())
+		return 0
+	}
+	png, err := code.ToPNG(8)
+	if err == nil {
+		err = ioutil.WriteFile(pngPath, png, 0600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", pngPath, err)
+		return 1
+	}
+	return 0
+}
+
 func pipeFromHandleArgument(handleStr string) (*os.File, error) {
 	handleInt, err := strconv.ParseUint(handleStr, 10, 64)
 	if err != nil {
@@ -208,6 +284,22 @@ func main() {
 			fatal(err)
 		}
 		return
+	case "/lint":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		attachParentConsole()
+		os.Exit(lintConfigFile(os.Args[2]))
+	case "/qrcode":
+		if len(os.Args) != 3 && len(os.Args) != 4 {
+			usage()
+		}
+		attachParentConsole()
+		pngPath := ""
+		if len(os.Args) == 4 {
+			pngPath = os.Args[3]
+		}
+		os.Exit(qrcodeConfigFile(os.Args[2], pngPath))
 	}
 	usage()
 }
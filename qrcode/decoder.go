@@ -0,0 +1,382 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math/bits"
+)
+
+var (
+	ErrNotFound = errors.New("No QR code found in image")
+	ErrDamaged  = errors.New("QR code is too damaged to read")
+)
+
+// Decode finds a QR code in img, which should be straight on, as in a screenshot, rather than seen at
+// an angle, and returns what it holds. Codes with light modules on a dark background are found too.
+func Decode(img image.Image) ([]byte, error) {
+	err := ErrNotFound
+	for _, invert := range []bool{false, true} {
+		b := binarize(img, invert)
+		topLeft, topRight, bottomLeft, ok := chooseFinderPatterns(b.findFinderPatterns())
+		if !ok {
+			continue
+		}
+		for _, version := range estimateVersions(topLeft, topRight, bottomLeft) {
+			var data []byte
+			s := newSampler(b, version*4+17, topLeft, topRight, bottomLeft)
+			data, err = decodeModules(version, s.dark)
+			if err == nil {
+				return data, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// DecodeImage reads a PNG or JPEG image from r, and decodes the QR code in it.
+func DecodeImage(r io.Reader) ([]byte, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(img)
+}
+
+// decodeModules reads the code of the given version whose module in column x of row y is dark(x, y).
+func decodeModules(version int, dark func(x, y int) bool) ([]byte, error) {
+	c := newCode(version, Low)
+	var ok bool
+	c.Level, c.Mask, ok = readFormatInformation(c.size, dark)
+	if !ok {
+		return nil, ErrDamaged
+	}
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if !c.isFunction[y*c.size+x] {
+				c.modules[y*c.size+x] = dark(x, y)
+			}
+		}
+	}
+	c.applyMask(c.Mask)
+
+	codewords := make([]byte, rawDataModules(version)/8)
+	i := 0
+	c.forEachDataModule(func(x, y int) {
+		if i < len(codewords)*8 {
+			if c.modules[y*c.size+x] {
+				codewords[i/8] |= 0x80 >> uint(i%8)
+			}
+			i++
+		}
+	})
+
+	data, err := correctAndDeinterleave(codewords, version, c.Level)
+	if err != nil {
+		return nil, err
+	}
+	return parseSegments(data, version)
+}
+
+// readFormatInformation finds the level and mask whose format information is closest to either of
+// the two copies in the code, as long as it is close enough to be told apart from the others.
+func readFormatInformation(size int, dark func(x, y int) bool) (Level, int, bool) {
+	var first, second uint32
+	setBit := func(word *uint32, i int, dark bool) {
+		if dark {
+			*word |= 1 << uint(i)
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		setBit(&first, i, dark(8, i))
+	}
+	setBit(&first, 6, dark(8, 7))
+	setBit(&first, 7, dark(8, 8))
+	setBit(&first, 8, dark(7, 8))
+	for i := 9; i < 15; i++ {
+		setBit(&first, i, dark(14-i, 8))
+	}
+	for i := 0; i < 8; i++ {
+		setBit(&second, i, dark(size-1-i, 8))
+	}
+	for i := 8; i < 15; i++ {
+		setBit(&second, i, dark(8, size-15+i))
+	}
+
+	bestDistance := 4
+	var bestLevel Level
+	bestMask := -1
+	for level := Low; level <= High; level++ {
+		for mask := 0; mask < 8; mask++ {
+			information := formatInformation(level, mask)
+			for _, candidate := range []uint32{first, second} {
+				if distance := hammingDistance(information, candidate); distance < bestDistance {
+					bestDistance, bestLevel, bestMask = distance, level, mask
+				}
+			}
+		}
+	}
+	return bestLevel, bestMask, bestMask >= 0
+}
+
+func hammingDistance(a, b uint32) int {
+	return bits.OnesCount32(a ^ b)
+}
+
+// correctAndDeinterleave undoes addECCAndInterleave, correcting errors along the way.
+func correctAndDeinterleave(codewords []byte, version int, level Level) ([]byte, error) {
+	numBlocks := eccBlocks[level][version]
+	blockECCLen := eccCodewordsPerBlock[level][version]
+	rawCodewords := rawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	blocks := make([][]byte, numBlocks)
+	for j := range blocks {
+		blocks[j] = make([]byte, shortBlockLen+1)
+	}
+	k := 0
+	for i := 0; i < shortBlockLen+1; i++ {
+		for j := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				blocks[j][i] = codewords[k]
+				k++
+			}
+		}
+	}
+
+	data := make([]byte, 0, dataCodewords(version, level))
+	for j, block := range blocks {
+		if j < numShortBlocks {
+			// Take out the placeholder.
+			placeholder := shortBlockLen - blockECCLen
+			block = append(block[:placeholder], block[placeholder+1:]...)
+		}
+		if !reedSolomonCorrect(block, blockECCLen) {
+			return nil, ErrDamaged
+		}
+		data = append(data, block[:len(block)-blockECCLen]...)
+	}
+	return data, nil
+}
+
+var gfExp [512]byte
+var gfLog [256]int
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = i
+		x = gfMultiply(x, 0x02)
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfInverse(x byte) byte {
+	return gfExp[255-gfLog[x]]
+}
+
+// evaluate evaluates the polynomial with coefficients p, from the lowest power up, at x.
+func evaluate(p []byte, x byte) byte {
+	var result byte
+	for i := len(p) - 1; i >= 0; i-- {
+		result = gfMultiply(result, x) ^ p[i]
+	}
+	return result
+}
+
+// reedSolomonCorrect corrects block in place, which is data followed by eccLen error correction
+// codewords, as the coefficients of a polynomial from the highest power down. The generator has the
+// roots 1, α, ..., α^(eccLen-1), so the syndromes are the block evaluated at those. The error locator
+// comes from Berlekamp-Massey, the positions from trying every one of them, and the magnitudes from
+// Forney's formula.
+func reedSolomonCorrect(block []byte, eccLen int) bool {
+	n := len(block)
+	syndromes := make([]byte, eccLen)
+	anyErrors := false
+	for j := range syndromes {
+		var s byte
+		for _, b := range block {
+			s = gfMultiply(s, gfExp[j]) ^ b
+		}
+		syndromes[j] = s
+		anyErrors = anyErrors || s != 0
+	}
+	if !anyErrors {
+		return true
+	}
+
+	locator := []byte{1}
+	previous := []byte{1}
+	numErrors := 0
+	shift := 1
+	previousDiscrepancy := byte(1)
+	for i := 0; i < eccLen; i++ {
+		discrepancy := syndromes[i]
+		for j := 1; j <= numErrors && j < len(locator); j++ {
+			discrepancy ^= gfMultiply(locator[j], syndromes[i-j])
+		}
+		if discrepancy == 0 {
+			shift++
+			continue
+		}
+		scale := gfMultiply(discrepancy, gfInverse(previousDiscrepancy))
+		next := make([]byte, max(len(locator), len(previous)+shift))
+		copy(next, locator)
+		for j, coefficient := range previous {
+			next[j+shift] ^= gfMultiply(scale, coefficient)
+		}
+		if 2*numErrors <= i {
+			previous = locator
+			numErrors = i + 1 - numErrors
+			previousDiscrepancy = discrepancy
+			shift = 1
+		} else {
+			shift++
+		}
+		locator = next
+	}
+	if 2*numErrors > eccLen {
+		return false
+	}
+
+	// Ω(x) = S(x) Λ(x) mod x^eccLen, and Λ'(x) has only the odd powers of Λ(x) in characteristic two.
+	evaluator := make([]byte, eccLen)
+	for i := range evaluator {
+		for j := 0; j <= i && j < len(locator); j++ {
+			evaluator[i] ^= gfMultiply(locator[j], syndromes[i-j])
+		}
+	}
+	derivative := make([]byte, len(locator))
+	for i := 1; i < len(locator); i += 2 {
+		derivative[i-1] = locator[i]
+	}
+
+	found := 0
+	for k := 0; k < n; k++ {
+		power := n - 1 - k
+		xInverse := gfExp[(255-power%255)%255]
+		if evaluate(locator, xInverse) != 0 {
+			continue
+		}
+		denominator := evaluate(derivative, xInverse)
+		if denominator == 0 {
+			return false
+		}
+		magnitude := gfMultiply(gfExp[power%255], evaluate(evaluator, xInverse))
+		block[k] ^= gfMultiply(magnitude, gfInverse(denominator))
+		found++
+	}
+	return found == numErrors
+}
+
+type bitReader struct {
+	data []byte
+	n    int
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.data)*8 - r.n
+}
+
+func (r *bitReader) read(length int) int {
+	value := 0
+	for i := 0; i < length; i++ {
+		value <<= 1
+		if r.n < len(r.data)*8 && (r.data[r.n/8]>>uint(7-r.n%8))&1 != 0 {
+			value |= 1
+		}
+		r.n++
+	}
+	return value
+}
+
+const alphanumericCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// parseSegments reads the numeric, alphanumeric, and byte segments of data until the terminator. Kanji
+// segments are not supported, and ECI designators are skipped, as the bytes are kept as they are.
+func parseSegments(data []byte, version int) ([]byte, error) {
+	sizeClass := 0
+	if version >= 27 {
+		sizeClass = 2
+	} else if version >= 10 {
+		sizeClass = 1
+	}
+	r := &bitReader{data: data}
+	var result []byte
+	for r.remaining() >= 4 {
+		mode := r.read(4)
+		switch mode {
+		case 0x0:
+			return result, nil
+		case 0x1:
+			count := r.read([]int{10, 12, 14}[sizeClass])
+			for ; count >= 3; count -= 3 {
+				result = append(result, []byte(padDigits(r.read(10), 3))...)
+			}
+			if count == 2 {
+				result = append(result, []byte(padDigits(r.read(7), 2))...)
+			} else if count == 1 {
+				result = append(result, []byte(padDigits(r.read(4), 1))...)
+			}
+		case 0x2:
+			count := r.read([]int{9, 11, 13}[sizeClass])
+			for ; count >= 2; count -= 2 {
+				pair := r.read(11)
+				if pair >= 45*45 {
+					return nil, ErrDamaged
+				}
+				result = append(result, alphanumericCharset[pair/45], alphanumericCharset[pair%45])
+			}
+			if count == 1 {
+				single := r.read(6)
+				if single >= 45 {
+					return nil, ErrDamaged
+				}
+				result = append(result, alphanumericCharset[single])
+			}
+		case 0x4:
+			count := r.read([]int{8, 16, 16}[sizeClass])
+			if count*8 > r.remaining() {
+				return nil, ErrDamaged
+			}
+			for i := 0; i < count; i++ {
+				result = append(result, byte(r.read(8)))
+			}
+		case 0x7:
+			first := r.read(8)
+			if first&0x80 != 0 {
+				if first&0x40 == 0 {
+					r.read(8)
+				} else {
+					r.read(16)
+				}
+			}
+		default:
+			return nil, errors.New("QR code uses an unsupported mode")
+		}
+		if r.remaining() < 0 {
+			return nil, ErrDamaged
+		}
+	}
+	return result, nil
+}
+
+func padDigits(value int, digits int) string {
+	s := make([]byte, digits)
+	for i := digits - 1; i >= 0; i-- {
+		s[i] = byte('0' + value%10)
+		value /= 10
+	}
+	return string(s)
+}
@@ -0,0 +1,140 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"testing"
+)
+
+func TestReedSolomonCorrect(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, eccLen := range []int{7, 10, 22, 30} {
+		for errors := 0; errors <= eccLen/2; errors++ {
+			data := make([]byte, 40)
+			random.Read(data)
+			block := append(append([]byte{}, data...), reedSolomonRemainder(data, reedSolomonDivisor(eccLen))...)
+			for _, k := range random.Perm(len(block))[:errors] {
+				block[k] ^= byte(1 + random.Intn(255))
+			}
+			if !reedSolomonCorrect(block, eccLen) || !bytes.Equal(block[:len(data)], data) {
+				t.Errorf("Unable to correct %d errors with %d codewords", errors, eccLen)
+			}
+		}
+	}
+}
+
+func TestParseSegments(t *testing.T) {
+	// Version 1-M, "HELLO WORLD" in alphanumeric mode.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	text, err := parseSegments(data, 1)
+	if err != nil || string(text) != "HELLO WORLD" {
+		t.Errorf("Parsed %q, %v", text, err)
+	}
+	// Version 1, "01234567" in numeric mode.
+	data = []byte{0x10, 0x20, 0x0c, 0x56, 0x61, 0x80, 0x00}
+	text, err = parseSegments(data, 1)
+	if err != nil || string(text) != "01234567" {
+		t.Errorf("Parsed %q, %v", text, err)
+	}
+}
+
+// transformed draws src, scaled by scale and rotated by a quarter turn clockwise if rotate, at an
+// offset on a larger light canvas.
+func transformed(src image.Image, scale float64, rotate bool) image.Image {
+	side := src.Bounds().Dx()
+	target := int(float64(side)*scale) + 40
+	dst := image.NewGray(image.Rect(0, 0, target, target))
+	for y := 0; y < target; y++ {
+		for x := 0; x < target; x++ {
+			sx, sy := int(float64(x-20)/scale), int(float64(y-20)/scale)
+			if rotate {
+				sx, sy = sy, side-1-sx
+			}
+			if x < 20 || y < 20 || sx < 0 || sy < 0 || sx >= side || sy >= side {
+				dst.SetGray(x, y, color.Gray{0xff})
+			} else {
+				dst.Set(x, y, src.At(sx, sy))
+			}
+		}
+	}
+	return dst
+}
+
+func TestDecode(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	for _, test := range []struct {
+		length int
+		level  Level
+		scale  float64
+		rotate bool
+	}{
+		{10, High, 1, false},
+		{100, Medium, 1.5, false},
+		{300, Quartile, 1, true},
+		{1024, Low, 2.5, false},
+		{2000, Low, 1, true},
+	} {
+		data := make([]byte, test.length)
+		random.Read(data)
+		c, err := Encode(data, test.level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := transformed(c.Image(2), test.scale, test.rotate)
+		decoded, err := Decode(img)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("Unable to decode %d bytes at version %d-%s: %v", test.length, c.Version, c.Level, err)
+		}
+	}
+}
+
+func TestDecodeDamaged(t *testing.T) {
+	data := []byte("[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n")
+	c, err := Encode(data, Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Damage a few modules away from the function patterns, and invert the colors.
+	for _, xy := range [][2]int{{12, 12}, {14, 20}, {20, 14}, {22, 22}} {
+		c.modules[xy[1]*c.size+xy[0]] = !c.modules[xy[1]*c.size+xy[0]]
+	}
+	img := image.NewGray(c.Image(4).Bounds())
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			if c.Dark(x/4-QuietZone, y/4-QuietZone) {
+				img.SetGray(x, y, color.Gray{0xff})
+			}
+		}
+	}
+	decoded, err := Decode(img)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("Unable to decode damaged, inverted code: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, c.Image(3), &jpeg.Options{Quality: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpegImg, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = Decode(jpegImg)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("Unable to decode JPEG: %v", err)
+	}
+
+	_, err = Decode(image.NewGray(image.Rect(0, 0, 100, 100)))
+	if err != ErrNotFound {
+		t.Errorf("Expected no code to be found, got %v", err)
+	}
+}
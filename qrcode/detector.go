@@ -0,0 +1,297 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// bitmap is an image reduced to dark and light pixels.
+type bitmap struct {
+	width  int
+	height int
+	dark   []bool
+}
+
+func (b *bitmap) get(x, y int) bool {
+	if x < 0 || y < 0 || x >= b.width || y >= b.height {
+		return false
+	}
+	return b.dark[y*b.width+x]
+}
+
+// binarize splits img into dark and light at the threshold that best separates its histogram of
+// luminance, which is Otsu's method. That suits screenshots, which are not lit unevenly like photos.
+func binarize(img image.Image, invert bool) *bitmap {
+	bounds := img.Bounds()
+	b := &bitmap{width: bounds.Dx(), height: bounds.Dy()}
+	luma := make([]uint8, b.width*b.height)
+	var histogram [256]int
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			r, g, bl, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			// Transparent pixels are taken to be on a light background.
+			l := (299*r + 587*g + 114*bl + 1000*(0xffff-a)) / 1000 >> 8
+			if l > 255 {
+				l = 255
+			}
+			luma[y*b.width+x] = uint8(l)
+			histogram[l]++
+		}
+	}
+
+	total := float64(len(luma))
+	var sum float64
+	for i, n := range histogram {
+		sum += float64(i * n)
+	}
+	var sumBelow, weightBelow, bestVariance float64
+	threshold := 127
+	for i, n := range histogram {
+		weightBelow += float64(n)
+		if weightBelow == 0 {
+			continue
+		}
+		weightAbove := total - weightBelow
+		if weightAbove == 0 {
+			break
+		}
+		sumBelow += float64(i * n)
+		meanBelow := sumBelow / weightBelow
+		meanAbove := (sum - sumBelow) / weightAbove
+		variance := weightBelow * weightAbove * (meanBelow - meanAbove) * (meanBelow - meanAbove)
+		if variance > bestVariance {
+			bestVariance = variance
+			threshold = i
+		}
+	}
+
+	b.dark = make([]bool, len(luma))
+	for i, l := range luma {
+		b.dark[i] = (int(l) <= threshold) != invert
+	}
+	return b
+}
+
+type finderPattern struct {
+	x, y       float64
+	moduleSize float64
+	count      int
+}
+
+// crossRatio says whether five runs of pixels look like the 1:1:3:1:1 line through a finder pattern.
+func crossRatio(runs [5]int) bool {
+	total := 0
+	for _, run := range runs {
+		if run == 0 {
+			return false
+		}
+		total += run
+	}
+	if total < 7 {
+		return false
+	}
+	moduleSize := float64(total) / 7
+	variance := moduleSize / 2
+	return math.Abs(moduleSize-float64(runs[0])) < variance &&
+		math.Abs(moduleSize-float64(runs[1])) < variance &&
+		math.Abs(3*moduleSize-float64(runs[2])) < 3*variance &&
+		math.Abs(moduleSize-float64(runs[3])) < variance &&
+		math.Abs(moduleSize-float64(runs[4])) < variance
+}
+
+// crossCheck measures the five runs along a line through (x, y) in the direction (dx, dy), which must
+// be in the middle of the center of a finder pattern, and returns the position of the center along
+// that line, or NaN if there is no finder pattern there.
+func (b *bitmap) crossCheck(x, y, dx, dy int, maxRun int, originalTotal int) float64 {
+	var runs [5]int
+	i, j := x, y
+	for b.get(i, j) {
+		runs[2]++
+		i, j = i-dx, j-dy
+	}
+	for i >= 0 && j >= 0 && !b.get(i, j) && runs[1] <= maxRun {
+		runs[1]++
+		i, j = i-dx, j-dy
+	}
+	for b.get(i, j) && runs[0] <= maxRun {
+		runs[0]++
+		i, j = i-dx, j-dy
+	}
+	i, j = x+dx, y+dy
+	for b.get(i, j) {
+		runs[2]++
+		i, j = i+dx, j+dy
+	}
+	for i < b.width && j < b.height && !b.get(i, j) && runs[3] <= maxRun {
+		runs[3]++
+		i, j = i+dx, j+dy
+	}
+	for b.get(i, j) && runs[4] <= maxRun {
+		runs[4]++
+		i, j = i+dx, j+dy
+	}
+	total := runs[0] + runs[1] + runs[2] + runs[3] + runs[4]
+	if runs[0] > maxRun || runs[1] > maxRun || runs[3] > maxRun || runs[4] > maxRun ||
+		5*abs(total-originalTotal) >= 2*originalTotal || !crossRatio(runs) {
+		return math.NaN()
+	}
+	end := i*dx + j*dy
+	return float64(end) - float64(runs[4]) - float64(runs[3]) - float64(runs[2])/2
+}
+
+// findFinderPatterns scans the rows of b for runs that look like finder patterns, and keeps those that
+// also look like one vertically, merging the ones found on several rows.
+func (b *bitmap) findFinderPatterns() []*finderPattern {
+	var patterns []*finderPattern
+	found := func(runs [5]int, x, y int) {
+		total := runs[0] + runs[1] + runs[2] + runs[3] + runs[4]
+		centerX := x - runs[4] - runs[3] - runs[2]/2
+		centerY := b.crossCheck(centerX, y, 0, 1, runs[2], total)
+		if math.IsNaN(centerY) {
+			return
+		}
+		centerXf := b.crossCheck(centerX, int(centerY), 1, 0, runs[2], total)
+		if math.IsNaN(centerXf) {
+			return
+		}
+		moduleSize := float64(total) / 7
+		for _, p := range patterns {
+			if math.Abs(p.x-centerXf) <= moduleSize && math.Abs(p.y-centerY) <= moduleSize && math.Abs(p.moduleSize-moduleSize) <= math.Max(1, p.moduleSize/2) {
+				n := float64(p.count)
+				p.x = (p.x*n + centerXf) / (n + 1)
+				p.y = (p.y*n + centerY) / (n + 1)
+				p.moduleSize = (p.moduleSize*n + moduleSize) / (n + 1)
+				p.count++
+				return
+			}
+		}
+		patterns = append(patterns, &finderPattern{x: centerXf, y: centerY, moduleSize: moduleSize, count: 1})
+	}
+
+	for y := 0; y < b.height; y++ {
+		var runs [5]int
+		state := 0
+		for x := 0; x <= b.width; x++ {
+			dark := x < b.width && b.get(x, y)
+			if dark == (state%2 == 0) {
+				runs[state]++
+				continue
+			}
+			if state < 4 {
+				state++
+				runs[state] = 1
+				continue
+			}
+			// A light pixel after the fifth run.
+			if crossRatio(runs) {
+				found(runs, x, y)
+			}
+			runs = [5]int{runs[2], runs[3], runs[4], 1, 0}
+			state = 3
+		}
+	}
+	return patterns
+}
+
+// chooseFinderPatterns picks the three patterns, among those seen most often, that best form the
+// corners of a square, and returns them as the top left, top right, and bottom left ones.
+func chooseFinderPatterns(patterns []*finderPattern) (topLeft, topRight, bottomLeft *finderPattern, ok bool) {
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return patterns[i].count > patterns[j].count
+	})
+	if len(patterns) > 10 {
+		patterns = patterns[:10]
+	}
+	distance := func(a, b *finderPattern) float64 {
+		return math.Hypot(a.x-b.x, a.y-b.y)
+	}
+	bestScore := math.Inf(1)
+	for i := 0; i < len(patterns); i++ {
+		for j := i + 1; j < len(patterns); j++ {
+			for k := j + 1; k < len(patterns); k++ {
+				triple := [3]*finderPattern{patterns[i], patterns[j], patterns[k]}
+				// The corner is the pattern opposite the longest side.
+				corner := 0
+				longest := 0.0
+				for c := 0; c < 3; c++ {
+					if d := distance(triple[(c+1)%3], triple[(c+2)%3]); d > longest {
+						corner, longest = c, d
+					}
+				}
+				a, tl, c := triple[(corner+1)%3], triple[corner], triple[(corner+2)%3]
+				legA, legC := distance(tl, a), distance(tl, c)
+				minSize := math.Min(a.moduleSize, math.Min(tl.moduleSize, c.moduleSize))
+				maxSize := math.Max(a.moduleSize, math.Max(tl.moduleSize, c.moduleSize))
+				if maxSize > 1.5*minSize || legA < 7*minSize || legC < 7*minSize {
+					continue
+				}
+				score := math.Abs(legA-legC)/math.Max(legA, legC) + math.Abs(longest-math.Hypot(legA, legC))/longest
+				if score > 0.2 || score >= bestScore {
+					continue
+				}
+				bestScore = score
+				// With y growing downwards, going from the bottom left pattern to the top right one
+				// around the top left one is a clockwise turn.
+				if (c.x-tl.x)*(a.y-tl.y)-(c.y-tl.y)*(a.x-tl.x) < 0 {
+					a, c = c, a
+				}
+				topLeft, topRight, bottomLeft, ok = tl, c, a, true
+			}
+		}
+	}
+	return
+}
+
+// sampler maps the centers of modules to pixels, with an affine transform fixed by the centers of
+// the finder patterns, which are three and a half modules in from the corners.
+type sampler struct {
+	bitmap     *bitmap
+	size       int
+	originX    float64
+	originY    float64
+	colX, colY float64
+	rowX, rowY float64
+}
+
+func newSampler(b *bitmap, size int, topLeft, topRight, bottomLeft *finderPattern) *sampler {
+	span := float64(size - 7)
+	return &sampler{
+		bitmap:  b,
+		size:    size,
+		originX: topLeft.x,
+		originY: topLeft.y,
+		colX:    (topRight.x - topLeft.x) / span,
+		colY:    (topRight.y - topLeft.y) / span,
+		rowX:    (bottomLeft.x - topLeft.x) / span,
+		rowY:    (bottomLeft.y - topLeft.y) / span,
+	}
+}
+
+func (s *sampler) dark(x, y int) bool {
+	u, v := float64(x)-3, float64(y)-3
+	px := s.originX + u*s.colX + v*s.rowX
+	py := s.originY + u*s.colY + v*s.rowY
+	return s.bitmap.get(int(math.Floor(px)), int(math.Floor(py)))
+}
+
+// estimateVersions guesses the version from the distances between finder patterns, and returns it
+// along with its neighbors, to be tried in that order.
+func estimateVersions(topLeft, topRight, bottomLeft *finderPattern) []int {
+	moduleSize := (topLeft.moduleSize + topRight.moduleSize + bottomLeft.moduleSize) / 3
+	across := math.Hypot(topRight.x-topLeft.x, topRight.y-topLeft.y) / moduleSize
+	down := math.Hypot(bottomLeft.x-topLeft.x, bottomLeft.y-topLeft.y) / moduleSize
+	version := int(math.Round(((across+down)/2 + 7 - 17) / 4))
+	var versions []int
+	for _, v := range []int{version, version - 1, version + 1} {
+		if v >= MinVersion && v <= MaxVersion {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
@@ -0,0 +1,533 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Level int
+
+const (
+	Low      Level = iota // Recovers from 7% of codewords being wrong.
+	Medium                // 15%
+	Quartile              // 25%
+	High                  // 30%
+)
+
+func (level Level) String() string {
+	switch level {
+	case Low:
+		return "low"
+	case Medium:
+		return "medium"
+	case Quartile:
+		return "quartile"
+	case High:
+		return "high"
+	}
+	return fmt.Sprintf("unknown-%d", int(level))
+}
+
+// formatBits are the two bits that stand for each level in the format information.
+var formatBits = [...]uint32{Low: 1, Medium: 0, Quartile: 3, High: 2}
+
+// These are indexed by level and then by version, from 1 to 40.
+var eccCodewordsPerBlock = [4][41]int{
+	{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+var eccBlocks = [4][41]int{
+	{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+const (
+	MinVersion = 1
+	MaxVersion = 40
+)
+
+var ErrTooLong = errors.New("Data is too long for a QR code")
+
+// A Code is a QR code symbol, made of Size() by Size() modules, without the quiet zone around it.
+type Code struct {
+	Version int
+	Level   Level
+	Mask    int
+
+	size       int
+	modules    []bool
+	isFunction []bool
+}
+
+func (c *Code) Size() int {
+	return c.size
+}
+
+// Dark says whether the module in column x of row y is dark. Modules outside of the symbol are in the
+// quiet zone, and so are light.
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.size || y >= c.size {
+		return false
+	}
+	return c.modules[y*c.size+x]
+}
+
+// rawDataModules is the number of modules left for codewords and remainder bits once the function
+// patterns are drawn.
+func rawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func dataCodewords(version int, level Level) int {
+	return rawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*eccBlocks[level][version]
+}
+
+// Only byte mode is used, and its character count indicator grows after version 9.
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+func dataBits(version int, length int) int {
+	return 4 + charCountBits(version) + 8*length
+}
+
+// Encode puts data in the smallest version that fits it at the given level, and then raises the
+// level as far as that version allows.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < Low || level > High {
+		return nil, fmt.Errorf("Invalid error correction level %d", int(level))
+	}
+	version := MinVersion
+	for ; version <= MaxVersion; version++ {
+		if dataBits(version, len(data)) <= dataCodewords(version, level)*8 {
+			break
+		}
+	}
+	if version > MaxVersion {
+		return nil, ErrTooLong
+	}
+	for level < High && dataBits(version, len(data)) <= dataCodewords(version, level+1)*8 {
+		level++
+	}
+	return encodeVersion(data, version, level), nil
+}
+
+type bitBuffer struct {
+	bytes []byte
+	n     int
+}
+
+func (b *bitBuffer) append(value uint32, length int) {
+	for i := length - 1; i >= 0; i-- {
+		if b.n%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+		if (value>>uint(i))&1 != 0 {
+			b.bytes[b.n/8] |= 0x80 >> uint(b.n%8)
+		}
+		b.n++
+	}
+}
+
+func encodeVersion(data []byte, version int, level Level) *Code {
+	capacity := dataCodewords(version, level)
+	var bits bitBuffer
+	bits.append(0x4, 4)
+	bits.append(uint32(len(data)), charCountBits(version))
+	for _, b := range data {
+		bits.append(uint32(b), 8)
+	}
+	terminator := capacity*8 - bits.n
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-bits.n%8)%8)
+	for pad := uint32(0xec); len(bits.bytes) < capacity; pad ^= 0xec ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	c := newCode(version, level)
+	c.drawCodewords(addECCAndInterleave(bits.bytes, version, level))
+
+	bestPenalty := -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		penalty := c.penalty()
+		if bestPenalty < 0 || penalty < bestPenalty {
+			c.Mask = mask
+			bestPenalty = penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(c.Mask)
+	c.drawFormatBits(c.Mask)
+	c.isFunction = nil
+	return c
+}
+
+// newCode returns a code with only its function patterns drawn, and with its mask yet to be chosen.
+func newCode(version int, level Level) *Code {
+	c := &Code{Version: version, Level: level, size: version*4 + 17}
+	c.modules = make([]bool, c.size*c.size)
+	c.isFunction = make([]bool, c.size*c.size)
+	c.drawFunctionPatterns()
+	return c
+}
+
+func addECCAndInterleave(data []byte, version int, level Level) []byte {
+	numBlocks := eccBlocks[level][version]
+	blockECCLen := eccCodewordsPerBlock[level][version]
+	rawCodewords := rawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockECCLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		dataLen := shortBlockLen - blockECCLen
+		if i >= numShortBlocks {
+			dataLen++
+		}
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[k:k+dataLen]...)
+		ecc := reedSolomonRemainder(data[k:k+dataLen], divisor)
+		k += dataLen
+		// Short blocks get a placeholder so that all blocks line up, which is skipped below.
+		if i < numShortBlocks {
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := 0; i < len(blocks[0]); i++ {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	var z uint32
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11d)
+		z ^= uint32((y>>uint(i))&1) * uint32(x)
+	}
+	return byte(z)
+}
+
+// reedSolomonDivisor returns the coefficients of the generator polynomial of the given degree, from
+// the highest power down, leaving out the leading one.
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y*c.size+x] = dark
+	c.isFunction[y*c.size+x] = true
+}
+
+// alignmentPositions lists the rows and columns at which alignment patterns are centered.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := 26
+	if version != 32 {
+		step = (version*4 + numAlign*2 + 1) / (numAlign*2 - 2) * 2
+	}
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, pos := numAlign-1, version*4+10; i > 0; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	for _, center := range [][2]int{{3, 3}, {c.size - 4, 3}, {3, c.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x >= 0 && x < c.size && y >= 0 && y < c.size {
+					dist := max(abs(dx), abs(dy))
+					c.setFunction(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	positions := alignmentPositions(c.Version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// These would overlap the finder patterns.
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// The format information is drawn for real once the mask is chosen, but it has to be marked as
+	// a function pattern before the codewords are drawn.
+	c.drawFormatBits(0)
+
+	if c.Version >= 7 {
+		bits := versionInformation(c.Version)
+		for i := 0; i < 18; i++ {
+			bit := (bits>>uint(i))&1 != 0
+			a, b := c.size-11+i%3, i/3
+			c.setFunction(a, b, bit)
+			c.setFunction(b, a, bit)
+		}
+	}
+}
+
+// formatInformation is the level and mask, followed by their BCH code, and then masked.
+func formatInformation(level Level, mask int) uint32 {
+	data := formatBits[level]<<3 | uint32(mask)
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionInformation is the version followed by its Golay code.
+func versionInformation(version int) uint32 {
+	rem := uint32(version)
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1f25)
+	}
+	return uint32(version)<<12 | rem
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatInformation(c.Level, mask)
+	bit := func(i int) bool {
+		return (bits>>uint(i))&1 != 0
+	}
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.size-15+i, bit(i))
+	}
+	c.setFunction(8, c.size-8, true)
+}
+
+// forEachDataModule visits the modules that are not part of function patterns in the order that
+// codewords fill them, which is a zigzag, two columns at a time, from the bottom right corner, skipping
+// the vertical timing pattern.
+func (c *Code) forEachDataModule(visit func(x, y int)) {
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vert
+				}
+				if !c.isFunction[y*c.size+x] {
+					visit(x, y)
+				}
+			}
+		}
+	}
+}
+
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	c.forEachDataModule(func(x, y int) {
+		if i < len(data)*8 {
+			c.modules[y*c.size+x] = (data[i/8]>>uint(7-i%8))&1 != 0
+			i++
+		}
+	})
+}
+
+func maskInverts(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	case 7:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+	return false
+}
+
+// applyMask inverts the modules selected by mask, other than function patterns. Applying it twice
+// undoes it.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if !c.isFunction[y*c.size+x] && maskInverts(mask, x, y) {
+				c.modules[y*c.size+x] = !c.modules[y*c.size+x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to read, with the rules of the specification: long runs of one
+// color, two by two blocks of one color, patterns that look like finders, and unbalanced colors.
+func (c *Code) penalty() int {
+	score := 0
+	for i := 0; i < c.size; i++ {
+		score += c.linePenalty(func(j int) bool { return c.Dark(j, i) })
+		score += c.linePenalty(func(j int) bool { return c.Dark(i, j) })
+	}
+
+	dark := 0
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			color := c.Dark(x, y)
+			if color {
+				dark++
+			}
+			if x+1 < c.size && y+1 < c.size && color == c.Dark(x+1, y) && color == c.Dark(x, y+1) && color == c.Dark(x+1, y+1) {
+				score += 3
+			}
+		}
+	}
+	total := c.size * c.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	score += k * 10
+	return score
+}
+
+func (c *Code) linePenalty(dark func(int) bool) int {
+	score := 0
+	run := 1
+	for i := 1; i <= c.size; i++ {
+		if i < c.size && dark(i) == dark(i-1) {
+			run++
+			continue
+		}
+		if run >= 5 {
+			score += 3 + run - 5
+		}
+		run = 1
+	}
+
+	// Outside of the symbol is the light quiet zone, which dark reports only within it.
+	light := func(i int) bool {
+		return i < 0 || i >= c.size || !dark(i)
+	}
+	for i := 0; i+7 <= c.size; i++ {
+		if !dark(i) || light(i+1) || !dark(i+2) || !dark(i+3) || !dark(i+4) || light(i+5) || !dark(i+6) {
+			continue
+		}
+		before, after := true, true
+		for j := 1; j <= 4; j++ {
+			before = before && light(i-j)
+			after = after && light(i+6+j)
+		}
+		if before || after {
+			score += 40
+		}
+	}
+	return score
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
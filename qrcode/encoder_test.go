@@ -0,0 +1,97 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInformationBits(t *testing.T) {
+	if bits := formatInformation(Low, 0); bits != 0x77c4 {
+		t.Errorf("Format information for low, mask 0 is %#x", bits)
+	}
+	if bits := formatInformation(Medium, 0); bits != 0x5412 {
+		t.Errorf("Format information for medium, mask 0 is %#x", bits)
+	}
+	if bits := formatInformation(High, 7); bits != 0x083b {
+		t.Errorf("Format information for high, mask 7 is %#x", bits)
+	}
+	if bits := versionInformation(7); bits != 0x07c94 {
+		t.Errorf("Version information for version 7 is %#x", bits)
+	}
+	if bits := versionInformation(40); bits != 0x28c69 {
+		t.Errorf("Version information for version 40 is %#x", bits)
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	// Version 1-M, "HELLO WORLD" in alphanumeric mode.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	ecc := reedSolomonRemainder(data, reedSolomonDivisor(10))
+	if expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}; !bytes.Equal(ecc, expected) {
+		t.Errorf("Error correction codewords are %v, not %v", ecc, expected)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	for _, test := range []struct {
+		version int
+		level   Level
+		bytes   int
+	}{
+		{1, Low, 17}, {1, Medium, 14}, {1, Quartile, 11}, {1, High, 7},
+		{10, Low, 271}, {10, Medium, 213}, {10, Quartile, 151}, {10, High, 119},
+		{40, Low, 2953}, {40, Medium, 2331}, {40, Quartile, 1663}, {40, High, 1273},
+	} {
+		capacity := (dataCodewords(test.version, test.level)*8 - 4 - charCountBits(test.version)) / 8
+		if capacity != test.bytes {
+			t.Errorf("Version %d-%s holds %d bytes, not %d", test.version, test.level, capacity, test.bytes)
+		}
+	}
+}
+
+func TestFunctionPatterns(t *testing.T) {
+	for version := MinVersion; version <= MaxVersion; version++ {
+		c := newCode(version, Low)
+		free := 0
+		for _, isFunction := range c.isFunction {
+			if !isFunction {
+				free++
+			}
+		}
+		if free != rawDataModules(version) {
+			t.Errorf("Version %d has %d modules for data, not %d", version, free, rawDataModules(version))
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	c, err := Encode([]byte(strings.Repeat("x", 1024)), Low)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 23 || c.Level != Low || c.Size() != 109 {
+		t.Errorf("Encoded 1 KiB as version %d-%s of size %d", c.Version, c.Level, c.Size())
+	}
+	// The top left finder pattern and the dark module.
+	if !c.Dark(0, 0) || c.Dark(1, 1) || !c.Dark(3, 3) || c.Dark(7, 7) || !c.Dark(8, c.Size()-8) {
+		t.Error("Function patterns are misplaced")
+	}
+	if lines := strings.Count(c.ToTerminal(), "\n"); lines != (c.Size()+2*QuietZone+1)/2 {
+		t.Errorf("Terminal output has %d lines", lines)
+	}
+	png, err := c.ToPNG(2)
+	if err != nil || !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Errorf("Unable to make PNG: %v", err)
+	}
+
+	_, err = Encode(make([]byte, 2954), Low)
+	if err != ErrTooLong {
+		t.Errorf("Expected too long, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// QuietZone is the number of light modules that readers need on each side of a symbol.
+const QuietZone = 4
+
+// Image draws the symbol and its quiet zone with each module taking scale by scale pixels.
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	side := (c.size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			if c.Dark(x/scale-QuietZone, y/scale-QuietZone) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img
+}
+
+func (c *Code) ToPNG(scale int) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, c.Image(scale))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ToTerminal draws the symbol and its quiet zone with block characters, two rows of modules to a line.
+// Since terminals usually draw light text on a dark background, it is the light modules that are
+// drawn, which makes the dark ones dark.
+func (c *Code) ToTerminal() string {
+	var output strings.Builder
+	for y := -QuietZone; y < c.size+QuietZone; y += 2 {
+		for x := -QuietZone; x < c.size+QuietZone; x++ {
+			upper := !c.Dark(x, y)
+			lower := !c.Dark(x, y+1)
+			switch {
+			case upper && lower:
+				output.WriteRune('█')
+			case upper:
+				output.WriteRune('▀')
+			case lower:
+				output.WriteRune('▄')
+			default:
+				output.WriteRune(' ')
+			}
+		}
+		output.WriteRune('\n')
+	}
+	return output.String()
+}
@@ -31,6 +31,8 @@ const (
 	ErrorTrackTunnels
 	ErrorEnumerateSessions
 	ErrorDropPrivileges
+	ErrorRunScript
+	ErrorOpenStore
 	ErrorWin32
 )
 
@@ -68,6 +70,10 @@ func (e Error) Error() string {
 		return "Unable to enumerate current sessions"
 	case ErrorDropPrivileges:
 		return "Unable to drop privileges"
+	case ErrorRunScript:
+		return "Unable to run PreUp, PostUp, PreDown, or PostDown command"
+	case ErrorOpenStore:
+		return "Unable to open configuration store"
 	case ErrorWin32:
 		return "An internal Windows error has occurred"
 	default:
@@ -7,12 +7,14 @@ package service
 
 import (
 	"bytes"
+	"fmt"
 	"log"
 	"net"
-	"sort"
+	"strings"
 	"time"
 
 	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
 	"golang.zx2c4.com/winipcfg"
 	"golang.zx2c4.com/wireguard/device"
 	"golang.zx2c4.com/wireguard/tun"
@@ -195,62 +197,63 @@ func cleanupAddressesOnDisconnectedInterfaces(addresses []*net.IPNet) {
 	}
 }
 
-func configureInterface(conf *conf.Config, tun *tun.NativeTun) error {
+func setDNSSearchList(adapterName string, domains []string) error {
+	for _, stack := range []string{"Tcpip", "Tcpip6"} {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, fmt.Sprintf(`SYSTEM\CurrentControlSet\Services\%s\Parameters\Interfaces\%s`, stack, adapterName), registry.SET_VALUE)
+		if err == registry.ErrNotExist {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if len(domains) > 0 {
+			err = key.SetStringValue("SearchList", strings.Join(domains, ","))
+		} else {
+			err = key.DeleteValue("SearchList")
+			if err == registry.ErrNotExist {
+				err = nil
+			}
+		}
+		key.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func configureInterface(config *conf.Config, tun *tun.NativeTun) error {
 	iface, err := winipcfg.InterfaceFromLUID(tun.LUID())
 	if err != nil {
 		return err
 	}
 
-	estimatedRouteCount := len(conf.Interface.Addresses)
-	for _, peer := range conf.Peers {
-		estimatedRouteCount += len(peer.AllowedIPs)
-	}
-	routes := make([]winipcfg.RouteData, 0, estimatedRouteCount)
-	var firstGateway4 *net.IP
-	var firstGateway6 *net.IP
-	addresses := make([]*net.IPNet, len(conf.Interface.Addresses))
-	for i, addr := range conf.Interface.Addresses {
+	addresses := make([]*net.IPNet, len(config.Interface.Addresses))
+	for i, addr := range config.Interface.Addresses {
 		ipnet := addr.IPNet()
 		addresses[i] = &ipnet
-		gateway := ipnet.IP.Mask(ipnet.Mask)
-		if addr.Bits() == 32 && firstGateway4 == nil {
-			firstGateway4 = &gateway
-		} else if addr.Bits() == 128 && firstGateway6 == nil {
-			firstGateway6 = &gateway
-		}
-		routes = append(routes, winipcfg.RouteData{
-			Destination: net.IPNet{
-				IP:   gateway,
-				Mask: ipnet.Mask,
-			},
-			NextHop: gateway,
-			Metric:  0,
-		})
 	}
 
+	if config.Interface.Table.ID != 0 {
+		name, _ := tun.Name()
+		log.Printf("[%s] Warning: routing table %d requested, but Windows has only a single routing table, so routes will be added to it.", name, config.Interface.Table.ID)
+	}
+
+	plannedRoutes := conf.PlanRoutes(config)
+	routes := make([]*winipcfg.RouteData, len(plannedRoutes))
 	foundDefault4 := false
 	foundDefault6 := false
-	for _, peer := range conf.Peers {
-		for _, allowedip := range peer.AllowedIPs {
-			if (allowedip.Bits() == 32 && firstGateway4 == nil) || (allowedip.Bits() == 128 && firstGateway6 == nil) {
-				continue
-			}
-			route := winipcfg.RouteData{
-				Destination: allowedip.IPNet(),
-				Metric:      0,
-			}
-			if allowedip.Bits() == 32 {
-				if allowedip.Cidr == 0 {
-					foundDefault4 = true
-				}
-				route.NextHop = *firstGateway4
-			} else if allowedip.Bits() == 128 {
-				if allowedip.Cidr == 0 {
-					foundDefault6 = true
-				}
-				route.NextHop = *firstGateway6
+	for i, route := range plannedRoutes {
+		routes[i] = &winipcfg.RouteData{
+			Destination: route.Destination.IPNet(),
+			NextHop:     route.NextHop,
+			Metric:      route.Metric,
+		}
+		if route.Destination.Cidr == 0 {
+			if route.Destination.Bits() == 32 {
+				foundDefault4 = true
+			} else {
+				foundDefault6 = true
 			}
-			routes = append(routes, route)
 		}
 	}
 
@@ -263,29 +266,17 @@ func configureInterface(conf *conf.Config, tun *tun.NativeTun) error {
 		return err
 	}
 
-	deduplicatedRoutes := make([]*winipcfg.RouteData, 0, len(routes))
-	sort.Slice(routes, func(i, j int) bool {
-		return routes[i].Metric < routes[j].Metric ||
-			bytes.Compare(routes[i].NextHop, routes[j].NextHop) == -1 ||
-			bytes.Compare(routes[i].Destination.IP, routes[j].Destination.IP) == -1 ||
-			bytes.Compare(routes[i].Destination.Mask, routes[j].Destination.Mask) == -1
-	})
-	for i := 0; i < len(routes); i++ {
-		if i > 0 && routes[i].Metric == routes[i-1].Metric &&
-			bytes.Equal(routes[i].NextHop, routes[i-1].NextHop) &&
-			bytes.Equal(routes[i].Destination.IP, routes[i-1].Destination.IP) &&
-			bytes.Equal(routes[i].Destination.Mask, routes[i-1].Destination.Mask) {
-			continue
-		}
-		deduplicatedRoutes = append(deduplicatedRoutes, &routes[i])
+	err = iface.SetRoutes(routes)
+	if err != nil {
+		return err
 	}
 
-	err = iface.SetRoutes(deduplicatedRoutes)
+	err = iface.SetDNS(config.Interface.DNS)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	err = iface.SetDNS(conf.Interface.DNS)
+	err = setDNSSearchList(iface.AdapterName, config.Interface.DNSSearch)
 	if err != nil {
 		return err
 	}
@@ -298,8 +289,8 @@ func configureInterface(conf *conf.Config, tun *tun.NativeTun) error {
 		ipif.UseAutomaticMetric = false
 		ipif.Metric = 0
 	}
-	if conf.Interface.MTU > 0 {
-		ipif.NLMTU = uint32(conf.Interface.MTU)
+	if config.Interface.MTU > 0 {
+		ipif.NLMTU = uint32(config.Interface.MTU)
 		tun.ForceMTU(int(ipif.NLMTU))
 	}
 	err = ipif.Set()
@@ -315,8 +306,8 @@ func configureInterface(conf *conf.Config, tun *tun.NativeTun) error {
 		ipif.UseAutomaticMetric = false
 		ipif.Metric = 0
 	}
-	if conf.Interface.MTU > 0 {
-		ipif.NLMTU = uint32(conf.Interface.MTU)
+	if config.Interface.MTU > 0 {
+		ipif.NLMTU = uint32(config.Interface.MTU)
 	}
 	ipif.DadTransmits = 0
 	ipif.RouterDiscoveryBehavior = winipcfg.RouterDiscoveryDisabled
@@ -328,9 +319,8 @@ func configureInterface(conf *conf.Config, tun *tun.NativeTun) error {
 	return nil
 }
 
-func enableFirewall(conf *conf.Config, tun *tun.NativeTun) error {
-	restrictAll := false
-	if len(conf.Peers) == 1 {
+func firewallRestrictsAll(conf *conf.Config) bool {
+	if len(conf.Peers) == 1 && !conf.Interface.Table.Off {
 	nextallowedip:
 		for _, allowedip := range conf.Peers[0].AllowedIPs {
 			if allowedip.Cidr == 0 {
@@ -339,11 +329,15 @@ func enableFirewall(conf *conf.Config, tun *tun.NativeTun) error {
 						continue nextallowedip
 					}
 				}
-				restrictAll = true
-				break
+				return true
 			}
 		}
 	}
+	return false
+}
+
+func enableFirewall(conf *conf.Config, tun *tun.NativeTun) error {
+	restrictAll := firewallRestrictsAll(conf)
 	if restrictAll && len(conf.Interface.DNS) == 0 {
 		name, _ := tun.Name()
 		log.Printf("[%s] Warning: no DNS server specified, despite having an allowed IPs of 0.0.0.0/0 or ::/0. There may be connectivity issues.", name)
@@ -19,6 +19,38 @@ type Tunnel struct {
 	Name string
 }
 
+// StoredConfig and StoredDocument come with the revision token of what was loaded, which Update
+// needs in order to tell whether someone else has changed the tunnel in the meantime.
+type StoredConfig struct {
+	Config        conf.Config
+	RevisionToken string
+}
+
+type StoredDocument struct {
+	Document      conf.Document
+	RevisionToken string
+}
+
+type UpdateRequest struct {
+	Document      conf.Document
+	RevisionToken string
+}
+
+type MetadataRequest struct {
+	TunnelName string
+	Metadata   conf.Metadata
+}
+
+type RenameRequest struct {
+	OldName string
+	NewName string
+}
+
+type RevisionRequest struct {
+	TunnelName string
+	Revision   string
+}
+
 type TunnelState int
 
 const (
@@ -37,6 +69,8 @@ const (
 	ManagerStoppingNotificationType
 	UpdateFoundNotificationType
 	UpdateProgressNotificationType
+	StoreEventNotificationType
+	TunnelRenameNotificationType
 )
 
 var rpcClient *rpc.Client
@@ -47,6 +81,12 @@ type TunnelChangeCallback struct {
 
 var tunnelChangeCallbacks = make(map[*TunnelChangeCallback]bool)
 
+type TunnelRenameCallback struct {
+	cb func(oldName string, tunnel *Tunnel, state TunnelState, globalState TunnelState, err error)
+}
+
+var tunnelRenameCallbacks = make(map[*TunnelRenameCallback]bool)
+
 type TunnelsChangeCallback struct {
 	cb func()
 }
@@ -71,6 +111,12 @@ type UpdateProgressCallback struct {
 
 var updateProgressCallbacks = make(map[*UpdateProgressCallback]bool)
 
+type StoreEventCallback struct {
+	cb func(event conf.StoreEvent)
+}
+
+var storeEventCallbacks = make(map[*StoreEventCallback]bool)
+
 func InitializeIPCClient(reader *os.File, writer *os.File, events *os.File) {
 	rpcClient = rpc.NewClient(&pipeRWC{reader, writer})
 	go func() {
@@ -160,14 +206,71 @@ func InitializeIPCClient(reader *os.File, writer *os.File, events *os.File) {
 				for cb := range updateProgressCallbacks {
 					cb.cb(dp)
 				}
+			case StoreEventNotificationType:
+				var event conf.StoreEvent
+				err = decoder.Decode(&event.Type)
+				if err != nil {
+					continue
+				}
+				err = decoder.Decode(&event.Name)
+				if err != nil {
+					continue
+				}
+				err = decoder.Decode(&event.OldName)
+				if err != nil {
+					continue
+				}
+				for cb := range storeEventCallbacks {
+					cb.cb(event)
+				}
+			case TunnelRenameNotificationType:
+				var oldName, newName string
+				err = decoder.Decode(&oldName)
+				if err != nil {
+					continue
+				}
+				err = decoder.Decode(&newName)
+				if err != nil || len(newName) == 0 {
+					continue
+				}
+				var state TunnelState
+				err = decoder.Decode(&state)
+				if err != nil {
+					continue
+				}
+				var globalState TunnelState
+				err = decoder.Decode(&globalState)
+				if err != nil {
+					continue
+				}
+				var errStr string
+				err = decoder.Decode(&errStr)
+				if err != nil {
+					continue
+				}
+				var retErr error
+				if len(errStr) > 0 {
+					retErr = errors.New(errStr)
+				}
+				t := &Tunnel{newName}
+				for cb := range tunnelRenameCallbacks {
+					cb.cb(oldName, t, state, globalState, retErr)
+				}
 			}
 		}
 	}()
 }
 
-func (t *Tunnel) StoredConfig() (c conf.Config, err error) {
-	err = rpcClient.Call("ManagerService.StoredConfig", t.Name, &c)
-	return
+func (t *Tunnel) StoredConfig() (c conf.Config, revisionToken string, err error) {
+	var stored StoredConfig
+	err = rpcClient.Call("ManagerService.StoredConfig", t.Name, &stored)
+	return stored.Config, stored.RevisionToken, err
+}
+
+func (t *Tunnel) StoredDocument() (d conf.Document, revisionToken string, err error) {
+	var stored StoredDocument
+	err = rpcClient.Call("ManagerService.StoredDocument", t.Name, &stored)
+	return stored.Document, stored.RevisionToken, err
 }
 
 func (t *Tunnel) RuntimeConfig() (c conf.Config, err error) {
@@ -197,6 +300,57 @@ func (t *Tunnel) Toggle() (oldState TunnelState, err error) {
 	return
 }
 
+// Reconfigure saves doc as the configuration of t, and if t is running, applies the changes to it,
+// restarting it only if the changes cannot be applied in place.
+func (t *Tunnel) Reconfigure(doc *conf.Document) error {
+	if doc.Name != t.Name {
+		return errors.New("Configuration name does not match tunnel name")
+	}
+	return rpcClient.Call("ManagerService.Reconfigure", *doc, nil)
+}
+
+func (t *Tunnel) Metadata() (m conf.Metadata, err error) {
+	err = rpcClient.Call("ManagerService.Metadata", t.Name, &m)
+	return
+}
+
+// SetMetadata replaces the metadata of t, and clearing every field removes it.
+func (t *Tunnel) SetMetadata(m *conf.Metadata) error {
+	return rpcClient.Call("ManagerService.SetMetadata", MetadataRequest{t.Name, *m}, nil)
+}
+
+// Revisions lists the saved versions of the configuration of t, newest first.
+func (t *Tunnel) Revisions() (revisions []conf.Revision, err error) {
+	err = rpcClient.Call("ManagerService.Revisions", t.Name, &revisions)
+	return
+}
+
+func (t *Tunnel) StoredRevision(id string) (d conf.Document, err error) {
+	err = rpcClient.Call("ManagerService.StoredRevision", RevisionRequest{t.Name, id}, &d)
+	return
+}
+
+// RestoreRevision makes the revision id the configuration of t again, applying it the way Reconfigure
+// does if t is running.
+func (t *Tunnel) RestoreRevision(id string) error {
+	return rpcClient.Call("ManagerService.RestoreRevision", RevisionRequest{t.Name, id}, nil)
+}
+
+// Update saves doc as the configuration of t, like Reconfigure, but fails if the stored configuration
+// is no longer the one that revisionToken came with.
+func (t *Tunnel) Update(doc *conf.Document, revisionToken string) error {
+	if doc.Name != t.Name {
+		return errors.New("Configuration name does not match tunnel name")
+	}
+	return rpcClient.Call("ManagerService.UpdateTunnel", UpdateRequest{*doc, revisionToken}, nil)
+}
+
+// Rename renames t, restarting it under its new name if it is running, and returns the renamed tunnel.
+func (t *Tunnel) Rename(newName string) (Tunnel, error) {
+	var tunnel Tunnel
+	return tunnel, rpcClient.Call("ManagerService.Rename", RenameRequest{t.Name, newName}, &tunnel)
+}
+
 func (t *Tunnel) WaitForStop() error {
 	return rpcClient.Call("ManagerService.WaitForStop", t.Name, nil)
 }
@@ -215,11 +369,28 @@ func IPCClientNewTunnel(conf *conf.Config) (Tunnel, error) {
 	return tunnel, rpcClient.Call("ManagerService.Create", *conf, &tunnel)
 }
 
+func IPCClientNewTunnelFromDocument(doc *conf.Document) (Tunnel, error) {
+	var tunnel Tunnel
+	return tunnel, rpcClient.Call("ManagerService.CreateFromDocument", *doc, &tunnel)
+}
+
 func IPCClientTunnels() ([]Tunnel, error) {
 	var tunnels []Tunnel
 	return tunnels, rpcClient.Call("ManagerService.Tunnels", uintptr(0), &tunnels)
 }
 
+func IPCClientStoreHealth() ([]conf.FileReport, error) {
+	var reports []conf.FileReport
+	return reports, rpcClient.Call("ManagerService.StoreHealth", uintptr(0), &reports)
+}
+
+// IPCClientQuarantineBrokenConfigs moves the broken files of the configurations directory aside, and
+// returns the reports of those that were moved.
+func IPCClientQuarantineBrokenConfigs() ([]conf.FileReport, error) {
+	var reports []conf.FileReport
+	return reports, rpcClient.Call("ManagerService.QuarantineBroken", uintptr(0), &reports)
+}
+
 func IPCClientGlobalState() (TunnelState, error) {
 	var state TunnelState
 	return state, rpcClient.Call("ManagerService.GlobalState", uintptr(0), &state)
@@ -247,6 +418,14 @@ func IPCClientRegisterTunnelChange(cb func(tunnel *Tunnel, state TunnelState, gl
 func (cb *TunnelChangeCallback) Unregister() {
 	delete(tunnelChangeCallbacks, cb)
 }
+func IPCClientRegisterTunnelRename(cb func(oldName string, tunnel *Tunnel, state TunnelState, globalState TunnelState, err error)) *TunnelRenameCallback {
+	s := &TunnelRenameCallback{cb}
+	tunnelRenameCallbacks[s] = true
+	return s
+}
+func (cb *TunnelRenameCallback) Unregister() {
+	delete(tunnelRenameCallbacks, cb)
+}
 func IPCClientRegisterTunnelsChange(cb func()) *TunnelsChangeCallback {
 	s := &TunnelsChangeCallback{cb}
 	tunnelsChangeCallbacks[s] = true
@@ -279,3 +458,11 @@ func IPCClientRegisterUpdateProgress(cb func(dp updater.DownloadProgress)) *Upda
 func (cb *UpdateProgressCallback) Unregister() {
 	delete(updateProgressCallbacks, cb)
 }
+func IPCClientRegisterStoreEvent(cb func(event conf.StoreEvent)) *StoreEventCallback {
+	s := &StoreEventCallback{cb}
+	storeEventCallbacks[s] = true
+	return s
+}
+func (cb *StoreEventCallback) Unregister() {
+	delete(storeEventCallbacks, cb)
+}
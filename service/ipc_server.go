@@ -8,6 +8,7 @@ package service
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -33,41 +34,73 @@ var quitManagersChan = make(chan struct{}, 1)
 type ManagerService struct {
 	events        *os.File
 	elevatedToken windows.Token
+	store         conf.ConfigStore
 }
 
-func (s *ManagerService) StoredConfig(tunnelName string, config *conf.Config) error {
-	c, err := conf.LoadFromName(tunnelName)
+func (s *ManagerService) StoredConfig(tunnelName string, stored *StoredConfig) error {
+	d, err := s.store.Load(tunnelName)
 	if err != nil {
 		return err
 	}
-	*config = *c
+	c, err := d.Config()
+	if err != nil {
+		return err
+	}
+	*stored = StoredConfig{*c, d.RevisionToken()}
 	return nil
 }
 
-func (s *ManagerService) RuntimeConfig(tunnelName string, config *conf.Config) error {
-	storedConfig, err := conf.LoadFromName(tunnelName)
+func (s *ManagerService) StoredDocument(tunnelName string, stored *StoredDocument) error {
+	d, err := s.store.Load(tunnelName)
 	if err != nil {
 		return err
 	}
-	pipePath, err := PipePathOfTunnel(storedConfig.Name)
+	*stored = StoredDocument{*d, d.RevisionToken()}
+	return nil
+}
+
+// tunnelConfigPath finds the file that the tunnel service of tunnelName reads its configuration from,
+// which only stores that keep files have.
+func tunnelConfigPath(store conf.ConfigStore, tunnelName string) (string, error) {
+	fileStore, ok := store.(*conf.FileStore)
+	if !ok {
+		return "", errors.New("Tunnels can only be started from configurations stored in files")
+	}
+	return fileStore.Path(tunnelName)
+}
+
+func tunnelUAPIOperation(tunnelName string, request string) ([]byte, error) {
+	return tunnelPipeOperation(tunnelName, request, time.Second*2)
+}
+
+func tunnelPipeOperation(tunnelName string, request string, timeout time.Duration) ([]byte, error) {
+	pipePath, err := PipePathOfTunnel(tunnelName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	pipe, err := winio.DialPipe(pipePath, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer pipe.Close()
 	pipe.SetWriteDeadline(time.Now().Add(time.Second * 2))
-	_, err = pipe.Write([]byte("get=1\n\n"))
+	_, err = pipe.Write([]byte(request))
+	if err != nil {
+		return nil, err
+	}
+	pipe.SetReadDeadline(time.Now().Add(timeout))
+	return ioutil.ReadAll(pipe)
+}
+
+func (s *ManagerService) RuntimeConfig(tunnelName string, config *conf.Config) error {
+	storedConfig, err := conf.LoadConfig(s.store, tunnelName)
 	if err != nil {
 		return err
 	}
-	pipe.SetReadDeadline(time.Now().Add(time.Second * 2))
-	resp, err := ioutil.ReadAll(pipe)
+	resp, err := tunnelUAPIOperation(storedConfig.Name, "get=1\n\n")
 	if err != nil {
 		return err
 	}
-	pipe.Close()
 	runtimeConfig, err := conf.FromUAPI(string(resp), storedConfig)
 	if err != nil {
 		return err
@@ -108,11 +141,11 @@ func (s *ManagerService) Start(tunnelName string, unused *uintptr) error {
 	}()
 
 	// After that process is started -- it's somewhat asynchronous -- we install the new one.
-	c, err := conf.LoadFromName(tunnelName)
+	_, err := conf.LoadConfig(s.store, tunnelName)
 	if err != nil {
 		return err
 	}
-	path, err := c.Path()
+	path, err := tunnelConfigPath(s.store, tunnelName)
 	if err != nil {
 		return err
 	}
@@ -122,7 +155,7 @@ func (s *ManagerService) Start(tunnelName string, unused *uintptr) error {
 func (s *ManagerService) Stop(tunnelName string, _ *uintptr) error {
 	err := UninstallTunnel(tunnelName)
 	if err == windows.ERROR_SERVICE_DOES_NOT_EXIST {
-		_, notExistsError := conf.LoadFromName(tunnelName)
+		_, notExistsError := s.store.Load(tunnelName)
 		if notExistsError == nil {
 			return nil
 		}
@@ -155,7 +188,113 @@ func (s *ManagerService) Delete(tunnelName string, _ *uintptr) error {
 	if err != nil {
 		return err
 	}
-	return conf.DeleteName(tunnelName)
+	return s.store.Delete(tunnelName)
+}
+
+// Rename renames a stored tunnel. As its service and pipe are named after it, a running tunnel is
+// stopped and started again under its new name. The changes of its services along the way are not
+// reported; instead, a single rename notification is sent once the tunnel runs under its new name.
+// If it cannot be started under its new name, it is renamed back and started again under its old
+// one, and the error is returned.
+func (s *ManagerService) Rename(request RenameRequest, tunnel *Tunnel) error {
+	oldName, newName := request.OldName, request.NewName
+	if !conf.TunnelNameIsValid(oldName) || !conf.TunnelNameIsValid(newName) {
+		return errors.New("Tunnel name is not valid")
+	}
+	if oldName == newName {
+		*tunnel = Tunnel{newName}
+		return nil
+	}
+
+	trackedTunnelsLock.Lock()
+	if renamingTunnels[oldName] || renamingTunnels[newName] {
+		trackedTunnelsLock.Unlock()
+		return fmt.Errorf("Please allow the tunnel ‘%s’ to finish being renamed", oldName)
+	}
+	renamingTunnels[oldName] = true
+	renamingTunnels[newName] = true
+	trackedTunnelsLock.Unlock()
+
+	var state TunnelState
+	err := s.State(oldName, &state)
+	if err == nil && state != TunnelStarted && state != TunnelStopped {
+		err = fmt.Errorf("Please allow the tunnel ‘%s’ to finish activating or deactivating", oldName)
+	}
+	if err == nil {
+		err = s.store.Rename(oldName, newName)
+	}
+	if err != nil {
+		finishRename(oldName, newName, false, nil)
+		return err
+	}
+	if state == TunnelStarted {
+		err = s.restartRenamedTunnel(oldName, newName)
+		if err != nil {
+			finishRename(oldName, newName, false, err)
+			return err
+		}
+	}
+	finishRename(oldName, newName, true, nil)
+	*tunnel = Tunnel{newName}
+	return nil
+}
+
+func (s *ManagerService) restartRenamedTunnel(oldName, newName string) error {
+	err := UninstallTunnel(oldName)
+	if err == nil {
+		err = s.WaitForStop(oldName, nil)
+	}
+	var path string
+	if err == nil {
+		path, err = tunnelConfigPath(s.store, newName)
+	}
+	if err == nil {
+		err = InstallTunnel(path)
+	}
+	if err == nil {
+		return nil
+	}
+
+	log.Printf("[%s] Unable to restart tunnel as ‘%s’, so renaming it back: %v", oldName, newName, err)
+	rollbackErr := s.store.Rename(newName, oldName)
+	if rollbackErr == nil {
+		path, rollbackErr = tunnelConfigPath(s.store, oldName)
+	}
+	if rollbackErr == nil {
+		var state TunnelState
+		if s.State(oldName, &state) == nil && state == TunnelStopped {
+			rollbackErr = InstallTunnel(path)
+		}
+	}
+	if rollbackErr != nil {
+		log.Printf("[%s] Unable to restore tunnel after failed rename: %v", oldName, rollbackErr)
+	}
+	return err
+}
+
+// finishRename reports the changes of the services of oldName and newName again, and reports the
+// tunnel under the name that it ended up with, in the state it is in by now.
+func finishRename(oldName, newName string, renamed bool, err error) {
+	name := oldName
+	if renamed {
+		name = newName
+	}
+	trackedTunnelsLock.Lock()
+	delete(renamingTunnels, oldName)
+	delete(renamingTunnels, newName)
+	state, tracked := trackedTunnels[name]
+	trackedTunnelsLock.Unlock()
+	if !tracked {
+		state = TunnelStopped
+	} else if state == TunnelUnknown {
+		// The service has been started, but its tracker has yet to hear from it.
+		state = TunnelStarting
+	}
+	if renamed {
+		IPCServerNotifyTunnelRename(oldName, newName, state, err)
+	} else {
+		IPCServerNotifyTunnelChange(oldName, state, err)
+	}
 }
 
 func (s *ManagerService) State(tunnelName string, state *TunnelState) error {
@@ -198,19 +337,131 @@ func (s *ManagerService) GlobalState(_ uintptr, state *TunnelState) error {
 	return nil
 }
 
+// Create fails if a tunnel of the same name is already stored, even if it is not running, so that
+// it is never replaced by accident. Use Update to change a tunnel.
 func (s *ManagerService) Create(tunnelConfig conf.Config, tunnel *Tunnel) error {
-	err := tunnelConfig.Save()
+	doc, err := conf.ParseDocument(tunnelConfig.ToWgQuick(), tunnelConfig.Name)
+	if err != nil {
+		return err
+	}
+	return s.CreateFromDocument(*doc, tunnel)
+}
+
+func (s *ManagerService) CreateFromDocument(doc conf.Document, tunnel *Tunnel) error {
+	err := s.store.Create(&doc)
 	if err != nil {
 		return err
 	}
-	*tunnel = Tunnel{tunnelConfig.Name}
+	*tunnel = Tunnel{doc.Name}
 	return nil
-	//TODO: handle already existing situation
-	//TODO: handle already running and existing situation
+}
+
+// UpdateTunnel saves the document of request only if the stored one has not changed since it was
+// loaded with the revision token of request. If the tunnel is running, the changes are then applied as
+// with Reconfigure, and if applying them fails, the new configuration stays saved all the same.
+func (s *ManagerService) UpdateTunnel(request UpdateRequest, _ *uintptr) error {
+	return s.saveAndReconfigure(&request.Document, func() error {
+		return s.store.Update(&request.Document, request.RevisionToken)
+	})
+}
+
+func (s *ManagerService) Reconfigure(doc conf.Document, _ *uintptr) error {
+	return s.saveAndReconfigure(&doc, func() error {
+		return s.store.Save(&doc)
+	})
+}
+
+func (s *ManagerService) saveAndReconfigure(doc *conf.Document, save func() error) error {
+	newConfig, err := doc.Config()
+	if err != nil {
+		return err
+	}
+	oldConfig, err := conf.LoadConfig(s.store, doc.Name)
+	if err != nil {
+		return err
+	}
+	err = save()
+	if err != nil {
+		return err
+	}
+	var state TunnelState
+	err = s.State(doc.Name, &state)
+	if err != nil || state != TunnelStarted {
+		return err
+	}
+	return reconfigureTunnel(oldConfig, newConfig)
+}
+
+func (s *ManagerService) Metadata(tunnelName string, metadata *conf.Metadata) error {
+	m, err := s.store.LoadMetadata(tunnelName)
+	if err != nil {
+		return err
+	}
+	*metadata = *m
+	return nil
+}
+
+func (s *ManagerService) SetMetadata(request MetadataRequest, _ *uintptr) error {
+	return s.store.SaveMetadata(request.TunnelName, &request.Metadata)
+}
+
+func (s *ManagerService) Revisions(tunnelName string, revisions *[]conf.Revision) error {
+	r, err := s.store.Revisions(tunnelName)
+	if err != nil {
+		return err
+	}
+	*revisions = r
+	return nil
+}
+
+func (s *ManagerService) StoredRevision(request RevisionRequest, doc *conf.Document) error {
+	d, err := s.store.LoadRevision(request.TunnelName, request.Revision)
+	if err != nil {
+		return err
+	}
+	*doc = *d
+	return nil
+}
+
+func (s *ManagerService) RestoreRevision(request RevisionRequest, _ *uintptr) error {
+	doc, err := s.store.LoadRevision(request.TunnelName, request.Revision)
+	if err != nil {
+		return err
+	}
+	return s.saveAndReconfigure(doc, func() error {
+		return s.store.Save(doc)
+	})
+}
+
+// StoreHealth reports on every file in the configurations directory, so that tunnels which have
+// vanished from the list because their files are broken can be found.
+func (s *ManagerService) StoreHealth(_ uintptr, reports *[]conf.FileReport) error {
+	fileStore, ok := s.store.(*conf.FileStore)
+	if !ok {
+		*reports = nil
+		return nil
+	}
+	r, err := fileStore.Scan()
+	if err != nil {
+		return err
+	}
+	*reports = r
+	return nil
+}
+
+func (s *ManagerService) QuarantineBroken(_ uintptr, reports *[]conf.FileReport) error {
+	fileStore, ok := s.store.(*conf.FileStore)
+	if !ok {
+		*reports = nil
+		return nil
+	}
+	r, err := fileStore.QuarantineBroken()
+	*reports = r
+	return err
 }
 
 func (s *ManagerService) Tunnels(_ uintptr, tunnels *[]Tunnel) error {
-	names, err := conf.ListConfigNames()
+	names, err := s.store.List()
 	if err != nil {
 		return err
 	}
@@ -235,7 +486,7 @@ func (s *ManagerService) Quit(stopTunnelsOnQuit bool, alreadyQuit *bool) error {
 	managerServicesLock.Unlock()
 
 	if stopTunnelsOnQuit {
-		names, err := conf.ListConfigNames()
+		names, err := s.store.List()
 		if err != nil {
 			return err
 		}
@@ -267,10 +518,11 @@ func (s *ManagerService) Update(_ uintptr, _ *uintptr) error {
 	return nil
 }
 
-func IPCServerListen(reader *os.File, writer *os.File, events *os.File, elevatedToken windows.Token) error {
+func IPCServerListen(reader *os.File, writer *os.File, events *os.File, elevatedToken windows.Token, store conf.ConfigStore) error {
 	service := &ManagerService{
 		events:        events,
 		elevatedToken: elevatedToken,
+		store:         store,
 	}
 
 	server := rpc.NewServer()
@@ -326,10 +578,22 @@ func IPCServerNotifyTunnelChange(name string, state TunnelState, err error) {
 	}
 }
 
+func IPCServerNotifyTunnelRename(oldName string, newName string, state TunnelState, err error) {
+	if err == nil {
+		notifyAll(TunnelRenameNotificationType, oldName, newName, state, trackedTunnelsGlobalState(), "")
+	} else {
+		notifyAll(TunnelRenameNotificationType, oldName, newName, state, trackedTunnelsGlobalState(), err.Error())
+	}
+}
+
 func IPCServerNotifyTunnelsChange() {
 	notifyAll(TunnelsChangeNotificationType)
 }
 
+func IPCServerNotifyStoreEvent(event conf.StoreEvent) {
+	notifyAll(StoreEventNotificationType, event.Type, event.Name, event.OldName)
+}
+
 func IPCServerNotifyUpdateFound(state UpdateState) {
 	notifyAll(UpdateFoundNotificationType, state)
 }
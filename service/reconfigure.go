@@ -0,0 +1,179 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+// Besides UAPI requests, the pipe of a tunnel service takes this one, which asks it to reload its
+// configuration file and set the addresses, routes, DNS, and MTU of its interface again. Unlike a
+// service control, it is answered with an errno, as UAPI set requests are, only once that is done.
+const reconfigureRequest = "reconfigure=1\n\n"
+
+// Setting the routes of an interface may take a while, so a reconfiguration is waited on for longer
+// than UAPI requests are.
+const reconfigureTimeout = time.Second * 30
+
+// A prefetchedConn is a connection of which the beginning has already been read into reader.
+type prefetchedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (conn *prefetchedConn) Read(b []byte) (int, error) {
+	return conn.reader.Read(b)
+}
+
+// handleTunnelPipe passes a connection to the pipe of a tunnel service on to the device, unless it is
+// a reconfiguration request, which is sent to the tunnel service to handle, and answered here.
+func handleTunnelPipe(conn net.Conn, dev *device.Device, reconfigureRequests chan<- chan error) {
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil || line+"\n" != reconfigureRequest {
+		dev.IpcHandle(&prefetchedConn{conn, io.MultiReader(strings.NewReader(line), reader)})
+		return
+	}
+	defer conn.Close()
+	_, err = reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	result := make(chan error, 1)
+	select {
+	case reconfigureRequests <- result:
+	case <-dev.Wait():
+		return
+	}
+	errno := 0
+	if <-result != nil {
+		errno = 1
+	}
+	conn.Write([]byte(fmt.Sprintf("errno=%d\n\n", errno)))
+}
+
+func sameIPs(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameScripts(a, b *conf.Interface) bool {
+	return sameStrings(a.PreUp, b.PreUp) && sameStrings(a.PostUp, b.PostUp) &&
+		sameStrings(a.PreDown, b.PreDown) && sameStrings(a.PostDown, b.PostDown)
+}
+
+// The private key, the firewall, which also pins the DNS servers, and the choice of automatic MTU are
+// all set up only once when the tunnel service starts, so changing any of them requires a restart.
+// So do the scripts, as whether privileges are dropped depends on them, and they are only run when
+// the tunnel goes up or down.
+func reconfigurationNeedsRestart(oldConfig, newConfig *conf.Config, diff *conf.Diff) bool {
+	return diff.InterfaceChanged("PrivateKey") ||
+		!sameScripts(&oldConfig.Interface, &newConfig.Interface) ||
+		firewallRestrictsAll(oldConfig) != firewallRestrictsAll(newConfig) ||
+		!sameIPs(oldConfig.Interface.DNS, newConfig.Interface.DNS) ||
+		(oldConfig.Interface.MTU == 0) != (newConfig.Interface.MTU == 0)
+}
+
+func reconfigurationNeedsInterface(diff *conf.Diff) bool {
+	if diff.InterfaceChanged("Address", "DNS", "MTU", "Table") || len(diff.AddedPeers) > 0 || len(diff.RemovedPeers) > 0 {
+		return true
+	}
+	for _, peer := range diff.ChangedPeers {
+		for _, change := range peer.Changes {
+			if change.Key == "AllowedIPs" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func restartTunnel(tunnelName string) error {
+	path, err := (&conf.Config{Name: tunnelName}).Path()
+	if err != nil {
+		return err
+	}
+	err = UninstallTunnel(tunnelName)
+	if err != nil {
+		return err
+	}
+	var s ManagerService
+	err = s.WaitForStop(tunnelName, nil)
+	if err != nil {
+		return err
+	}
+	return InstallTunnel(path)
+}
+
+func reconfigureTunnel(oldConfig, newConfig *conf.Config) error {
+	diff := conf.DiffConfigs(oldConfig, newConfig)
+	if diff.IsEmpty() && sameScripts(&oldConfig.Interface, &newConfig.Interface) {
+		return nil
+	}
+	if reconfigurationNeedsRestart(oldConfig, newConfig, diff) {
+		log.Printf("[%s] Restarting tunnel to apply new configuration", newConfig.Name)
+		return restartTunnel(newConfig.Name)
+	}
+
+	uapi, err := diff.ToUAPI()
+	if err != nil {
+		return err
+	}
+	if len(uapi) > 0 {
+		resp, err := tunnelUAPIOperation(newConfig.Name, "set=1\n"+uapi+"\n")
+		if err != nil {
+			return err
+		}
+		if status := strings.TrimSpace(string(resp)); status != "errno=0" {
+			return fmt.Errorf("Unable to set device configuration: %s", status)
+		}
+	}
+
+	if !reconfigurationNeedsInterface(diff) {
+		return nil
+	}
+	resp, err := tunnelPipeOperation(newConfig.Name, reconfigureRequest, reconfigureTimeout)
+	if err == nil {
+		if status := strings.TrimSpace(string(resp)); status != "errno=0" {
+			err = fmt.Errorf("Unable to set interface configuration: %s", status)
+		}
+	}
+	if err != nil {
+		// Whatever part of the new configuration was set has to be undone, and a restart does that too.
+		log.Printf("[%s] Restarting tunnel, as applying new configuration failed: %v", newConfig.Name, err)
+		return restartTunnel(newConfig.Name)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019 WireGuard LLC. All Rights Reserved.
+ */
+
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.zx2c4.com/wireguard/device"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+// Since the tunnel service runs as Local System, hook commands from a configuration file are only
+// executed if an administrator has explicitly set this DWORD value under HKLM\Software\WireGuard.
+const scriptExecutionRegValue = "DangerousScriptExecution"
+
+// scriptsNeedPrivileges is whether commands of config will run after the point at which the tunnel
+// service would otherwise drop its privileges, in which case it must keep them, as those commands
+// are expected to change routes, firewall rules, and DNS, just as PreUp commands may.
+func scriptsNeedPrivileges(config *conf.Config) bool {
+	if len(config.Interface.PostUp) == 0 && len(config.Interface.PreDown) == 0 && len(config.Interface.PostDown) == 0 {
+		return false
+	}
+	return conf.AdminBool(scriptExecutionRegValue)
+}
+
+func runScriptCommands(commands []string, interfaceName string, logger *device.Logger) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	if !conf.AdminBool(scriptExecutionRegValue) {
+		for _, command := range commands {
+			logger.Info.Printf("Skipping execution of script, because %s is not enabled: %#q", scriptExecutionRegValue, command)
+		}
+		return nil
+	}
+	for _, command := range commands {
+		err := runScriptCommand(command, interfaceName, logger)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runScriptCommand(command string, interfaceName string, logger *device.Logger) error {
+	command = strings.ReplaceAll(command, "%i", interfaceName)
+	logger.Info.Printf("Executing: %#q", command)
+	comspec := os.Getenv("COMSPEC")
+	if len(comspec) == 0 {
+		comspec = filepath.Join(os.Getenv("SystemRoot"), "System32", "cmd.exe")
+	}
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	process, err := os.StartProcess(comspec, nil /* CmdLine below */, &os.ProcAttr{
+		Files: []*os.File{devNull, writer, writer},
+		Env:   append(os.Environ(), "WIREGUARD_TUNNEL_NAME="+interfaceName),
+		Sys: &syscall.SysProcAttr{
+			HideWindow: true,
+			CmdLine:    fmt.Sprintf("cmd /c %s", command),
+		},
+	})
+	writer.Close()
+	if err != nil {
+		reader.Close()
+		return err
+	}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		logger.Info.Printf("cmd> %s", scanner.Text())
+	}
+	reader.Close()
+	state, err := process.Wait()
+	if err != nil {
+		return err
+	}
+	if state.ExitCode() != 0 {
+		return fmt.Errorf("Command %#q exited with status %d", command, state.ExitCode())
+	}
+	return nil
+}
@@ -72,14 +72,34 @@ func (service *managerService) Execute(args []string, r <-chan svc.ChangeRequest
 		return
 	}
 
-	err = trackExistingTunnels()
+	store, err := conf.DefaultStore()
+	if err != nil {
+		serviceError = ErrorOpenStore
+		return
+	}
+
+	if reports, err := store.Scan(); err == nil {
+		for _, report := range reports {
+			if report.Health != conf.FileOK {
+				log.Printf("Stored configuration file ‘%s’ is broken (%s): %s", report.File, report.Health, report.Error)
+			}
+		}
+	}
+
+	err = trackExistingTunnels(store)
 	if err != nil {
 		serviceError = ErrorTrackTunnels
 		return
 	}
 
-	conf.RegisterStoreChangeCallback(func() { conf.MigrateUnencryptedConfigs() }) // Ignore return value for now, but could be useful later.
-	conf.RegisterStoreChangeCallback(IPCServerNotifyTunnelsChange)
+	err = startAutostartTunnel(store)
+	if err != nil {
+		log.Printf("Unable to start tunnel automatically: %v", err)
+	}
+
+	store.Watch(func() { store.MigrateUnencrypted() }) // Ignore return value for now, but could be useful later.
+	store.Watch(IPCServerNotifyTunnelsChange)
+	store.WatchEvents(IPCServerNotifyStoreEvent)
 
 	procs := make(map[uint32]*os.Process)
 	aliveSessions := make(map[uint32]bool)
@@ -167,7 +187,7 @@ func (service *managerService) Execute(args []string, r <-chan svc.ChangeRequest
 				return
 			}
 			ourEvents, theirEvents, theirEventStr, err := inheritableEvents()
-			err = IPCServerListen(ourReader, ourWriter, ourEvents, elevatedToken)
+			err = IPCServerListen(ourReader, ourWriter, ourEvents, elevatedToken, store)
 			if err != nil {
 				log.Printf("Unable to listen on IPC pipes: %v", err)
 				return
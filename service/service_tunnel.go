@@ -38,6 +38,8 @@ func (service *tunnelService) Execute(args []string, r <-chan svc.ChangeRequest,
 	var uapi net.Listener
 	var routeChangeCallback *winipcfg.RouteChangeCallback
 	var logger *device.Logger
+	var config *conf.Config
+	var runDownScripts bool
 	var err error
 	serviceError := ErrorSuccess
 
@@ -92,9 +94,19 @@ func (service *tunnelService) Execute(args []string, r <-chan svc.ChangeRequest,
 		if uapi != nil {
 			uapi.Close()
 		}
+		if runDownScripts {
+			if scriptErr := runScriptCommands(config.Interface.PreDown, config.Name, logger); scriptErr != nil {
+				logIt(fmt.Sprintf("Unable to run PreDown commands: %v", scriptErr))
+			}
+		}
 		if dev != nil {
 			dev.Close()
 		}
+		if runDownScripts {
+			if scriptErr := runScriptCommands(config.Interface.PostDown, config.Name, logger); scriptErr != nil {
+				logIt(fmt.Sprintf("Unable to run PostDown commands: %v", scriptErr))
+			}
+		}
 		stopIt <- true
 		log.Println("Shutting down")
 	}()
@@ -122,26 +134,26 @@ func (service *tunnelService) Execute(args []string, r <-chan svc.ChangeRequest,
 		}
 	}()
 
-	conf, err := conf.LoadFromPath(service.path)
+	config, err = conf.LoadFromPath(service.path)
 	if err != nil {
 		serviceError = ErrorLoadConfiguration
 		return
 	}
 
-	stdLog := log.New(ringlogger.Global, fmt.Sprintf("[%s] ", conf.Name), 0)
+	stdLog := log.New(ringlogger.Global, fmt.Sprintf("[%s] ", config.Name), 0)
 	logger = &device.Logger{stdLog, stdLog, stdLog}
 
 	logger.Info.Println("Starting", version.UserAgent())
 
 	logger.Info.Println("Resolving DNS names")
-	uapiConf, err := conf.ToUAPI()
+	uapiConf, err := config.ToUAPI()
 	if err != nil {
 		serviceError = ErrorDNSLookup
 		return
 	}
 
 	logger.Info.Println("Creating Wintun device")
-	wintun, err := tun.CreateTUN(conf.Name)
+	wintun, err := tun.CreateTUN(config.Name)
 	if err != nil {
 		serviceError = ErrorCreateWintun
 		return
@@ -152,28 +164,40 @@ func (service *tunnelService) Execute(args []string, r <-chan svc.ChangeRequest,
 		serviceError = ErrorDetermineWintunName
 		return
 	}
-	conf.Name = realInterfaceName
+	config.Name = realInterfaceName
 	nativeTun := wintun.(*tun.NativeTun)
 
-	logger.Info.Println("Enabling firewall rules")
-	err = enableFirewall(conf, nativeTun)
+	logger.Info.Println("Running PreUp commands")
+	err = runScriptCommands(config.Interface.PreUp, config.Name, logger)
 	if err != nil {
-		serviceError = ErrorFirewall
+		serviceError = ErrorRunScript
 		return
 	}
+	runDownScripts = true
 
-	logger.Info.Println("Dropping all privileges")
-	err = DropAllPrivileges()
+	logger.Info.Println("Enabling firewall rules")
+	err = enableFirewall(config, nativeTun)
 	if err != nil {
-		serviceError = ErrorDropPrivileges
+		serviceError = ErrorFirewall
 		return
 	}
 
+	if scriptsNeedPrivileges(config) {
+		logger.Info.Println("Keeping privileges for PostUp, PreDown, and PostDown commands")
+	} else {
+		logger.Info.Println("Dropping all privileges")
+		err = DropAllPrivileges()
+		if err != nil {
+			serviceError = ErrorDropPrivileges
+			return
+		}
+	}
+
 	logger.Info.Println("Creating interface instance")
 	dev = device.NewDevice(wintun, logger)
 
 	logger.Info.Println("Setting interface configuration")
-	uapi, err = ipc.UAPIListen(conf.Name)
+	uapi, err = ipc.UAPIListen(config.Name)
 	if err != nil {
 		serviceError = ErrorUAPIListen
 		return
@@ -189,27 +213,35 @@ func (service *tunnelService) Execute(args []string, r <-chan svc.ChangeRequest,
 	dev.Up()
 
 	logger.Info.Println("Monitoring default routes")
-	routeChangeCallback, err = monitorDefaultRoutes(dev, conf.Interface.MTU == 0, nativeTun)
+	routeChangeCallback, err = monitorDefaultRoutes(dev, config.Interface.MTU == 0, nativeTun)
 	if err != nil {
 		serviceError = ErrorBindSocketsToDefaultRoutes
 		return
 	}
 
 	logger.Info.Println("Setting device address")
-	err = configureInterface(conf, nativeTun)
+	err = configureInterface(config, nativeTun)
 	if err != nil {
 		serviceError = ErrorSetNetConfig
 		return
 	}
 
+	logger.Info.Println("Running PostUp commands")
+	err = runScriptCommands(config.Interface.PostUp, config.Name, logger)
+	if err != nil {
+		serviceError = ErrorRunScript
+		return
+	}
+
 	logger.Info.Println("Listening for UAPI requests")
+	reconfigureRequests := make(chan chan error)
 	go func() {
 		for {
 			conn, err := uapi.Accept()
 			if err != nil {
 				continue
 			}
-			go dev.IpcHandle(conn)
+			go handleTunnelPipe(conn, dev, reconfigureRequests)
 		}
 	}()
 
@@ -227,6 +259,23 @@ func (service *tunnelService) Execute(args []string, r <-chan svc.ChangeRequest,
 			default:
 				logger.Error.Printf("Unexpected service control request #%d\n", c)
 			}
+		case result := <-reconfigureRequests:
+			logger.Info.Println("Reloading interface configuration")
+			newConfig, loadErr := conf.LoadFromPath(service.path)
+			if loadErr != nil {
+				logger.Error.Printf("Unable to load configuration: %v", loadErr)
+				result <- loadErr
+				continue
+			}
+			newConfig.Name = config.Name
+			configErr := configureInterface(newConfig, nativeTun)
+			if configErr != nil {
+				logger.Error.Printf("Unable to set interface configuration: %v", configErr)
+				result <- configErr
+				continue
+			}
+			config = newConfig
+			result <- nil
 		case <-dev.Wait():
 			return
 		}
@@ -19,12 +19,12 @@ import (
 	"golang.zx2c4.com/wireguard/windows/conf"
 )
 
-func trackExistingTunnels() error {
+func trackExistingTunnels(store conf.ConfigStore) error {
 	m, err := serviceManager()
 	if err != nil {
 		return err
 	}
-	names, err := conf.ListConfigNames()
+	names, err := store.List()
 	if err != nil {
 		return err
 	}
@@ -42,6 +42,50 @@ func trackExistingTunnels() error {
 	return nil
 }
 
+// startAutostartTunnel starts the first tunnel listed that has autostart in its metadata, unless some
+// tunnel is running already, as only one may run at a time.
+func startAutostartTunnel(store conf.ConfigStore) error {
+	m, err := serviceManager()
+	if err != nil {
+		return err
+	}
+	names, err := store.List()
+	if err != nil {
+		return err
+	}
+	first := ""
+	firstOrder := 0
+	for _, name := range names {
+		serviceName, err := ServiceNameOfTunnel(name)
+		if err != nil {
+			continue
+		}
+		if service, err := m.OpenService(serviceName); err == nil {
+			status, err := service.Query()
+			service.Close()
+			if err == nil && status.State != svc.Stopped {
+				return nil
+			}
+		}
+		metadata, err := store.LoadMetadata(name)
+		if err != nil || !metadata.Autostart {
+			continue
+		}
+		if len(first) == 0 || conf.TunnelIsListedBefore(name, metadata.Order, first, firstOrder) {
+			first, firstOrder = name, metadata.Order
+		}
+	}
+	if len(first) == 0 {
+		return nil
+	}
+	log.Printf("[%s] Starting tunnel, as it is set to start automatically", first)
+	path, err := tunnelConfigPath(store, first)
+	if err != nil {
+		return err
+	}
+	return InstallTunnel(path)
+}
+
 var serviceTrackerCallbackPtr = windows.NewCallback(func(notifier *windows.SERVICE_NOTIFY) uintptr {
 	return 0
 })
@@ -49,6 +93,22 @@ var serviceTrackerCallbackPtr = windows.NewCallback(func(notifier *windows.SERVI
 var trackedTunnels = make(map[string]TunnelState)
 var trackedTunnelsLock = sync.Mutex{}
 
+// While a tunnel is being renamed, the changes of its old and new services are not reported, since
+// the rename is reported as a whole once it is done.
+var renamingTunnels = make(map[string]bool)
+
+// notifyTrackedTunnelChange sets the tracked state of tunnelName before reporting it, so that a rename
+// finishing in between reports the state either way.
+func notifyTrackedTunnelChange(tunnelName string, state TunnelState, err error) {
+	trackedTunnelsLock.Lock()
+	trackedTunnels[tunnelName] = state
+	renaming := renamingTunnels[tunnelName]
+	trackedTunnelsLock.Unlock()
+	if !renaming {
+		IPCServerNotifyTunnelChange(tunnelName, state, err)
+	}
+}
+
 func svcStateToTunState(s svc.State) TunnelState {
 	switch s {
 	case svc.StartPending:
@@ -110,10 +170,7 @@ func trackTunnelService(tunnelName string, service *mgr.Service) {
 		if err == windows.ERROR_SERVICE_MARKED_FOR_DELETE || config.StartType == windows.SERVICE_DISABLED {
 			log.Printf("[%s] Found disabled service via timeout, so deleting", tunnelName)
 			service.Delete()
-			trackedTunnelsLock.Lock()
-			trackedTunnels[tunnelName] = TunnelStopped
-			trackedTunnelsLock.Unlock()
-			IPCServerNotifyTunnelChange(tunnelName, TunnelStopped, nil)
+			notifyTrackedTunnelChange(tunnelName, TunnelStopped, nil)
 			return true
 		}
 		return false
@@ -137,18 +194,12 @@ func trackTunnelService(tunnelName string, service *mgr.Service) {
 				}
 			}
 		case windows.ERROR_SERVICE_MARKED_FOR_DELETE:
-			trackedTunnelsLock.Lock()
-			trackedTunnels[tunnelName] = TunnelStopped
-			trackedTunnelsLock.Unlock()
-			IPCServerNotifyTunnelChange(tunnelName, TunnelStopped, nil)
+			notifyTrackedTunnelChange(tunnelName, TunnelStopped, nil)
 			return
 		case windows.ERROR_SERVICE_NOTIFY_CLIENT_LAGGING:
 			continue
 		default:
-			trackedTunnelsLock.Lock()
-			trackedTunnels[tunnelName] = TunnelStopped
-			trackedTunnelsLock.Unlock()
-			IPCServerNotifyTunnelChange(tunnelName, TunnelStopped, fmt.Errorf("Unable to continue monitoring service, so stopping: %v", err))
+			notifyTrackedTunnelChange(tunnelName, TunnelStopped, fmt.Errorf("Unable to continue monitoring service, so stopping: %v", err))
 			service.Control(svc.Stop)
 			return
 		}
@@ -170,10 +221,7 @@ func trackTunnelService(tunnelName string, service *mgr.Service) {
 			}
 		}
 		if state != lastState {
-			trackedTunnelsLock.Lock()
-			trackedTunnels[tunnelName] = state
-			trackedTunnelsLock.Unlock()
-			IPCServerNotifyTunnelChange(tunnelName, state, tunnelError)
+			notifyTrackedTunnelChange(tunnelName, state, tunnelError)
 			lastState = state
 		}
 	}
@@ -294,11 +294,12 @@ func (iv *interfaceView) apply(c *conf.Interface) {
 		iv.addresses.hide()
 	}
 
-	if len(c.DNS) > 0 {
-		addrStrings := make([]string, len(c.DNS))
-		for i, address := range c.DNS {
-			addrStrings[i] = address.String()
+	if len(c.DNS)+len(c.DNSSearch) > 0 {
+		addrStrings := make([]string, 0, len(c.DNS)+len(c.DNSSearch))
+		for _, address := range c.DNS {
+			addrStrings = append(addrStrings, address.String())
 		}
+		addrStrings = append(addrStrings, c.DNSSearch...)
 		iv.dns.show(strings.Join(addrStrings[:], ", "))
 	} else {
 		iv.dns.hide()
@@ -411,7 +412,7 @@ func NewConfView(parent walk.Container) (*ConfView, error) {
 					config, _ = tunnel.RuntimeConfig()
 				}
 				if config.Name == "" {
-					config, _ = tunnel.StoredConfig()
+					config, _, _ = tunnel.StoredConfig()
 				}
 				cv.Synchronize(func() {
 					cv.setTunnel(tunnel, &config, state)
@@ -466,7 +467,7 @@ func (cv *ConfView) onTunnelChanged(tunnel *service.Tunnel, state service.Tunnel
 			config, _ = tunnel.RuntimeConfig()
 		}
 		if config.Name == "" {
-			config, _ = tunnel.StoredConfig()
+			config, _, _ = tunnel.StoredConfig()
 		}
 		cv.Synchronize(func() {
 			cv.setTunnel(tunnel, &config, state)
@@ -485,7 +486,7 @@ func (cv *ConfView) SetTunnel(tunnel *service.Tunnel) {
 				config, _ = tunnel.RuntimeConfig()
 			}
 			if config.Name == "" {
-				config, _ = tunnel.StoredConfig()
+				config, _, _ = tunnel.StoredConfig()
 			}
 			cv.Synchronize(func() {
 				cv.setTunnel(tunnel, &config, state)
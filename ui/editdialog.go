@@ -7,6 +7,7 @@ package ui
 
 import (
 	"fmt"
+	"net"
 	"strings"
 
 	"github.com/lxn/walk"
@@ -21,13 +22,19 @@ type EditDialog struct {
 	pubkeyEdit                      *walk.LineEdit
 	syntaxEdit                      *syntax.SyntaxEdit
 	blockUntunneledTrafficCB        *walk.CheckBox
+	excludePrivateIPsCB             *walk.CheckBox
 	saveButton                      *walk.PushButton
 	config                          conf.Config
+	document                        *conf.Document
+	revisionToken                   string
 	lastPrivateKey                  string
 	blockUntunneledTraficCheckGuard bool
+	excludePrivateIPsCheckGuard     bool
 }
 
-func runTunnelEditDialog(owner walk.Form, tunnel *service.Tunnel, clone bool) *conf.Config {
+// runTunnelEditDialog returns the edited document, along with the revision token of the stored one it
+// was based on, if any.
+func runTunnelEditDialog(owner walk.Form, tunnel *service.Tunnel, clone bool) (*conf.Document, string) {
 	dlg := &EditDialog{}
 
 	var title string
@@ -37,12 +44,20 @@ func runTunnelEditDialog(owner walk.Form, tunnel *service.Tunnel, clone bool) *c
 		title = "Edit tunnel"
 	}
 
+	var text string
 	if tunnel == nil {
 		// Creating a new tunnel, create a new private key and use the default template
 		pk, _ := conf.NewPrivateKey()
 		dlg.config = conf.Config{Interface: conf.Interface{PrivateKey: *pk}}
+		text = dlg.config.ToWgQuick()
 	} else {
-		dlg.config, _ = tunnel.StoredConfig()
+		dlg.config, _, _ = tunnel.StoredConfig()
+		if doc, revisionToken, err := tunnel.StoredDocument(); err == nil {
+			text = doc.String()
+			dlg.revisionToken = revisionToken
+		} else {
+			text = dlg.config.ToWgQuick()
+		}
 		if clone {
 			dlg.config.Name += "-copy"
 		}
@@ -95,6 +110,12 @@ func runTunnelEditDialog(owner walk.Form, tunnel *service.Tunnel, clone bool) *c
 	dlg.blockUntunneledTrafficCB.SetVisible(false)
 	dlg.blockUntunneledTrafficCB.CheckedChanged().Attach(dlg.onBlockUntunneledTrafficCBCheckedChanged)
 
+	dlg.excludePrivateIPsCB, _ = walk.NewCheckBox(buttonsContainer)
+	dlg.excludePrivateIPsCB.SetText("Exclude private IPs")
+	dlg.excludePrivateIPsCB.SetToolTipText("When a configuration has exactly one peer, and that peer routes all traffic, this removes the address ranges of local networks from its allowed IPs, so that devices on those networks stay reachable outside of the tunnel. Untunneled traffic is then no longer blocked.")
+	dlg.excludePrivateIPsCB.SetVisible(false)
+	dlg.excludePrivateIPsCB.CheckedChanged().Attach(dlg.onExcludePrivateIPsCBCheckedChanged)
+
 	walk.NewHSpacer(buttonsContainer)
 
 	dlg.saveButton, _ = walk.NewPushButton(buttonsContainer)
@@ -110,7 +131,8 @@ func runTunnelEditDialog(owner walk.Form, tunnel *service.Tunnel, clone bool) *c
 
 	dlg.syntaxEdit.PrivateKeyChanged().Attach(dlg.onSyntaxEditPrivateKeyChanged)
 	dlg.syntaxEdit.BlockUntunneledTrafficStateChanged().Attach(dlg.onBlockUntunneledTrafficStateChanged)
-	dlg.syntaxEdit.SetText(dlg.config.ToWgQuick())
+	dlg.syntaxEdit.TextChanged().Attach(dlg.onSyntaxEditTextChanged)
+	dlg.syntaxEdit.SetText(text)
 
 	if clone {
 		dlg.config.Name = ""
@@ -125,27 +147,64 @@ func runTunnelEditDialog(owner walk.Form, tunnel *service.Tunnel, clone bool) *c
 	}
 
 	if dlg.Run() == walk.DlgCmdOK {
-		return &dlg.config
+		return dlg.document, dlg.revisionToken
 	}
 
-	return nil
+	return nil, ""
+}
+
+// toggleBlockingUntunneledTraffic replaces the allowed IPs of each address family that cover the whole
+// family with its default route, which makes the tunnel service block untunneled traffic, or, when
+// unblocking, splits each default route into the two halves of its family, which route the same but
+// do not. It reports whether any family was changed.
+func toggleBlockingUntunneledTraffic(allowedIPs []conf.IPCidr, block bool) ([]conf.IPCidr, bool) {
+	allowed := conf.NewCIDRSet(allowedIPs...)
+	toggled := false
+	for _, halves := range [][2]conf.IPCidr{
+		{{IP: net.IP{0, 0, 0, 0}, Cidr: 1}, {IP: net.IP{0x80, 0, 0, 0}, Cidr: 1}},
+		{{IP: net.ParseIP("::"), Cidr: 1}, {IP: net.ParseIP("8000::"), Cidr: 1}},
+	} {
+		defaultRoute := conf.IPCidr{IP: halves[0].IP, Cidr: 0}
+		bits := defaultRoute.Bits()
+		family := conf.NewCIDRSet(defaultRoute)
+		hasDefaultRoute := false
+		for i := range allowedIPs {
+			if allowedIPs[i].Bits() == bits && allowedIPs[i].Cidr == 0 {
+				hasDefaultRoute = true
+			}
+		}
+		if block == hasDefaultRoute || block && !allowed.Intersect(family).Equal(family) {
+			continue
+		}
+		newAllowedIPs := make([]conf.IPCidr, 0, len(allowedIPs)+2)
+		for i := range allowedIPs {
+			if allowedIPs[i].Bits() != bits || !block && allowedIPs[i].Cidr != 0 {
+				newAllowedIPs = append(newAllowedIPs, allowedIPs[i])
+			}
+		}
+		if block {
+			newAllowedIPs = append(newAllowedIPs, defaultRoute)
+		} else {
+			newAllowedIPs = append(newAllowedIPs, halves[:]...)
+		}
+		allowedIPs = newAllowedIPs
+		toggled = true
+	}
+	return allowedIPs, toggled
 }
 
 func (dlg *EditDialog) onBlockUntunneledTrafficCBCheckedChanged() {
 	if dlg.blockUntunneledTraficCheckGuard {
 		return
 	}
-	var (
-		v40 = [4]byte{}
-		v60 = [16]byte{}
-		v48 = [4]byte{0x80}
-		v68 = [16]byte{0x80}
-	)
-
-	block := dlg.blockUntunneledTrafficCB.Checked()
-	cfg, err := conf.FromWgQuick(dlg.syntaxEdit.Text(), "temporary")
-	var newAllowedIPs []conf.IPCidr
 
+	var cfg *conf.Config
+	var toggled bool
+	doc, err := conf.ParseDocument(dlg.syntaxEdit.Text(), "temporary")
+	if err != nil {
+		goto err
+	}
+	cfg, err = doc.Config()
 	if err != nil {
 		goto err
 	}
@@ -153,73 +212,15 @@ func (dlg *EditDialog) onBlockUntunneledTrafficCBCheckedChanged() {
 		goto err
 	}
 
-	newAllowedIPs = make([]conf.IPCidr, 0, len(cfg.Peers[0].AllowedIPs))
-	if block {
-		var (
-			foundV401    bool
-			foundV41281  bool
-			foundV600001 bool
-			foundV680001 bool
-		)
-		for _, allowedip := range cfg.Peers[0].AllowedIPs {
-			if allowedip.Cidr == 1 && len(allowedip.IP) == 16 && allowedip.IP.Equal(v60[:]) {
-				foundV600001 = true
-			} else if allowedip.Cidr == 1 && len(allowedip.IP) == 16 && allowedip.IP.Equal(v68[:]) {
-				foundV680001 = true
-			} else if allowedip.Cidr == 1 && len(allowedip.IP) == 4 && allowedip.IP.Equal(v40[:]) {
-				foundV401 = true
-			} else if allowedip.Cidr == 1 && len(allowedip.IP) == 4 && allowedip.IP.Equal(v48[:]) {
-				foundV41281 = true
-			} else {
-				newAllowedIPs = append(newAllowedIPs, allowedip)
-			}
-		}
-		if !((foundV401 && foundV41281) || (foundV600001 && foundV680001)) {
-			goto err
-		}
-		if foundV401 && foundV41281 {
-			newAllowedIPs = append(newAllowedIPs, conf.IPCidr{v40[:], 0})
-		} else if foundV401 {
-			newAllowedIPs = append(newAllowedIPs, conf.IPCidr{v40[:], 1})
-		} else if foundV41281 {
-			newAllowedIPs = append(newAllowedIPs, conf.IPCidr{v48[:], 1})
-		}
-		if foundV600001 && foundV680001 {
-			newAllowedIPs = append(newAllowedIPs, conf.IPCidr{v60[:], 0})
-		} else if foundV600001 {
-			newAllowedIPs = append(newAllowedIPs, conf.IPCidr{v60[:], 1})
-		} else if foundV680001 {
-			newAllowedIPs = append(newAllowedIPs, conf.IPCidr{v68[:], 1})
-		}
-		cfg.Peers[0].AllowedIPs = newAllowedIPs
-	} else {
-		var (
-			foundV400 bool
-			foundV600 bool
-		)
-		for _, allowedip := range cfg.Peers[0].AllowedIPs {
-			if allowedip.Cidr == 0 && len(allowedip.IP) == 16 && allowedip.IP.Equal(v60[:]) {
-				foundV600 = true
-			} else if allowedip.Cidr == 0 && len(allowedip.IP) == 4 && allowedip.IP.Equal(v40[:]) {
-				foundV400 = true
-			} else {
-				newAllowedIPs = append(newAllowedIPs, allowedip)
-			}
-		}
-		if !(foundV400 || foundV600) {
-			goto err
-		}
-		if foundV400 {
-			newAllowedIPs = append(newAllowedIPs, conf.IPCidr{v40[:], 1})
-			newAllowedIPs = append(newAllowedIPs, conf.IPCidr{v48[:], 1})
-		}
-		if foundV600 {
-			newAllowedIPs = append(newAllowedIPs, conf.IPCidr{v60[:], 1})
-			newAllowedIPs = append(newAllowedIPs, conf.IPCidr{v68[:], 1})
-		}
-		cfg.Peers[0].AllowedIPs = newAllowedIPs
+	cfg.Peers[0].AllowedIPs, toggled = toggleBlockingUntunneledTraffic(cfg.Peers[0].AllowedIPs, dlg.blockUntunneledTrafficCB.Checked())
+	if !toggled {
+		goto err
 	}
-	dlg.syntaxEdit.SetText(cfg.ToWgQuick())
+	err = doc.Apply(cfg)
+	if err != nil {
+		goto err
+	}
+	dlg.syntaxEdit.SetText(doc.String())
 	return
 
 err:
@@ -242,6 +243,110 @@ func (dlg *EditDialog) onBlockUntunneledTrafficStateChanged(state int) {
 	dlg.blockUntunneledTraficCheckGuard = false
 }
 
+// privateIPRanges are the addresses of local networks, which may be excluded from the allowed IPs of a
+// peer that otherwise routes all traffic.
+var privateIPRanges = []conf.IPCidr{
+	{IP: net.IP{10, 0, 0, 0}, Cidr: 8},
+	{IP: net.IP{172, 16, 0, 0}, Cidr: 12},
+	{IP: net.IP{192, 168, 0, 0}, Cidr: 16},
+	{IP: net.IP{169, 254, 0, 0}, Cidr: 16},
+	{IP: net.ParseIP("fc00::"), Cidr: 7},
+	{IP: net.ParseIP("fe80::"), Cidr: 10},
+}
+
+var addressFamilies = []conf.IPCidr{{IP: net.IPv4zero, Cidr: 0}, {IP: net.IPv6zero, Cidr: 0}}
+
+// excludingPrivateIPs reports whether allowedIPs route all traffic of each address family they have
+// anything of, either with or without the private IP ranges, and if so, whether without.
+func excludingPrivateIPs(allowedIPs []conf.IPCidr) (applicable bool, excluding bool) {
+	allowed := conf.NewCIDRSet(allowedIPs...)
+	allButPrivate := conf.NewCIDRSet(conf.AllowedIPsExcluding(privateIPRanges...)...)
+	for _, defaultRoute := range addressFamilies {
+		family := conf.NewCIDRSet(defaultRoute)
+		routed := allowed.Intersect(family)
+		if routed.IsEmpty() {
+			continue
+		}
+		excludingFamily := false
+		if !routed.Equal(family) {
+			if !routed.Equal(allButPrivate.Intersect(family)) {
+				return false, false
+			}
+			excludingFamily = true
+		}
+		if applicable && excluding != excludingFamily {
+			return false, false
+		}
+		applicable, excluding = true, excludingFamily
+	}
+	return
+}
+
+// setExcludingPrivateIPs gives the allowed IPs that route all traffic of each address family that
+// allowedIPs have anything of, without the private IP ranges if exclude is set.
+func setExcludingPrivateIPs(allowedIPs []conf.IPCidr, exclude bool) []conf.IPCidr {
+	allowed := conf.NewCIDRSet(allowedIPs...)
+	routed := conf.NewCIDRSet(conf.AllowedIPsExcluding()...)
+	if exclude {
+		routed = conf.NewCIDRSet(conf.AllowedIPsExcluding(privateIPRanges...)...)
+	}
+	result := conf.NewCIDRSet()
+	for _, defaultRoute := range addressFamilies {
+		family := conf.NewCIDRSet(defaultRoute)
+		if !allowed.Intersect(family).IsEmpty() {
+			result = result.Union(routed.Intersect(family))
+		}
+	}
+	return result.CIDRs()
+}
+
+func (dlg *EditDialog) onExcludePrivateIPsCBCheckedChanged() {
+	if dlg.excludePrivateIPsCheckGuard {
+		return
+	}
+
+	var cfg *conf.Config
+	var applicable bool
+	doc, err := conf.ParseDocument(dlg.syntaxEdit.Text(), "temporary")
+	if err != nil {
+		goto err
+	}
+	cfg, err = doc.Config()
+	if err != nil {
+		goto err
+	}
+	if len(cfg.Peers) != 1 {
+		goto err
+	}
+	applicable, _ = excludingPrivateIPs(cfg.Peers[0].AllowedIPs)
+	if !applicable {
+		goto err
+	}
+
+	cfg.Peers[0].AllowedIPs = setExcludingPrivateIPs(cfg.Peers[0].AllowedIPs, dlg.excludePrivateIPsCB.Checked())
+	err = doc.Apply(cfg)
+	if err != nil {
+		goto err
+	}
+	dlg.syntaxEdit.SetText(doc.String())
+	return
+
+err:
+	walk.MsgBox(dlg, "Invalid configuration", "Unable to toggle exclusion of private IPs.", walk.MsgBoxIconWarning)
+	dlg.excludePrivateIPsCB.SetVisible(false)
+}
+
+func (dlg *EditDialog) onSyntaxEditTextChanged() {
+	applicable, excluding := false, false
+	if cfg, err := conf.FromWgQuick(dlg.syntaxEdit.Text(), "temporary"); err == nil && len(cfg.Peers) == 1 {
+		applicable, excluding = excludingPrivateIPs(cfg.Peers[0].AllowedIPs)
+	}
+	dlg.excludePrivateIPsCheckGuard = true
+	dlg.excludePrivateIPsCB.SetVisible(applicable)
+	dlg.excludePrivateIPsCB.SetChecked(excluding)
+	dlg.excludePrivateIPsCheckGuard = false
+}
+
 func (dlg *EditDialog) onSyntaxEditPrivateKeyChanged(privateKey string) {
 	if privateKey == dlg.lastPrivateKey {
 		return
@@ -281,12 +386,16 @@ func (dlg *EditDialog) onSaveButtonClicked() {
 		}
 	}
 
-	cfg, err := conf.FromWgQuick(dlg.syntaxEdit.Text(), newName)
+	doc, err := conf.ParseDocument(dlg.syntaxEdit.Text(), newName)
 	if err != nil {
-		walk.MsgBox(dlg, "Unable to create new configuration", err.Error(), walk.MsgBoxIconError)
+		message := err.Error()
+		if parseErr, ok := err.(*conf.ParseError); ok && parseErr.Line > 0 {
+			message = fmt.Sprintf("Line %d: %s", parseErr.Line, message)
+		}
+		walk.MsgBox(dlg, "Unable to create new configuration", message, walk.MsgBoxIconError)
 		return
 	}
 
-	dlg.config = *cfg
+	dlg.document = doc
 	dlg.Accept()
 }
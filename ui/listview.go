@@ -21,6 +21,7 @@ type ListModel struct {
 	walk.SorterBase
 
 	tunnels []service.Tunnel
+	orders  map[string]int
 }
 
 func (t *ListModel) RowCount() int {
@@ -44,7 +45,8 @@ func (t *ListModel) Value(row, col int) interface{} {
 
 func (t *ListModel) Sort(col int, order walk.SortOrder) error {
 	sort.SliceStable(t.tunnels, func(i, j int) bool {
-		return conf.TunnelNameIsLess(t.tunnels[i].Name, t.tunnels[j].Name)
+		a, b := t.tunnels[i].Name, t.tunnels[j].Name
+		return conf.TunnelIsListedBefore(a, t.orders[a], b, t.orders[b])
 	})
 
 	return t.SorterBase.Sort(col, order)
@@ -56,6 +58,7 @@ type ListView struct {
 	model *ListModel
 
 	tunnelChangedCB        *service.TunnelChangeCallback
+	tunnelRenamedCB        *service.TunnelRenameCallback
 	tunnelsChangedCB       *service.TunnelsChangeCallback
 	tunnelsUpdateSuspended int32
 }
@@ -89,6 +92,7 @@ func NewListView(parent walk.Container) (*ListView, error) {
 	disposables.Spare()
 
 	tunnelsView.tunnelChangedCB = service.IPCClientRegisterTunnelChange(tunnelsView.onTunnelChange)
+	tunnelsView.tunnelRenamedCB = service.IPCClientRegisterTunnelRename(tunnelsView.onTunnelRename)
 	tunnelsView.tunnelsChangedCB = service.IPCClientRegisterTunnelsChange(tunnelsView.onTunnelsChange)
 
 	return tunnelsView, nil
@@ -99,6 +103,10 @@ func (tv *ListView) Dispose() {
 		tv.tunnelChangedCB.Unregister()
 		tv.tunnelChangedCB = nil
 	}
+	if tv.tunnelRenamedCB != nil {
+		tv.tunnelRenamedCB.Unregister()
+		tv.tunnelRenamedCB = nil
+	}
 	if tv.tunnelsChangedCB != nil {
 		tv.tunnelsChangedCB.Unregister()
 		tv.tunnelsChangedCB = nil
@@ -167,6 +175,27 @@ func (tv *ListView) onTunnelChange(tunnel *service.Tunnel, state service.TunnelS
 	})
 }
 
+// onTunnelRename renames the row of the tunnel in place, so that it stays selected if it was.
+func (tv *ListView) onTunnelRename(oldName string, tunnel *service.Tunnel, state service.TunnelState, globalState service.TunnelState, err error) {
+	tv.Synchronize(func() {
+		for i := range tv.model.tunnels {
+			if tv.model.tunnels[i].Name == oldName {
+				selected := tv.CurrentIndex() == i
+				tv.model.tunnels[i] = *tunnel
+				if order, ok := tv.model.orders[oldName]; ok {
+					delete(tv.model.orders, oldName)
+					tv.model.orders[tunnel.Name] = order
+				}
+				tv.model.Sort(tv.model.SortedColumn(), tv.model.SortOrder())
+				if selected {
+					tv.selectTunnel(tunnel.Name)
+				}
+				return
+			}
+		}
+	})
+}
+
 func (tv *ListView) onTunnelsChange() {
 	if atomic.LoadInt32(&tv.tunnelsUpdateSuspended) == 0 {
 		tv.Load(true)
@@ -187,7 +216,21 @@ func (tv *ListView) Load(asyncUI bool) {
 	if err != nil {
 		return
 	}
+	orders := make(map[string]int, len(tunnels))
+	for i := range tunnels {
+		if metadata, err := tunnels[i].Metadata(); err == nil && metadata.Order != 0 {
+			orders[tunnels[i].Name] = metadata.Order
+		}
+	}
 	doUI := func() {
+		reordered := len(orders) != len(tv.model.orders)
+		for name, order := range orders {
+			if tv.model.orders[name] != order {
+				reordered = true
+			}
+		}
+		tv.model.orders = orders
+
 		newTunnels := make(map[service.Tunnel]bool, len(tunnels))
 		oldTunnels := make(map[service.Tunnel]bool, len(tv.model.tunnels))
 		for _, tunnel := range tunnels {
@@ -220,7 +263,7 @@ func (tv *ListView) Load(asyncUI bool) {
 				didAdd = true
 			}
 		}
-		if didAdd {
+		if didAdd || reordered {
 			tv.model.PublishRowsReset()
 			tv.model.Sort(tv.model.SortedColumn(), tv.model.SortOrder())
 			if len(tv.SelectedIndexes()) == 0 {
@@ -200,32 +200,30 @@ static bool is_valid_persistentkeepalive(string_span_t s)
 	return is_valid_uint(s, false, 0, 65535);
 }
 
-#ifndef MOBILE_WGQUICK_SUBSET
-
-static bool is_valid_fwmark(string_span_t s)
+static bool is_valid_table(string_span_t s)
 {
+	if (is_same(s, "auto"))
+		return true;
 	if (is_same(s, "off"))
 		return true;
-	return is_valid_uint(s, true, 0, 4294967295);
+	/* There is no rt_tables file to consult on Windows, so only numeric tables are accepted. */
+	return is_valid_uint(s, false, 1, 4294967295);
 }
 
-static bool is_valid_table(string_span_t s)
+static bool is_valid_fwmark(string_span_t s)
 {
-	if (is_same(s, "auto"))
-		return true;
 	if (is_same(s, "off"))
 		return true;
-	/* This pretty much invalidates the other checks, but rt_names.c's
-	 * fread_id_name does no validation aside from this. */
-	if (s.len < 512)
-		return true;
-	return is_valid_uint(s, false, 0, 4294967295);
+	return is_valid_uint(s, true, 0, 4294967295);
 }
 
+#ifndef MOBILE_WGQUICK_SUBSET
+
 static bool is_valid_saveconfig(string_span_t s)
 {
 	return is_same(s, "true") || is_same(s, "false");
 }
+#endif
 
 static bool is_valid_prepostupdown(string_span_t s)
 {
@@ -233,7 +231,6 @@ static bool is_valid_prepostupdown(string_span_t s)
 	 * So instead we just demand non-zero length. */
 	return s.len;
 }
-#endif
 
 static bool is_valid_scope(string_span_t s)
 {
@@ -316,11 +313,6 @@ static bool is_valid_network(string_span_t s)
 	return is_valid_ipv4(s) || is_valid_ipv6(s);
 }
 
-static bool is_valid_dns(string_span_t s)
-{
-	return is_valid_ipv4(s) || is_valid_ipv6(s);
-}
-
 enum field {
 	InterfaceSection,
 	PrivateKey,
@@ -328,10 +320,10 @@ enum field {
 	Address,
 	DNS,
 	MTU,
-#ifndef MOBILE_WGQUICK_SUBSET
-	FwMark,
-	Table,
 	PreUp, PostUp, PreDown, PostDown,
+	Table,
+	FwMark,
+#ifndef MOBILE_WGQUICK_SUBSET
 	SaveConfig,
 #endif
 
@@ -367,13 +359,13 @@ static enum field get_field(string_span_t s)
 	check_enum(AllowedIPs);
 	check_enum(Endpoint);
 	check_enum(PersistentKeepalive);
-#ifndef MOBILE_WGQUICK_SUBSET
-	check_enum(FwMark);
-	check_enum(Table);
 	check_enum(PreUp);
 	check_enum(PostUp);
 	check_enum(PreDown);
 	check_enum(PostDown);
+	check_enum(Table);
+	check_enum(FwMark);
+#ifndef MOBILE_WGQUICK_SUBSET
 	check_enum(SaveConfig);
 #endif
 	return Invalid;
@@ -430,7 +422,12 @@ static void highlight_multivalue_value(struct highlight_span_array *ret, const s
 {
 	switch (section) {
 	case DNS:
-		append_highlight_span(ret, parent.s, s, is_valid_dns(s) ? HighlightIP : HighlightError);
+		if (is_valid_ipv4(s) || is_valid_ipv6(s))
+			append_highlight_span(ret, parent.s, s, HighlightIP);
+		else if (is_valid_hostname(s))
+			append_highlight_span(ret, parent.s, s, HighlightHost);
+		else
+			append_highlight_span(ret, parent.s, s, HighlightError);
 		break;
 	case Address:
 	case AllowedIPs: {
@@ -505,6 +502,7 @@ static void highlight_value(struct highlight_span_array *ret, const string_span_
 	case SaveConfig:
 		append_highlight_span(ret, parent.s, s, is_valid_saveconfig(s) ? HighlightSaveConfig : HighlightError);
 		break;
+#endif
 	case FwMark:
 		append_highlight_span(ret, parent.s, s, is_valid_fwmark(s) ? HighlightFwMark : HighlightError);
 		break;
@@ -517,7 +515,6 @@ static void highlight_value(struct highlight_span_array *ret, const string_span_
 	case PostDown:
 		append_highlight_span(ret, parent.s, s, is_valid_prepostupdown(s) ? HighlightCmd : HighlightError);
 		break;
-#endif
 	case ListenPort:
 		append_highlight_span(ret, parent.s, s, is_valid_port(s) ? HighlightPort : HighlightError);
 		break;
@@ -21,11 +21,11 @@ enum highlight_type {
 	HighlightKeepalive,
 	HighlightComment,
 	HighlightDelimiter,
-#ifndef MOBILE_WGQUICK_SUBSET
+	HighlightCmd,
 	HighlightTable,
 	HighlightFwMark,
+#ifndef MOBILE_WGQUICK_SUBSET
 	HighlightSaveConfig,
-	HighlightCmd,
 #endif
 	HighlightError,
 	HighlightEnd
@@ -47,11 +47,11 @@ static const struct span_style stylemap[] = {
 	[HighlightKeepalive] = { .color = RGB(0x1C, 0x00, 0xCF) },
 	[HighlightComment] = { .color = RGB(0x53, 0x65, 0x79), .effects = CFE_ITALIC },
 	[HighlightDelimiter] = { .color = RGB(0x00, 0x00, 0x00) },
-#ifndef MOBILE_WGQUICK_SUBSET
+	[HighlightCmd] = { .color = RGB(0x63, 0x75, 0x89) },
 	[HighlightTable] = { .color = RGB(0x1C, 0x00, 0xCF) },
 	[HighlightFwMark] = { .color = RGB(0x1C, 0x00, 0xCF) },
+#ifndef MOBILE_WGQUICK_SUBSET
 	[HighlightSaveConfig] = { .color = RGB(0x81, 0x5F, 0x03) },
-	[HighlightCmd] = { .color = RGB(0x63, 0x75, 0x89) },
 #endif
 	[HighlightError] = { .color = RGB(0xC4, 0x1A, 0x16), .effects = CFE_UNDERLINE }
 };
@@ -17,6 +17,7 @@ import (
 	"github.com/lxn/walk"
 	"github.com/lxn/win"
 	"golang.zx2c4.com/wireguard/windows/conf"
+	"golang.zx2c4.com/wireguard/windows/qrcode"
 	"golang.zx2c4.com/wireguard/windows/service"
 )
 
@@ -261,9 +262,54 @@ func (tp *TunnelsPage) importFiles(paths []string) {
 
 		var (
 			unparsedConfigs []unparsedConfig
+			unsupported     []string
+			networks        []string
 			lastErr         error
 		)
 
+		// Metadata that was exported along with a tunnel is kept by lowercase name, and is looked for
+		// among the selected files, in zip files, and next to .conf files.
+		metadata := make(map[string]string)
+		isMetadata := func(file string) bool {
+			return strings.HasSuffix(strings.ToLower(file), conf.MetadataExportSuffix)
+		}
+		metadataName := func(file string) string {
+			base := filepath.Base(file)
+			return strings.ToLower(base[:len(base)-len(conf.MetadataExportSuffix)])
+		}
+		for _, path := range paths {
+			if !isMetadata(path) {
+				continue
+			}
+			text, err := ioutil.ReadFile(path)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			metadata[metadataName(path)] = string(text)
+		}
+
+		addConverted := func(path string, config *conf.Config, settings []conf.UnsupportedSetting) {
+			unparsedConfigs = append(unparsedConfigs, unparsedConfig{Name: config.Name, Config: config.ToWgQuick()})
+			for _, setting := range settings {
+				unsupported = append(unsupported, fmt.Sprintf("%s, %s", filepath.Base(path), setting.String()))
+			}
+		}
+
+		// A .netdev is paired with the .network files selected along with it, or if there are none,
+		// with those next to it.
+		for _, path := range paths {
+			if strings.ToLower(filepath.Ext(path)) != ".network" {
+				continue
+			}
+			textNetwork, err := ioutil.ReadFile(path)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			networks = append(networks, string(textNetwork))
+		}
+
 		for _, path := range paths {
 			switch strings.ToLower(filepath.Ext(path)) {
 			case ".conf":
@@ -272,7 +318,13 @@ func (tp *TunnelsPage) importFiles(paths []string) {
 					lastErr = err
 					continue
 				}
-				unparsedConfigs = append(unparsedConfigs, unparsedConfig{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), Config: string(textConfig)})
+				name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+				unparsedConfigs = append(unparsedConfigs, unparsedConfig{Name: name, Config: string(textConfig)})
+				if _, ok := metadata[strings.ToLower(name)]; !ok {
+					if text, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), name+conf.MetadataExportSuffix)); err == nil {
+						metadata[strings.ToLower(name)] = string(text)
+					}
+				}
 			case ".zip":
 				// 1 .conf + 1 error .zip edge case?
 				r, err := zip.OpenReader(path)
@@ -282,6 +334,21 @@ func (tp *TunnelsPage) importFiles(paths []string) {
 				}
 
 				for _, f := range r.File {
+					if isMetadata(f.Name) {
+						rc, err := f.Open()
+						if err != nil {
+							lastErr = err
+							continue
+						}
+						text, err := ioutil.ReadAll(rc)
+						rc.Close()
+						if err != nil {
+							lastErr = err
+							continue
+						}
+						metadata[metadataName(f.Name)] = string(text)
+						continue
+					}
 					if strings.ToLower(filepath.Ext(f.Name)) != ".conf" {
 						continue
 					}
@@ -301,6 +368,59 @@ func (tp *TunnelsPage) importFiles(paths []string) {
 				}
 
 				r.Close()
+			case ".netdev":
+				textNetdev, err := ioutil.ReadFile(path)
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				candidates := networks
+				if candidates == nil {
+					siblings, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.network"))
+					for _, sibling := range siblings {
+						if textNetwork, err := ioutil.ReadFile(sibling); err == nil {
+							candidates = append(candidates, string(textNetwork))
+						}
+					}
+				}
+				config, settings, err := conf.FromNetworkd(string(textNetdev), candidates...)
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				addConverted(path, config, settings)
+			case ".nmconnection":
+				textKeyfile, err := ioutil.ReadFile(path)
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				config, settings, err := conf.FromNetworkManager(string(textKeyfile))
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				addConverted(path, config, settings)
+			case ".png", ".jpg", ".jpeg":
+				file, err := os.Open(path)
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				textConfig, err := qrcode.DecodeImage(file)
+				file.Close()
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+				// Any image may have a QR code in it, so make sure that it holds a configuration.
+				_, err = conf.FromWgQuick(string(textConfig), name)
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				unparsedConfigs = append(unparsedConfigs, unparsedConfig{Name: name, Config: string(textConfig)})
 			}
 		}
 
@@ -331,20 +451,33 @@ func (tp *TunnelsPage) importFiles(paths []string) {
 				lastErr = fmt.Errorf("Another tunnel already exists with the name ‘%s’", unparsedConfig.Name)
 				continue
 			}
-			config, err := conf.FromWgQuick(unparsedConfig.Config, unparsedConfig.Name)
+			doc, err := conf.ParseDocument(unparsedConfig.Config, unparsedConfig.Name)
 			if err != nil {
 				lastErr = err
 				continue
 			}
-			_, err = service.IPCClientNewTunnel(config)
+			tunnel, err := service.IPCClientNewTunnelFromDocument(doc)
 			if err != nil {
 				lastErr = err
 				continue
 			}
+			if text, ok := metadata[strings.ToLower(unparsedConfig.Name)]; ok {
+				m, err := conf.MetadataFromJSON(text)
+				if err == nil {
+					err = tunnel.SetMetadata(m)
+				}
+				if err != nil {
+					lastErr = fmt.Errorf("Unable to import metadata of ‘%s’: %v", unparsedConfig.Name, err)
+				}
+			}
 			configCount++
 		}
 		tp.listView.SetSuspendTunnelsUpdate(false)
 
+		if len(unsupported) > 0 {
+			syncedMsgBox("Unsupported settings", fmt.Sprintf("These settings have no equivalent here and were not imported:\n\n%s", strings.Join(unsupported, "\n")), walk.MsgBoxIconWarning)
+		}
+
 		m, n := configCount, len(unparsedConfigs)
 		switch {
 		case n == 1 && m != n:
@@ -359,23 +492,72 @@ func (tp *TunnelsPage) importFiles(paths []string) {
 	}()
 }
 
-func (tp *TunnelsPage) exportTunnels(filePath string) {
+type exportFormat int
+
+// These are in the order of the filters of the export dialog.
+const (
+	exportWgQuick exportFormat = iota
+	exportNetworkd
+	exportNetworkManager
+	exportSetconf
+)
+
+func exportedFiles(name string, doc *conf.Document, format exportFormat) ([][2]string, error) {
+	if format == exportWgQuick {
+		return [][2]string{{name + ".conf", doc.String()}}, nil
+	}
+	config, err := doc.Config()
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case exportNetworkd:
+		netdev, network := config.ToNetworkd()
+		return [][2]string{{name + ".netdev", netdev}, {name + ".network", network}}, nil
+	case exportNetworkManager:
+		return [][2]string{{name + ".nmconnection", config.ToNetworkManager()}}, nil
+	case exportSetconf:
+		return [][2]string{{name + ".conf", config.ToSetconf()}}, nil
+	}
+	return nil, fmt.Errorf("Unknown export format %d", format)
+}
+
+func (tp *TunnelsPage) exportTunnels(filePath string, format exportFormat) {
 	writeFileWithOverwriteHandling(tp.Form(), filePath, func(file *os.File) error {
 		writer := zip.NewWriter(file)
 
 		for _, tunnel := range tp.listView.model.tunnels {
-			cfg, err := tunnel.StoredConfig()
+			doc, _, err := tunnel.StoredDocument()
 			if err != nil {
-				return fmt.Errorf("onExportTunnels: tunnel.StoredConfig failed: %v", err)
+				return fmt.Errorf("onExportTunnels: tunnel.StoredDocument failed: %v", err)
 			}
 
-			w, err := writer.Create(tunnel.Name + ".conf")
+			files, err := exportedFiles(tunnel.Name, doc, format)
 			if err != nil {
-				return fmt.Errorf("onExportTunnels: writer.Create failed: %v", err)
+				return fmt.Errorf("onExportTunnels: exportedFiles failed: %v", err)
 			}
 
-			if _, err := w.Write(([]byte)(cfg.ToWgQuick())); err != nil {
-				return fmt.Errorf("onExportTunnels: cfg.ToWgQuick failed: %v", err)
+			metadata, err := tunnel.Metadata()
+			if err != nil {
+				return fmt.Errorf("onExportTunnels: tunnel.Metadata failed: %v", err)
+			}
+			if !metadata.IsEmpty() {
+				text, err := metadata.ToJSON()
+				if err != nil {
+					return fmt.Errorf("onExportTunnels: metadata.ToJSON failed: %v", err)
+				}
+				files = append(files, [2]string{tunnel.Name + conf.MetadataExportSuffix, text})
+			}
+
+			for _, f := range files {
+				w, err := writer.Create(f[0])
+				if err != nil {
+					return fmt.Errorf("onExportTunnels: writer.Create failed: %v", err)
+				}
+
+				if _, err := w.Write(([]byte)(f[1])); err != nil {
+					return fmt.Errorf("onExportTunnels: w.Write failed: %v", err)
+				}
 			}
 		}
 
@@ -383,8 +565,8 @@ func (tp *TunnelsPage) exportTunnels(filePath string) {
 	})
 }
 
-func (tp *TunnelsPage) addTunnel(config *conf.Config) {
-	_, err := service.IPCClientNewTunnel(config)
+func (tp *TunnelsPage) addTunnel(doc *conf.Document) {
+	_, err := service.IPCClientNewTunnelFromDocument(doc)
 	if err != nil {
 		walk.MsgBox(tp.Form(), "Unable to create tunnel", err.Error(), walk.MsgBoxIconError)
 	}
@@ -421,14 +603,20 @@ func (tp *TunnelsPage) onEditTunnel() {
 		return
 	}
 
-	if config := runTunnelEditDialog(tp.Form(), tunnel, false); config != nil {
+	if doc, revisionToken := runTunnelEditDialog(tp.Form(), tunnel, false); doc != nil {
 		go func() {
-			priorState, err := tunnel.State()
-			tunnel.Delete()
-			tunnel.WaitForStop()
-			tunnel, err2 := service.IPCClientNewTunnel(config)
-			if err == nil && err2 == nil && (priorState == service.TunnelStarting || priorState == service.TunnelStarted) {
-				tunnel.Start()
+			// Save the changes under the old name first, so that renaming restarts a running tunnel
+			// only once, and with the new configuration.
+			saved := *doc
+			saved.Name = tunnel.Name
+			err := tunnel.Update(&saved, revisionToken)
+			if err == nil && doc.Name != tunnel.Name {
+				_, err = tunnel.Rename(doc.Name)
+			}
+			if err != nil {
+				tp.Synchronize(func() {
+					walk.MsgBox(tp.Form(), "Unable to save tunnel", err.Error(), walk.MsgBoxIconError)
+				})
 			}
 		}()
 	}
@@ -440,16 +628,16 @@ func (tp *TunnelsPage) onCloneTunnel() {
 		return
 	}
 
-	if config := runTunnelEditDialog(tp.Form(), tunnel, true); config != nil {
+	if doc, _ := runTunnelEditDialog(tp.Form(), tunnel, true); doc != nil {
 		// Save new
-		tp.addTunnel(config)
+		tp.addTunnel(doc)
 	}
 }
 
 func (tp *TunnelsPage) onAddTunnel() {
-	if config := runTunnelEditDialog(tp.Form(), nil, false); config != nil {
+	if doc, _ := runTunnelEditDialog(tp.Form(), nil, false); doc != nil {
 		// Save new
-		tp.addTunnel(config)
+		tp.addTunnel(doc)
 	}
 }
 
@@ -523,7 +711,7 @@ func (tp *TunnelsPage) onSelectAll() {
 
 func (tp *TunnelsPage) onImport() {
 	dlg := walk.FileDialog{
-		Filter: "Configuration Files (*.zip, *.conf)|*.zip;*.conf|All Files (*.*)|*.*",
+		Filter: "Configuration Files (*.zip, *.conf, *.netdev, *.network, *.nmconnection)|*.zip;*.conf;*.netdev;*.network;*.nmconnection|QR Code Images (*.png, *.jpg, *.jpeg)|*.png;*.jpg;*.jpeg|All Files (*.*)|*.*",
 		Title:  "Import tunnel(s) from file...",
 	}
 
@@ -536,7 +724,7 @@ func (tp *TunnelsPage) onImport() {
 
 func (tp *TunnelsPage) onExportTunnels() {
 	dlg := walk.FileDialog{
-		Filter: "Configuration ZIP Files (*.zip)|*.zip",
+		Filter: "Configuration ZIP Files (*.zip)|*.zip|systemd-networkd ZIP Files (*.zip)|*.zip|NetworkManager ZIP Files (*.zip)|*.zip|wg setconf ZIP Files (*.zip)|*.zip",
 		Title:  "Export tunnels to zip...",
 	}
 
@@ -548,7 +736,8 @@ func (tp *TunnelsPage) onExportTunnels() {
 		dlg.FilePath += ".zip"
 	}
 
-	tp.exportTunnels(dlg.FilePath)
+	// FilterIndex counts from one.
+	tp.exportTunnels(dlg.FilePath, exportFormat(dlg.FilterIndex-1))
 }
 
 func (tp *TunnelsPage) swapFiller(enabled bool) bool {
@@ -43,6 +43,7 @@ var (
 
 	procMessageBoxExW  = moduser32.NewProc("MessageBoxExW")
 	procIsWow64Process = modkernel32.NewProc("IsWow64Process")
+	procAttachConsole  = modkernel32.NewProc("AttachConsole")
 	procShellExecuteW  = modshell32.NewProc("ShellExecuteW")
 )
 
@@ -63,6 +64,18 @@ func isWow64Process(handle windows.Handle, isWow64 *bool) (err error) {
 	return
 }
 
+func attachConsole(processId uint32) (err error) {
+	r1, _, e1 := syscall.Syscall(procAttachConsole.Addr(), 1, uintptr(processId), 0, 0)
+	if r1 == 0 {
+		if e1 != 0 {
+			err = errnoErr(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
 func shellExecute(hwnd windows.Handle, verb *uint16, file *uint16, args *uint16, cwd *uint16, showCmd int) (err error) {
 	r1, _, e1 := syscall.Syscall6(procShellExecuteW.Addr(), 6, uintptr(hwnd), uintptr(unsafe.Pointer(verb)), uintptr(unsafe.Pointer(file)), uintptr(unsafe.Pointer(args)), uintptr(unsafe.Pointer(cwd)), uintptr(showCmd))
 	if r1 == 0 {